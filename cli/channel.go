@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+var channelStatusNames = map[int]string{
+	model.ChannelStatusEnabled:          "enabled",
+	model.ChannelStatusManuallyDisabled: "disabled",
+	model.ChannelStatusAutoDisabled:     "auto-disabled",
+}
+
+func runChannelList(args []string) error {
+	fs := newFlagSet("channel list")
+	scope := fs.String("scope", "all", "all or disabled")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *scope != "all" && *scope != "disabled" {
+		return fmt.Errorf("invalid scope: %s", *scope)
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	channels, err := model.GetAllChannels(0, 0, *scope)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tSTATUS\tGROUP\tPRIORITY\tRESPONSE TIME\tBALANCE")
+	for _, channel := range channels {
+		status, ok := channelStatusNames[channel.Status]
+		if !ok {
+			status = strconv.Itoa(channel.Status)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%d\t%dms\t%.2f\n", channel.Id, channel.Name, channel.Type, status,
+			channel.Group, channel.GetPriority(), channel.ResponseTime, channel.Balance)
+	}
+	return w.Flush()
+}
+
+func runChannelTest(args []string) error {
+	fs := newFlagSet("channel test")
+	modelName := fs.String("model", "", "model used for testing, defaults to the first model of the channel")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: one-api channel test [--model <model>] <channel id>")
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid channel id: %s", fs.Arg(0))
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	openai.InitTokenEncoders()
+	client.Init()
+	milliseconds, err := controller.TestChannelById(id, *modelName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("channel %d passed in %.2fs\n", id, float64(milliseconds)/1000.0)
+	return nil
+}
+
+// runChannelEncryptSecrets encrypts the plaintext channel secrets, it also rotates the master key:
+// set CHANNEL_SECRET_KEY to the new key and CHANNEL_SECRET_OLD_KEYS to the old ones, then run this command
+func runChannelEncryptSecrets(args []string) error {
+	fs := newFlagSet("channel encrypt-secrets")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	count, err := model.RotateChannelSecrets()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("secrets of %d channels encrypted with the current master key\n", count)
+	return nil
+}
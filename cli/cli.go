@@ -0,0 +1,154 @@
+// Package cli implements the admin subcommands of one-api, they work against
+// the configured database directly without starting the HTTP server.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"migrate", "migrate the database schema and create the root user if needed", runMigrate},
+	{"user create", "create a user", runUserCreate},
+	{"user reset-password", "reset the password of a user", runUserResetPassword},
+	{"user reset-2fa", "disable the two-factor authentication of a user", runUserResetTwoFactor},
+	{"token issue", "issue a token for a user", runTokenIssue},
+	{"channel list", "list channels", runChannelList},
+	{"channel test", "test a channel", runChannelTest},
+	{"channel encrypt-secrets", "encrypt channel secrets with the current master key", runChannelEncryptSecrets},
+	{"logs purge", "delete logs created before the given time", runLogsPurge},
+}
+
+// Usage prints the available subcommands
+func Usage() {
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-24s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Println("Run 'one-api <command> --help' for the options of a command.")
+}
+
+// Run executes the subcommand given by args and returns the exit code
+func Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" {
+		Usage()
+		return 0
+	}
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+		err := cmd.run(args[len(words):])
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.name, err.Error())
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n", strings.Join(args, " "))
+	Usage()
+	return 2
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("one-api "+name, flag.ContinueOnError)
+}
+
+// setup connects to the databases and loads the options, the caller should defer teardown
+func setup() error {
+	err := model.InitChannelSecretKeys()
+	if err != nil {
+		return err
+	}
+	model.InitDB()
+	model.InitLogDB()
+	err = common.InitRedisClient()
+	if err != nil {
+		return err
+	}
+	model.InitOptionMap()
+	return nil
+}
+
+func teardown() {
+	_ = model.CloseDB()
+}
+
+func runMigrate(args []string) error {
+	fs := newFlagSet("migrate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// migrations only run on the master node
+	config.IsMasterNode = true
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	if err := model.CreateRootAccountIfNeed(); err != nil {
+		return err
+	}
+	model.InitModelPrices()
+	fmt.Println("database migrated")
+	return nil
+}
+
+func runLogsPurge(args []string) error {
+	fs := newFlagSet("logs purge")
+	before := fs.String("before", "", "delete logs created before this time, e.g. 2024-01-02, 2024-01-02T15:04:05Z07:00 or a unix timestamp")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *before == "" {
+		return errors.New("--before is required")
+	}
+	targetTime, err := parseTime(*before)
+	if err != nil {
+		return err
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	count, err := model.DeleteOldLog(targetTime.Unix())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d logs created before %s\n", count, targetTime.Format(time.RFC3339))
+	return nil
+}
+
+// parseTime accepts a date, a date time in local time, an RFC 3339 time or a unix timestamp
+func parseTime(s string) (time.Time, error) {
+	if timestamp, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
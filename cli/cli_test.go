@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"1704153600", time.Unix(1704153600, 0), false},
+		{"2024-01-02T15:04:05Z", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{"2024-01-02T15:04:05+08:00", time.Date(2024, 1, 2, 7, 4, 5, 0, time.UTC), false},
+		{"2024-01-02 15:04:05", time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local), false},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), false},
+		{"2024/01/02", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseTime(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+		})
+	}
+}
+
+// the cases fail before connecting to the database
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"no command", nil, 0},
+		{"help", []string{"help"}, 0},
+		{"unknown command", []string{"foo"}, 2},
+		{"incomplete command", []string{"user"}, 2},
+		{"unknown subcommand", []string{"user", "delete"}, 2},
+		{"command help", []string{"user", "create", "--help"}, 0},
+		{"unknown flag", []string{"logs", "purge", "--after", "2024-01-02"}, 1},
+		{"missing flag", []string{"logs", "purge"}, 1},
+		{"invalid time", []string{"logs", "purge", "--before", "yesterday"}, 1},
+		{"invalid role", []string{"user", "create", "--username", "test", "--password", "12345678", "--role", "owner"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, Run(tt.args))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func runTokenIssue(args []string) error {
+	fs := newFlagSet("token issue")
+	username := fs.String("username", "", "owner of the token")
+	userId := fs.Int("user-id", 0, "id of the owner, used if --username is not set")
+	name := fs.String("name", "cli", "token name")
+	quota := fs.Int64("quota", 0, "remaining quota of the token")
+	unlimited := fs.Bool("unlimited", false, "unlimited quota")
+	expires := fs.String("expires", "", "expiration time, e.g. 2024-01-02 or a unix timestamp, never expires if not set")
+	models := fs.String("models", "", "allowed models separated by comma, all models if not set")
+	subnet := fs.String("subnet", "", "allowed subnets separated by comma, e.g. 192.168.0.0/24")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" && *userId == 0 {
+		return errors.New("--username or --user-id is required")
+	}
+	var expiredTime int64 = -1
+	if *expires != "" {
+		t, err := parseTime(*expires)
+		if err != nil {
+			return err
+		}
+		expiredTime = t.Unix()
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	user := model.User{Id: *userId, Username: *username}
+	var err error
+	if *username != "" {
+		err = user.FillUserByUsername()
+	} else {
+		err = user.FillUserById()
+	}
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 || user.Status == model.UserStatusDeleted {
+		return errors.New("user not found")
+	}
+	token := model.Token{
+		UserId:         user.Id,
+		Name:           *name,
+		Key:            random.GenerateKey(),
+		CreatedTime:    helper.GetTimestamp(),
+		AccessedTime:   helper.GetTimestamp(),
+		ExpiredTime:    expiredTime,
+		RemainQuota:    *quota,
+		UnlimitedQuota: *unlimited,
+		Models:         models,
+		Subnet:         subnet,
+	}
+	if err := token.Insert(); err != nil {
+		return err
+	}
+	fmt.Printf("token %d issued for user %s:\nsk-%s\n", token.Id, user.Username, token.Key)
+	return nil
+}
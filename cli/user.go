@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func runUserCreate(args []string) error {
+	fs := newFlagSet("user create")
+	username := fs.String("username", "", "username")
+	password := fs.String("password", "", "password, 8 to 20 characters")
+	displayName := fs.String("display-name", "", "display name, defaults to the username")
+	email := fs.String("email", "", "email")
+	group := fs.String("group", "default", "group")
+	role := fs.String("role", "common", "role: common, admin or root")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" || *password == "" {
+		return errors.New("--username and --password are required")
+	}
+	roles := map[string]int{
+		"common": model.RoleCommonUser,
+		"admin":  model.RoleAdminUser,
+		"root":   model.RoleRootUser,
+	}
+	userRole, ok := roles[*role]
+	if !ok {
+		return fmt.Errorf("invalid role: %s", *role)
+	}
+	user := model.User{
+		Username:    *username,
+		Password:    *password,
+		DisplayName: *displayName,
+		Email:       *email,
+		Group:       *group,
+		Role:        userRole,
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = user.Username
+	}
+	if err := common.Validate.Struct(&user); err != nil {
+		return err
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	if model.IsUsernameAlreadyTaken(user.Username) {
+		return errors.New("username is already taken")
+	}
+	if err := user.Insert(0); err != nil {
+		return err
+	}
+	fmt.Printf("user %s created with id %d\n", user.Username, user.Id)
+	return nil
+}
+
+func runUserResetPassword(args []string) error {
+	fs := newFlagSet("user reset-password")
+	username := fs.String("username", "root", "username")
+	password := fs.String("password", "", "new password, 8 to 20 characters")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *password == "" {
+		return errors.New("--password is required")
+	}
+	if len(*password) < 8 || len(*password) > 20 {
+		return errors.New("password must be 8 to 20 characters")
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	user := model.User{Username: *username}
+	if err := user.FillUserByUsername(); err != nil {
+		return err
+	}
+	if user.Id == 0 {
+		return fmt.Errorf("user %s not found", *username)
+	}
+	hashedPassword, err := common.Password2Hash(*password)
+	if err != nil {
+		return err
+	}
+	err = model.DB.Model(&model.User{}).Where("id = ?", user.Id).Update("password", hashedPassword).Error
+	if err != nil {
+		return err
+	}
+	fmt.Printf("password of user %s has been reset\n", user.Username)
+	return nil
+}
+
+// runUserResetTwoFactor recovers a user who has lost both the authenticator and the recovery codes
+func runUserResetTwoFactor(args []string) error {
+	fs := newFlagSet("user reset-2fa")
+	username := fs.String("username", "root", "username")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer teardown()
+	user := model.User{Username: *username}
+	if err := user.FillUserByUsername(); err != nil {
+		return err
+	}
+	if user.Id == 0 {
+		return fmt.Errorf("user %s not found", *username)
+	}
+	if err := model.DisableTwoFactor(user.Id); err != nil {
+		return err
+	}
+	fmt.Printf("two-factor authentication of user %s has been reset\n", user.Username)
+	return nil
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// Options tunes the HTTP client of a channel, the zero value means the global HTTPClient
+type Options struct {
+	// Proxy is an http, https or socks5 URL, RELAY_PROXY is used if empty, then HTTP_PROXY / HTTPS_PROXY
+	Proxy                 string
+	ConnectTimeout        time.Duration
+	ResponseHeaderTimeout time.Duration
+	// Timeout limits the whole request including reading the response, RELAY_TIMEOUT is used if zero
+	Timeout            time.Duration
+	InsecureSkipVerify bool
+	ServerName         string
+}
+
+// the cached clients which are not used for a while are evicted, e.g. after the options of the channel are changed
+const channelHTTPClientIdleTimeout = time.Hour
+
+type channelHTTPClient struct {
+	client   *http.Client
+	lastUsed time.Time
+}
+
+var channelHTTPClients = make(map[Options]*channelHTTPClient)
+var channelHTTPClientsLock sync.Mutex
+var channelHTTPClientsEvictedAt = time.Now()
+
+func newHTTPClient(options Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxy := options.Proxy
+	if proxy == "" {
+		proxy = config.RelayProxy
+	}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %s", err.Error())
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	} else {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	if options.ConnectTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   options.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = options.ConnectTimeout
+	}
+	transport.ResponseHeaderTimeout = options.ResponseHeaderTimeout
+	if options.InsecureSkipVerify || options.ServerName != "" {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: options.InsecureSkipVerify,
+			ServerName:         options.ServerName,
+		}
+	}
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = time.Duration(config.RelayTimeout) * time.Second
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// GetHTTPClient returns the client of the options, the clients are cached so that the connections are pooled
+// among the channels with the same options
+func GetHTTPClient(options Options) (*http.Client, error) {
+	if options == (Options{}) {
+		return HTTPClient, nil
+	}
+	channelHTTPClientsLock.Lock()
+	defer channelHTTPClientsLock.Unlock()
+	now := time.Now()
+	if now.Sub(channelHTTPClientsEvictedAt) > channelHTTPClientIdleTimeout {
+		evictChannelHTTPClients(now)
+	}
+	if cached, ok := channelHTTPClients[options]; ok {
+		cached.lastUsed = now
+		return cached.client, nil
+	}
+	httpClient, err := newHTTPClient(options)
+	if err != nil {
+		return nil, err
+	}
+	channelHTTPClients[options] = &channelHTTPClient{client: httpClient, lastUsed: now}
+	return httpClient, nil
+}
+
+// evictChannelHTTPClients removes the idle clients, it must be called with the lock held
+func evictChannelHTTPClients(now time.Time) {
+	for options, cached := range channelHTTPClients {
+		if now.Sub(cached.lastUsed) > channelHTTPClientIdleTimeout {
+			cached.client.CloseIdleConnections()
+			delete(channelHTTPClients, options)
+		}
+	}
+	channelHTTPClientsEvictedAt = now
+}
+
+// ValidateOptions checks the proxy and TLS options without caching the client
+func ValidateOptions(options Options) error {
+	_, err := newHTTPClient(options)
+	return err
+}
@@ -36,8 +36,10 @@ var PasswordRegisterEnabled = true
 var EmailVerificationEnabled = false
 var GitHubOAuthEnabled = false
 var OidcEnabled = false
+var LdapEnabled = false
 var WeChatAuthEnabled = false
 var TurnstileCheckEnabled = false
+var AdminTwoFactorEnabled = false // admin and root users must enable two-factor authentication
 var RegisterEnabled = true
 
 var EmailDomainRestrictionEnabled = false
@@ -77,6 +79,25 @@ var OidcWellKnown = ""
 var OidcAuthorizationEndpoint = ""
 var OidcTokenEndpoint = ""
 var OidcUserinfoEndpoint = ""
+var OidcGroupClaim = ""   // e.g. groups, nested claims like realm_access.roles are supported
+var OidcGroupMapping = "" // JSON object, claim value -> one-api group
+var OidcRoleClaim = ""
+var OidcRoleMapping = ""            // JSON object, claim value -> common or admin
+var OidcPasswordLoginEnabled = true // whether the users linked to OIDC can still log in with password
+
+var LdapServerURL = "" // ldap://host:389 or ldaps://host:636
+var LdapStartTLSEnabled = false
+var LdapTLSSkipVerifyEnabled = false
+var LdapTLSCACert = "" // PEM encoded CA certificates to verify the server, the system roots are used if empty
+var LdapBindDN = ""    // the service account to search the users, anonymous search if empty
+var LdapBindSecret = ""
+var LdapBaseDN = ""
+var LdapUserFilter = "(uid=%s)" // %s is replaced by the escaped username
+var LdapUsernameAttribute = "uid"
+var LdapEmailAttribute = "mail"
+var LdapDisplayNameAttribute = "cn"
+var LdapGroupAttribute = "memberOf"
+var LdapGroupMapping = "" // JSON object, directory group DN or CN -> one-api group
 
 var WeChatServerAddress = ""
 var WeChatServerToken = ""
@@ -88,6 +109,9 @@ var MessagePusherToken = ""
 var TurnstileSiteKey = ""
 var TurnstileSecretKey = ""
 
+// ScimSecret is the bearer token of the SCIM provisioning endpoint, SCIM is disabled if it's empty
+var ScimSecret = ""
+
 var QuotaForNewUser int64 = 0
 var QuotaForInviter int64 = 0
 var QuotaForInvitee int64 = 0
@@ -111,6 +135,21 @@ var SyncFrequency = env.Int("SYNC_FREQUENCY", 10*60) // unit is second
 var BatchUpdateEnabled = false
 var BatchUpdateInterval = env.Int("BATCH_UPDATE_INTERVAL", 5)
 
+// QuotaReservationTimeout unsettled pre-consumed quota will be returned after this, unit is second
+var QuotaReservationTimeout = env.Int("QUOTA_RESERVATION_TIMEOUT", 60*60)
+
+// ConfigFile is the optional YAML or TOML file to manage options and channels declaratively
+var ConfigFile = env.String("CONFIG_FILE", "")
+
+// ShutdownTimeout is the grace period for in-flight requests and billing when shutting down, unit is second
+var ShutdownTimeout = env.Int("SHUTDOWN_TIMEOUT", 60)
+
+// ChannelSecretKey is the master key to encrypt channel keys and configs in database, or the file containing it,
+// ChannelSecretOldKeys are the previous master keys separated by comma, they're only used for decryption during rotation
+var ChannelSecretKey = env.String("CHANNEL_SECRET_KEY", "")
+var ChannelSecretKeyFile = env.String("CHANNEL_SECRET_KEY_FILE", "")
+var ChannelSecretOldKeys = env.String("CHANNEL_SECRET_OLD_KEYS", "")
+
 var RelayTimeout = env.Int("RELAY_TIMEOUT", 0) // unit is second
 
 var GeminiSafetySetting = env.String("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
@@ -0,0 +1,71 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// tasks are background jobs which must be finished before the process exits, e.g. billing
+var tasks sync.WaitGroup
+
+// stopped is set by Stop, then no more tasks are accepted, so that the databases can be closed safely after the wait
+var stopped bool
+var stoppedLock sync.Mutex
+
+// Detach returns a context which keeps the request id of ctx but is never canceled,
+// the request context is canceled as soon as the handler returns
+func Detach(ctx context.Context) context.Context {
+	detached := context.Background()
+	if id := ctx.Value(helper.RequestIdKey); id != nil {
+		detached = context.WithValue(detached, helper.RequestIdKey, id)
+	}
+	return detached
+}
+
+// GoCritical runs f in a new goroutine with the detached ctx, and the shutdown process will wait for it,
+// f is dropped if the process is exiting
+func GoCritical(ctx context.Context, name string, f func(ctx context.Context)) {
+	ctx = Detach(ctx)
+	stoppedLock.Lock()
+	if stopped {
+		stoppedLock.Unlock()
+		logger.Errorf(ctx, "critical task %s is dropped as the server is shutting down", name)
+		return
+	}
+	tasks.Add(1)
+	stoppedLock.Unlock()
+	go func() {
+		defer tasks.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Errorf(ctx, "critical task %s panicked: %v", name, r)
+			}
+		}()
+		f(ctx)
+	}()
+}
+
+// Stop stops accepting new critical tasks, it should be called after the HTTP server is shut down
+func Stop() {
+	stoppedLock.Lock()
+	stopped = true
+	stoppedLock.Unlock()
+}
+
+// WaitCriticalTasks waits for all the critical tasks, returns ctx.Err() if ctx is done first
+func WaitCriticalTasks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		tasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,51 @@
+package graceful
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetach(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), helper.RequestIdKey, "request-id"))
+	detached := Detach(ctx)
+	cancel()
+	assert.NoError(t, detached.Err())
+	assert.Equal(t, "request-id", detached.Value(helper.RequestIdKey))
+}
+
+func TestCriticalTasks(t *testing.T) {
+	defer func() {
+		stopped = false
+	}()
+	var finished atomic.Int32
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		GoCritical(context.Background(), "test", func(ctx context.Context) {
+			<-release
+			finished.Add(1)
+		})
+	}
+	GoCritical(context.Background(), "panic", func(ctx context.Context) {
+		panic("test")
+	})
+
+	// the wait gives up when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, WaitCriticalTasks(ctx), context.DeadlineExceeded)
+
+	close(release)
+	Stop()
+	// no more tasks are accepted after stopped
+	GoCritical(context.Background(), "late", func(ctx context.Context) {
+		finished.Add(100)
+	})
+	require.NoError(t, WaitCriticalTasks(context.Background()))
+	assert.EqualValues(t, 3, finished.Load())
+}
@@ -126,6 +126,15 @@ func AssignOrDefault(value string, defaultValue string) string {
 	return defaultValue
 }
 
+func StringSliceContains(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
 func MessageWithRequestId(message string, id string) string {
 	return fmt.Sprintf("%s (request id: %s)", message, id)
 }
@@ -10,7 +10,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 )
 
-var RDB redis.Cmdable
+var RDB redis.UniversalClient
 var RedisEnabled = true
 
 // InitRedisClient This function is called after init()
@@ -79,3 +79,13 @@ func RedisDecrease(key string, value int64) error {
 	ctx := context.Background()
 	return RDB.DecrBy(ctx, key, value).Err()
 }
+
+func RedisPublish(channel string, message string) error {
+	ctx := context.Background()
+	return RDB.Publish(ctx, channel, message).Err()
+}
+
+func RedisSubscribe(channel string) *redis.PubSub {
+	ctx := context.Background()
+	return RDB.Subscribe(ctx, channel)
+}
@@ -0,0 +1,49 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// the SHA-1 test vectors of RFC 6238, truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for timestamp, expected := range cases {
+		code, err := Code(secret, Step(time.Unix(timestamp, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("code at %d = %s, want %s", timestamp, code, expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := Code(secret, Step(now)-1)
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("code of the previous period should be accepted")
+	}
+	code, _ = Code(secret, Step(now)+2)
+	if _, ok = Validate(secret, code, now); ok {
+		t.Errorf("code out of the skew should be rejected")
+	}
+	if _, ok = Validate(secret, "12345", now); ok {
+		t.Errorf("code with wrong length should be rejected")
+	}
+}
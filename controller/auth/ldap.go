@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const ldapTimeout = 5 * time.Second
+
+type LdapUser struct {
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+func getLdapTLSConfig(serverURL string) (*tls.Config, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: config.LdapTLSSkipVerifyEnabled,
+	}
+	if config.LdapTLSCACert != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.LdapTLSCACert)) {
+			return nil, errors.New("invalid LDAP CA certificate")
+		}
+	}
+	return tlsConfig, nil
+}
+
+func dialLdap() (*ldap.Conn, error) {
+	tlsConfig, err := getLdapTLSConfig(config.LdapServerURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(config.LdapServerURL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	// the plain connection is upgraded before any credentials are sent
+	if config.LdapStartTLSEnabled && strings.HasPrefix(strings.ToLower(config.LdapServerURL), "ldap://") {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// getLdapUser searches the user with the service account, then binds as the user to check the password
+func getLdapUser(username string, password string) (*LdapUser, error) {
+	if username == "" || password == "" {
+		return nil, errors.New("无效的参数")
+	}
+	conn, err := dialLdap()
+	if err != nil {
+		logger.SysError("failed to connect to LDAP server: " + err.Error())
+		return nil, errors.New("无法连接至 LDAP 服务器，请稍后重试！")
+	}
+	defer conn.Close()
+	if config.LdapBindDN != "" {
+		err = conn.Bind(config.LdapBindDN, config.LdapBindSecret)
+		if err != nil {
+			logger.SysError("failed to bind LDAP service account: " + err.Error())
+			return nil, errors.New("LDAP 服务账号认证失败，请联系管理员")
+		}
+	}
+	attributes := []string{config.LdapUsernameAttribute, config.LdapEmailAttribute, config.LdapDisplayNameAttribute}
+	if config.LdapGroupAttribute != "" {
+		attributes = append(attributes, config.LdapGroupAttribute)
+	}
+	filter := strings.ReplaceAll(config.LdapUserFilter, "%s", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(config.LdapBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, filter, attributes, nil))
+	// more than one user matches the filter
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, errors.New("用户名或密码错误，或用户已被封禁")
+	}
+	if err != nil {
+		logger.SysError("failed to search LDAP user: " + err.Error())
+		return nil, errors.New("LDAP 查询失败，请联系管理员")
+	}
+	// the same message for unknown users and wrong passwords, so that the usernames can't be enumerated
+	if len(result.Entries) != 1 {
+		return nil, errors.New("用户名或密码错误，或用户已被封禁")
+	}
+	entry := result.Entries[0]
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			logger.SysError("failed to bind LDAP user: " + err.Error())
+		}
+		return nil, errors.New("用户名或密码错误，或用户已被封禁")
+	}
+	ldapUser := &LdapUser{
+		DN:          entry.DN,
+		Username:    entry.GetEqualFoldAttributeValue(config.LdapUsernameAttribute),
+		Email:       entry.GetEqualFoldAttributeValue(config.LdapEmailAttribute),
+		DisplayName: entry.GetEqualFoldAttributeValue(config.LdapDisplayNameAttribute),
+		Groups:      entry.GetEqualFoldAttributeValues(config.LdapGroupAttribute),
+	}
+	if ldapUser.Username == "" {
+		ldapUser.Username = username
+	}
+	return ldapUser, nil
+}
+
+func LdapLogin(c *gin.Context) {
+	if !config.LdapEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过 LDAP 登录",
+		})
+		return
+	}
+	var loginRequest controller.LoginRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&loginRequest)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	ldapUser, err := getLdapUser(strings.TrimSpace(loginRequest.Username), loginRequest.Password)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	group := mapGroupOrDefault(config.LdapGroupMapping, ldapUser.Groups)
+	user := model.User{
+		LdapId: ldapUser.Username,
+	}
+	if model.IsLdapIdAlreadyTaken(user.LdapId) {
+		err := user.FillUserByLdapId()
+		if err == nil && group != "" && group != user.Group {
+			err = model.UpdateUserGroup(user.Id, group)
+			user.Group = group
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	} else {
+		if config.RegisterEnabled {
+			user.Username = ldapUser.Username
+			if len(user.Username) > 12 || model.IsUsernameAlreadyTaken(user.Username) {
+				user.Username = "ldap_" + strconv.Itoa(model.GetMaxUserId()+1)
+			}
+			if ldapUser.DisplayName != "" {
+				user.DisplayName = ldapUser.DisplayName
+			} else {
+				user.DisplayName = "LDAP User"
+			}
+			user.Email = ldapUser.Email
+			user.Role = model.RoleCommonUser
+			user.Status = model.UserStatusEnabled
+			user.Group = group
+			if err := user.Insert(0); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		} else {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "管理员关闭了新用户注册",
+			})
+			return
+		}
+	}
+
+	if user.Status != model.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	controller.SetupLogin(&user, c)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapGroup(t *testing.T) {
+	mapping := `{"cn=paid,ou=groups,dc=example,dc=org": "vip", "Staff": "svip", "unknown": "no-such-group"}`
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{"by dn", []string{"cn=paid,ou=groups,dc=example,dc=org"}, "vip"},
+		{"by cn", []string{"CN=staff,OU=groups,DC=example,DC=org"}, "svip"},
+		{"first match wins", []string{"cn=other", "cn=staff,dc=org", "cn=paid,ou=groups,dc=example,dc=org"}, "svip"},
+		{"group does not exist", []string{"cn=unknown"}, ""},
+		{"no match", []string{"cn=other"}, ""},
+		{"no groups", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mapGroup(mapping, tt.groups))
+		})
+	}
+	assert.Equal(t, "", mapGroup("", []string{"cn=staff"}))
+}
+
+func TestGetLdapTLSConfig(t *testing.T) {
+	defer func() {
+		config.LdapTLSCACert = ""
+		config.LdapTLSSkipVerifyEnabled = false
+	}()
+	tlsConfig, err := getLdapTLSConfig("ldaps://ldap.example.org:636")
+	require.NoError(t, err)
+	assert.Equal(t, "ldap.example.org", tlsConfig.ServerName)
+	assert.Nil(t, tlsConfig.RootCAs)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+
+	config.LdapTLSSkipVerifyEnabled = true
+	config.LdapTLSCACert = "not a certificate"
+	_, err = getLdapTLSConfig("ldap://ldap.example.org")
+	assert.Error(t, err)
+	config.LdapTLSCACert = ""
+	tlsConfig, err = getLdapTLSConfig("ldap://ldap.example.org")
+	require.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+func parseMapping(mappingJSON string) map[string]string {
+	mapping := make(map[string]string)
+	err := json.Unmarshal([]byte(mappingJSON), &mapping)
+	if err != nil {
+		logger.SysError("failed to parse mapping: " + err.Error())
+		return nil
+	}
+	lowerMapping := make(map[string]string)
+	for k, v := range mapping {
+		lowerMapping[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	return lowerMapping
+}
+
+// groupCandidates returns the keys to look up for a group, a directory group DN also matches by its CN
+func groupCandidates(group string) []string {
+	group = strings.ToLower(strings.TrimSpace(group))
+	candidates := []string{group}
+	if strings.HasPrefix(group, "cn=") {
+		candidates = append(candidates, strings.TrimPrefix(strings.SplitN(group, ",", 2)[0], "cn="))
+	}
+	return candidates
+}
+
+// mapGroup returns the one-api group of the first group found in the JSON mapping,
+// the directory groups can be given by DN or by CN, empty if none matches
+func mapGroup(mappingJSON string, groups []string) string {
+	if mappingJSON == "" || len(groups) == 0 {
+		return ""
+	}
+	mapping := parseMapping(mappingJSON)
+	for _, group := range groups {
+		for _, candidate := range groupCandidates(group) {
+			mapped, ok := mapping[candidate]
+			if !ok {
+				continue
+			}
+			if _, ok = billingratio.GroupRatio[mapped]; !ok {
+				logger.SysError(fmt.Sprintf("group %s mapped from %s does not exist", mapped, group))
+				continue
+			}
+			return mapped
+		}
+	}
+	return ""
+}
+
+// mapGroupOrDefault is like mapGroup, but the identity provider is the source of truth of the group
+// once the mapping is configured, so the users in no mapped group fall back to the default group
+func mapGroupOrDefault(mappingJSON string, groups []string) string {
+	group := mapGroup(mappingJSON, groups)
+	if group == "" && mappingJSON != "" {
+		group = "default"
+	}
+	return group
+}
+
+// mapRole returns the highest role mapped from the values, the common user role if none matches,
+// the root role can't be granted by mapping. ok is false if the mapping is not configured.
+func mapRole(mappingJSON string, values []string) (role int, ok bool) {
+	if mappingJSON == "" {
+		return 0, false
+	}
+	mapping := parseMapping(mappingJSON)
+	if mapping == nil {
+		return 0, false
+	}
+	role = model.RoleCommonUser
+	for _, value := range values {
+		for _, candidate := range groupCandidates(value) {
+			if mapping[candidate] == "admin" {
+				role = model.RoleAdminUser
+			}
+		}
+	}
+	return role, true
+}
+
+// getClaimValues returns the string values of the claim, the path can be nested like realm_access.roles
+func getClaimValues(claims map[string]any, path string) []string {
+	if path == "" {
+		return nil
+	}
+	var current any = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	switch value := current.(type) {
+	case string:
+		// some providers return a space or comma separated string
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' })
+	case []any:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,8 +12,10 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/model"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -31,6 +34,26 @@ type OidcUser struct {
 	Name              string `json:"name"`
 	PreferredUsername string `json:"preferred_username"`
 	Picture           string `json:"picture"`
+	// Claims are all the claims of the userinfo and the ID token, used by the group and role mapping
+	Claims map[string]any `json:"-"`
+}
+
+// parseIdTokenClaims decodes the payload of the ID token without verifying the signature,
+// it's fine as the token is received from the token endpoint directly over TLS
+func parseIdTokenClaims(idToken string) map[string]any {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	claims := make(map[string]any)
+	if json.Unmarshal(payload, &claims) != nil {
+		return nil
+	}
+	return claims
 }
 
 func getOidcUserInfoByCode(code string) (*OidcUser, error) {
@@ -78,11 +101,26 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 		logger.SysLog(err.Error())
 		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
 	}
+	defer res2.Body.Close()
+	body, err := io.ReadAll(res2.Body)
+	if err != nil {
+		return nil, err
+	}
 	var oidcUser OidcUser
-	err = json.NewDecoder(res2.Body).Decode(&oidcUser)
+	err = json.Unmarshal(body, &oidcUser)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &oidcUser.Claims)
 	if err != nil {
 		return nil, err
 	}
+	// the userinfo takes precedence, some providers put the groups in the ID token only
+	for k, v := range parseIdTokenClaims(oidcResponse.IDToken) {
+		if _, ok := oidcUser.Claims[k]; !ok {
+			oidcUser.Claims[k] = v
+		}
+	}
 	return &oidcUser, nil
 }
 
@@ -117,11 +155,15 @@ func OidcAuth(c *gin.Context) {
 		})
 		return
 	}
+	group, role, roleMapped := mapOidcGroupAndRole(oidcUser.Claims)
 	user := model.User{
 		OidcId: oidcUser.OpenID,
 	}
 	if model.IsOidcIdAlreadyTaken(user.OidcId) {
 		err := user.FillUserByOidcId()
+		if err == nil {
+			err = syncOidcGroupAndRole(&user, group, role, roleMapped)
+		}
 		if err != nil {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
@@ -142,6 +184,10 @@ func OidcAuth(c *gin.Context) {
 			} else {
 				user.DisplayName = "OIDC User"
 			}
+			user.Group = group
+			if roleMapped {
+				user.Role = role
+			}
 			err := user.Insert(0)
 			if err != nil {
 				c.JSON(http.StatusOK, gin.H{
@@ -169,6 +215,36 @@ func OidcAuth(c *gin.Context) {
 	controller.SetupLogin(&user, c)
 }
 
+// mapOidcGroupAndRole maps the claims by the configured mappings, the users matching no mapping
+// fall back to the default group and the common user role, roleMapped is false if the role mapping is not configured
+func mapOidcGroupAndRole(claims map[string]any) (group string, role int, roleMapped bool) {
+	group = mapGroupOrDefault(config.OidcGroupMapping, getClaimValues(claims, config.OidcGroupClaim))
+	role, roleMapped = mapRole(config.OidcRoleMapping, getClaimValues(claims, config.OidcRoleClaim))
+	return group, role, roleMapped
+}
+
+// syncOidcGroupAndRole re-evaluates the group and role of an existing user on every login,
+// the group is kept if the group mapping is not configured, the root user is never changed
+func syncOidcGroupAndRole(user *model.User, group string, role int, roleMapped bool) error {
+	if user.Role == model.RoleRootUser {
+		return nil
+	}
+	if group != "" && group != user.Group {
+		if err := model.UpdateUserGroup(user.Id, group); err != nil {
+			return err
+		}
+		user.Group = group
+	}
+	if roleMapped && role != user.Role {
+		if err := model.UpdateUserRole(user.Id, role); err != nil {
+			return err
+		}
+		logger.SysLog(fmt.Sprintf("role of user %d is changed from %d to %d by OIDC role mapping", user.Id, user.Role, role))
+		user.Role = role
+	}
+	return nil
+}
+
 func OidcBind(c *gin.Context) {
 	if !config.OidcEnabled {
 		c.JSON(http.StatusOK, gin.H{
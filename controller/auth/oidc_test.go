@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncOidcGroupAndRole(t *testing.T) {
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+		config.OidcGroupClaim, config.OidcGroupMapping = "", ""
+		config.OidcRoleClaim, config.OidcRoleMapping = "", ""
+	})
+	config.OidcGroupClaim, config.OidcGroupMapping = "groups", `{"paid": "vip"}`
+	config.OidcRoleClaim, config.OidcRoleMapping = "realm_access.roles", `{"oneapi-admin": "admin"}`
+
+	tests := []struct {
+		name      string
+		role      int
+		group     string
+		claims    map[string]any
+		wantRole  int
+		wantGroup string
+	}{
+		{
+			"mapped", model.RoleCommonUser, "default",
+			map[string]any{"groups": []any{"paid"}, "realm_access": map[string]any{"roles": []any{"oneapi-admin"}}},
+			model.RoleAdminUser, "vip",
+		},
+		{
+			"removed from the mapped group and role", model.RoleAdminUser, "vip",
+			map[string]any{"groups": []any{"other"}, "realm_access": map[string]any{"roles": []any{"other"}}},
+			model.RoleCommonUser, "default",
+		},
+		{
+			"no claims", model.RoleAdminUser, "vip",
+			map[string]any{},
+			model.RoleCommonUser, "default",
+		},
+		{
+			"root is never changed", model.RoleRootUser, "vip",
+			map[string]any{},
+			model.RoleRootUser, "vip",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &model.User{
+				Username: "oidc-" + string(rune('a'+i)), Password: "12345678", Role: tt.role, Group: tt.group,
+				Status: model.UserStatusEnabled, AccessToken: tt.name, AffCode: tt.name,
+			}
+			require.NoError(t, model.DB.Create(user).Error)
+			group, role, roleMapped := mapOidcGroupAndRole(tt.claims)
+			require.NoError(t, syncOidcGroupAndRole(user, group, role, roleMapped))
+			stored, err := model.GetUserById(user.Id, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRole, stored.Role)
+			assert.Equal(t, tt.wantGroup, stored.Group)
+		})
+	}
+
+	// the group and role are kept if the mappings are not configured
+	config.OidcGroupMapping, config.OidcRoleMapping = "", ""
+	group, _, roleMapped := mapOidcGroupAndRole(map[string]any{"groups": []any{"paid"}})
+	assert.Equal(t, "", group)
+	assert.False(t, roleMapped)
+}
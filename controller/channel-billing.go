@@ -112,6 +112,24 @@ type DeepSeekUsageResponse struct {
 	} `json:"balance_infos"`
 }
 
+type OpenRouterCreditsResponse struct {
+	Data struct {
+		TotalCredits float64 `json:"total_credits"`
+		TotalUsage   float64 `json:"total_usage"`
+	} `json:"data"`
+}
+
+type MoonshotBalanceResponse struct {
+	Code   int    `json:"code"`
+	Status bool   `json:"status"`
+	Scode  string `json:"scode"`
+	Data   struct {
+		AvailableBalance float64 `json:"available_balance"`
+		VoucherBalance   float64 `json:"voucher_balance"`
+		CashBalance      float64 `json:"cash_balance"`
+	} `json:"data"`
+}
+
 // GetAuthHeader get auth header
 func GetAuthHeader(token string) http.Header {
 	h := http.Header{}
@@ -127,11 +145,18 @@ func GetResponseBody(method, url string, channel *model.Channel, headers http.He
 	for k := range headers {
 		req.Header.Add(k, headers.Get(k))
 	}
-	res, err := client.HTTPClient.Do(req)
+	// the balance is fetched through the proxy of the channel as well
+	cfg, _ := channel.LoadConfig()
+	httpClient, err := client.GetHTTPClient(cfg.ClientOptions())
+	if err != nil {
+		return nil, err
+	}
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
 		return nil, fmt.Errorf("status code: %d", res.StatusCode)
 	}
 	body, err := io.ReadAll(res.Body)
@@ -285,6 +310,40 @@ func updateChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
 	return balance, nil
 }
 
+func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/v1/credits", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := OpenRouterCreditsResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+	balance := response.Data.TotalCredits - response.Data.TotalUsage
+	channel.UpdateBalance(balance)
+	return balance, nil
+}
+
+func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/v1/users/me/balance", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := MoonshotBalanceResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.Code != 0 || !response.Status {
+		return 0, fmt.Errorf("code: %d, scode: %s", response.Code, response.Scode)
+	}
+	channel.UpdateBalance(response.Data.AvailableBalance)
+	return response.Data.AvailableBalance, nil
+}
+
 func updateChannelBalance(channel *model.Channel) (float64, error) {
 	baseURL := channeltype.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
@@ -313,6 +372,10 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 		return updateChannelSiliconFlowBalance(channel)
 	case channeltype.DeepSeek:
 		return updateChannelDeepSeekBalance(channel)
+	case channeltype.OpenRouter:
+		return updateChannelOpenRouterBalance(channel)
+	case channeltype.Moonshot:
+		return updateChannelMoonshotBalance(channel)
 	default:
 		return 0, errors.New("尚未实现")
 	}
@@ -381,27 +444,81 @@ func UpdateChannelBalance(c *gin.Context) {
 	return
 }
 
+// isBalanceSupported reports whether the balance of the channel type can be fetched
+func isBalanceSupported(channelType int) bool {
+	switch channelType {
+	case channeltype.OpenAI, channeltype.Custom, channeltype.CloseAI, channeltype.OpenAISB, channeltype.AIProxy,
+		channeltype.API2GPT, channeltype.AIGC2D, channeltype.SiliconFlow, channeltype.DeepSeek,
+		channeltype.OpenRouter, channeltype.Moonshot:
+		return true
+	}
+	return false
+}
+
+// checkChannelBalance compares the balance with the threshold of the channel, the low balance is handled once
+// when the balance falls below the threshold, and the channel is restored when the balance is sufficient again
+func checkChannelBalance(channel *model.Channel, balance float64) {
+	cfg, _ := channel.LoadConfig()
+	if cfg.BalanceThreshold <= 0 {
+		// err is nil & balance <= 0 means quota is used up
+		if balance <= 0 && (channel.Type == channeltype.OpenAI || channel.Type == channeltype.Custom) {
+			monitor.DisableChannel(channel.Id, channel.Name, "余额不足")
+		}
+		return
+	}
+	var err error
+	if balance < cfg.BalanceThreshold {
+		if channel.LowBalanceTime != 0 {
+			return
+		}
+		switch cfg.LowBalanceAction {
+		case model.LowBalanceActionDisable:
+			if err = channel.MarkLowBalance(nil); err == nil {
+				monitor.DisableChannel(channel.Id, channel.Name, fmt.Sprintf("余额 %.2f 低于阈值 %.2f", balance, cfg.BalanceThreshold))
+			}
+		case model.LowBalanceActionDeprioritize:
+			if err = channel.MarkLowBalance(&cfg.LowBalancePriority); err == nil {
+				monitor.LowBalanceChannel(channel.Id, channel.Name, balance, cfg.BalanceThreshold, fmt.Sprintf("，优先级已调整为 %d", cfg.LowBalancePriority))
+			}
+		default:
+			if err = channel.MarkLowBalance(nil); err == nil {
+				monitor.LowBalanceChannel(channel.Id, channel.Name, balance, cfg.BalanceThreshold, "")
+			}
+		}
+	} else if channel.LowBalanceTime != 0 {
+		if err = channel.ClearLowBalance(); err == nil {
+			if cfg.LowBalanceAction == model.LowBalanceActionDisable && channel.Status == model.ChannelStatusAutoDisabled {
+				monitor.EnableChannel(channel.Id, channel.Name)
+			} else {
+				monitor.BalanceRecoveredChannel(channel.Id, channel.Name, balance)
+			}
+		}
+	}
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to update low balance state of channel #%d: %s", channel.Id, err.Error()))
+	}
+}
+
 func updateAllChannelsBalance() error {
 	channels, err := model.GetAllChannels(0, 0, "all")
 	if err != nil {
 		return err
 	}
 	for _, channel := range channels {
-		if channel.Status != model.ChannelStatusEnabled {
+		// the channels disabled for low balance are checked to be enabled again
+		lowBalanceDisabled := channel.Status == model.ChannelStatusAutoDisabled && channel.LowBalanceTime != 0
+		if channel.Status != model.ChannelStatusEnabled && !lowBalanceDisabled {
 			continue
 		}
 		// TODO: support Azure
-		if channel.Type != channeltype.OpenAI && channel.Type != channeltype.Custom {
+		if !isBalanceSupported(channel.Type) {
 			continue
 		}
 		balance, err := updateChannelBalance(channel)
 		if err != nil {
-			continue
+			logger.SysError(fmt.Sprintf("failed to update balance of channel #%d: %s", channel.Id, err.Error()))
 		} else {
-			// err is nil & balance <= 0 means quota is used up
-			if balance <= 0 {
-				monitor.DisableChannel(channel.Id, channel.Name, "余额不足")
-			}
+			checkChannelBalance(channel, balance)
 		}
 		time.Sleep(config.RequestInterval)
 	}
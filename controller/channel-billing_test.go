@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureNotifications makes the root user notified by the message pusher, it returns the sent subjects
+func captureNotifications(t *testing.T) func() []string {
+	var lock sync.Mutex
+	var subjects []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Title string `json:"title"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		lock.Lock()
+		subjects = append(subjects, message.Title)
+		lock.Unlock()
+		_, _ = fmt.Fprint(w, `{"success":true}`)
+	}))
+	config.MessagePusherAddress = server.URL
+	t.Cleanup(func() {
+		config.MessagePusherAddress = ""
+		server.Close()
+	})
+	return func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		sent := subjects
+		subjects = nil
+		return sent
+	}
+}
+
+func TestCheckChannelBalance(t *testing.T) {
+	setupTestDB(t)
+	notifications := captureNotifications(t)
+	tests := []struct {
+		name            string
+		action          string
+		lowStatus       int
+		lowPriority     int64
+		lowSubject      string
+		restoredSubject string
+	}{
+		{"notify", model.LowBalanceActionNotify, model.ChannelStatusEnabled, 10, "余额不足", "余额已恢复"},
+		{"disable", model.LowBalanceActionDisable, model.ChannelStatusAutoDisabled, 10, "已被禁用", "已被启用"},
+		{"deprioritize", model.LowBalanceActionDeprioritize, model.ChannelStatusEnabled, -1, "余额不足", "余额已恢复"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priority := int64(10)
+			channel := &model.Channel{
+				Type: 1, Name: tt.name, Key: "sk-" + tt.name, Models: "gpt-4o", Group: "default", Priority: &priority,
+				Status: model.ChannelStatusEnabled,
+				Config: fmt.Sprintf(`{"balance_threshold":5,"low_balance_action":"%s","low_balance_priority":-1}`, tt.action),
+			}
+			require.NoError(t, channel.Insert())
+			load := func() *model.Channel {
+				loaded, err := model.GetChannelById(channel.Id, true)
+				require.NoError(t, err)
+				return loaded
+			}
+
+			checkChannelBalance(load(), 1)
+			low := load()
+			assert.NotZero(t, low.LowBalanceTime)
+			assert.Equal(t, tt.lowStatus, low.Status)
+			assert.Equal(t, tt.lowPriority, low.GetPriority())
+			sent := notifications()
+			require.Len(t, sent, 1)
+			assert.Contains(t, sent[0], tt.lowSubject)
+
+			// the low balance is handled once
+			checkChannelBalance(low, 1)
+			assert.Empty(t, notifications())
+
+			checkChannelBalance(load(), 10)
+			restored := load()
+			assert.Zero(t, restored.LowBalanceTime)
+			assert.Equal(t, model.ChannelStatusEnabled, restored.Status)
+			assert.EqualValues(t, 10, restored.GetPriority())
+			sent = notifications()
+			require.Len(t, sent, 1)
+			assert.Contains(t, sent[0], tt.restoredSubject)
+
+			// nothing happens while the balance is sufficient
+			checkChannelBalance(restored, 10)
+			assert.Empty(t, notifications())
+		})
+	}
+}
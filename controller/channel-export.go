@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the passphrase is passed in header, so that it won't be written into the access logs
+const channelExportPassphraseHeader = "X-Passphrase"
+
+func ExportChannels(c *gin.Context) {
+	export, err := model.ExportChannels(c.GetHeader(channelExportPassphraseHeader))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=one-api-channels-%d.json", helper.GetTimestamp()))
+	c.JSON(http.StatusOK, export)
+}
+
+// ImportChannels accepts the exported file as request body,
+// query parameters: conflict (skip, overwrite or duplicate), dry_run
+func ImportChannels(c *gin.Context) {
+	// the request contains the keys of all the channels, only the import result is audited
+	c.Set(ctxkey.AuditResult, nil)
+	export := model.ChannelExport{}
+	err := c.ShouldBindJSON(&export)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	result, err := model.ImportChannels(&export, c.GetHeader(channelExportPassphraseHeader), c.Query("conflict"), c.Query("dry_run") == "true")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Set(ctxkey.AuditResult, result)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    result,
+	})
+}
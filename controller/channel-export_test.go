@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportChannelsAudit(t *testing.T) {
+	setupTestDB(t)
+	root := createTestUser(t, "root-test", model.RoleRootUser, 0)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/channel/import", func(c *gin.Context) {
+		c.Set(ctxkey.Id, root.Id)
+		c.Next()
+	}, middleware.Audit(model.AuditTargetChannel), ImportChannels)
+	doImport := func(channels ...*model.Channel) {
+		data, err := json.Marshal(model.ChannelExport{Version: 1, Channels: channels})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/channel/import", bytes.NewReader(data)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	doImport(&model.Channel{Type: 1, Name: "openai", Key: "sk-imported", Models: "gpt-4o", Group: "default"})
+	// the failed import doesn't record the request either
+	doImport(&model.Channel{Type: 1, Name: "broken", Key: "sk-broken"}, &model.Channel{Type: 1, Name: "nokey"})
+
+	auditLogs, err := model.GetAuditLogs(0, model.AuditTargetChannel, "", "import", 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, auditLogs, 2)
+	failed, imported := auditLogs[0], auditLogs[1]
+
+	assert.True(t, imported.Success)
+	assert.NotContains(t, imported.Diff, "sk-imported")
+	var diff map[string]*model.AuditChange
+	require.NoError(t, json.Unmarshal([]byte(imported.Diff), &diff))
+	assert.NotContains(t, diff, "channels")
+	require.Contains(t, diff, "items")
+	assert.Equal(t, []any{map[string]any{"name": "openai", "action": "create"}}, diff["items"].After)
+	assert.EqualValues(t, 1, diff["created"].After)
+
+	assert.False(t, failed.Success)
+	assert.NotContains(t, failed.Diff, "sk-broken")
+	assert.Equal(t, "{}", failed.Diff)
+}
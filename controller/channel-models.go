@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+type OpenAIModelsResponse struct {
+	Data []struct {
+		Id string `json:"id"`
+	} `json:"data"`
+}
+
+type AnthropicModelsResponse struct {
+	Data []struct {
+		Id string `json:"id"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastId  string `json:"last_id"`
+}
+
+type GeminiModelsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+type OllamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+func fetchOpenAIModels(channel *model.Channel, baseURL string) ([]string, error) {
+	body, err := GetResponseBody("GET", openai.GetFullRequestURL(baseURL, "/v1/models", channel.Type), channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := OpenAIModelsResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, item := range response.Data {
+		models = append(models, item.Id)
+	}
+	return models, nil
+}
+
+func fetchAnthropicModels(channel *model.Channel, baseURL string) ([]string, error) {
+	headers := http.Header{}
+	headers.Set("x-api-key", channel.Key)
+	headers.Set("anthropic-version", "2023-06-01")
+	var models []string
+	afterId := ""
+	for {
+		requestURL := fmt.Sprintf("%s/v1/models?limit=1000", baseURL)
+		if afterId != "" {
+			requestURL += "&after_id=" + url.QueryEscape(afterId)
+		}
+		body, err := GetResponseBody("GET", requestURL, channel, headers)
+		if err != nil {
+			return nil, err
+		}
+		response := AnthropicModelsResponse{}
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range response.Data {
+			models = append(models, item.Id)
+		}
+		if !response.HasMore || response.LastId == "" {
+			return models, nil
+		}
+		afterId = response.LastId
+	}
+}
+
+func fetchGeminiModels(channel *model.Channel, baseURL string) ([]string, error) {
+	cfg, _ := channel.LoadConfig()
+	version := helper.AssignOrDefault(cfg.APIVersion, config.GeminiVersion)
+	var models []string
+	pageToken := ""
+	// the key is sent in the header, so that it doesn't leak through the errors which contain the URL
+	headers := http.Header{}
+	headers.Set("x-goog-api-key", channel.Key)
+	for {
+		requestURL := fmt.Sprintf("%s/%s/models?pageSize=1000", baseURL, version)
+		if pageToken != "" {
+			requestURL += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		body, err := GetResponseBody("GET", requestURL, channel, headers)
+		if err != nil {
+			return nil, err
+		}
+		response := GeminiModelsResponse{}
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range response.Models {
+			models = append(models, strings.TrimPrefix(item.Name, "models/"))
+		}
+		if response.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = response.NextPageToken
+	}
+}
+
+func fetchOllamaModels(channel *model.Channel, baseURL string) ([]string, error) {
+	body, err := GetResponseBody("GET", fmt.Sprintf("%s/api/tags", baseURL), channel, nil)
+	if err != nil {
+		return nil, err
+	}
+	response := OllamaTagsResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, item := range response.Models {
+		models = append(models, item.Name)
+	}
+	return models, nil
+}
+
+// fetchChannelModels lists the models with the model-listing API of the provider, the result is sorted and deduplicated
+func fetchChannelModels(channel *model.Channel) ([]string, error) {
+	baseURL := strings.TrimSuffix(channel.GetBaseURL(), "/")
+	if baseURL == "" && channel.Type >= 0 && channel.Type < len(channeltype.ChannelBaseURLs) {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	var models []string
+	var err error
+	switch channel.Type {
+	case channeltype.Anthropic:
+		models, err = fetchAnthropicModels(channel, baseURL)
+	case channeltype.Gemini:
+		models, err = fetchGeminiModels(channel, baseURL)
+	case channeltype.Ollama:
+		models, err = fetchOllamaModels(channel, baseURL)
+	case channeltype.Azure, channeltype.Minimax, channeltype.Doubao, channeltype.Novita:
+		// the deployments or the endpoints are not listed by a /v1/models compatible API
+		return nil, errors.New("该渠道类型不支持获取模型列表")
+	default:
+		if channeltype.ToAPIType(channel.Type) != apitype.OpenAI || baseURL == "" {
+			return nil, errors.New("该渠道类型不支持获取模型列表")
+		}
+		models, err = fetchOpenAIModels(channel, baseURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(models))
+	for _, modelName := range models {
+		if modelName != "" && !seen[modelName] {
+			seen[modelName] = true
+			result = append(result, modelName)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// FetchChannelModels fetches the models of a saved channel, or of the channel in the request body which is not saved yet
+func FetchChannelModels(c *gin.Context) {
+	channel := &model.Channel{}
+	var err error
+	if c.Request.Method == http.MethodPost {
+		err = c.ShouldBindJSON(channel)
+		if err == nil && channel.Key == "" && channel.Id != 0 {
+			// the key is not sent back to the page, so the saved one is used when editing a channel,
+			// but only to the saved upstream, otherwise the key could be sent to any address
+			var saved *model.Channel
+			saved, err = model.GetChannelById(channel.Id, true)
+			if err == nil && (saved.Type != channel.Type || strings.TrimSuffix(saved.GetBaseURL(), "/") != strings.TrimSuffix(channel.GetBaseURL(), "/")) {
+				err = errors.New("修改渠道类型或代理地址后，请重新填写渠道密钥")
+			}
+			if err == nil {
+				channel.Key = saved.Key
+			}
+		}
+	} else {
+		var id int
+		id, err = strconv.Atoi(c.Query("id"))
+		if err == nil {
+			channel, err = model.GetChannelById(id, true)
+		}
+	}
+	if err == nil && channel.Key == "" {
+		err = errors.New("渠道密钥不能为空")
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	models, err := fetchChannelModels(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("获取模型列表失败：%s", err.Error()),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    models,
+	})
+}
+
+// diffChannelModels compares the models of the channel with the upstream ones, a model redirected by the model
+// mapping is compared by its target
+func diffChannelModels(channel *model.Channel, upstreamModels []string) (added []string, removed []string) {
+	upstream := make(map[string]bool)
+	for _, modelName := range upstreamModels {
+		upstream[modelName] = true
+	}
+	modelMapping := channel.GetModelMapping()
+	served := make(map[string]bool)
+	for _, modelName := range strings.Split(channel.Models, ",") {
+		if modelName == "" {
+			continue
+		}
+		actualModelName, _ := modelMapping.Map(modelName)
+		served[actualModelName] = true
+		if !upstream[actualModelName] {
+			removed = append(removed, modelName)
+		}
+	}
+	for _, modelName := range upstreamModels {
+		if !served[modelName] {
+			added = append(added, modelName)
+		}
+	}
+	return added, removed
+}
+
+// lastChannelModelDiffs avoids reporting the same difference on every sync
+var lastChannelModelDiffs sync.Map
+
+func syncAllChannelsModels() {
+	channels, err := model.GetAllChannels(0, 0, "all")
+	if err != nil {
+		logger.SysError("failed to get channels: " + err.Error())
+		return
+	}
+	for _, channel := range channels {
+		if channel.Status != model.ChannelStatusEnabled {
+			continue
+		}
+		upstreamModels, err := fetchChannelModels(channel)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to fetch models of channel #%d: %s", channel.Id, err.Error()))
+			continue
+		}
+		added, removed := diffChannelModels(channel, upstreamModels)
+		diff := fmt.Sprintf("新增模型：%s\n移除模型：%s", strings.Join(added, ", "), strings.Join(removed, ", "))
+		if last, ok := lastChannelModelDiffs.Load(channel.Id); (ok && last == diff) || (!ok && len(added) == 0 && len(removed) == 0) {
+			time.Sleep(config.RequestInterval)
+			continue
+		}
+		lastChannelModelDiffs.Store(channel.Id, diff)
+		if len(added) != 0 || len(removed) != 0 {
+			logger.SysLog(fmt.Sprintf("models of channel #%d changed, added: %v, removed: %v", channel.Id, added, removed))
+			err = message.Notify(message.ByAll, fmt.Sprintf("渠道 %s （%d）的上游模型发生变化", channel.Name, channel.Id), "", diff)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to send notification: %s", err.Error()))
+			}
+		}
+		time.Sleep(config.RequestInterval)
+	}
+}
+
+func AutomaticallySyncChannelModels(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		logger.SysLog("syncing models of all channels")
+		syncAllChannelsModels()
+		logger.SysLog("channel models sync finished")
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchGeminiModelsSendsKeyInHeader(t *testing.T) {
+	client.Init()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.URL.Query().Get("key"))
+		if r.Header.Get("x-goog-api-key") != "gemini-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = fmt.Fprint(w, `{"models":[{"name":"models/gemini-pro"}],"nextPageToken":"next"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"models":[{"name":"models/gemini-1.5-pro"}]}`)
+	}))
+	defer server.Close()
+
+	channel := &model.Channel{Key: "gemini-key"}
+	models, err := fetchGeminiModels(channel, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gemini-pro", "gemini-1.5-pro"}, models)
+
+	channel.Key = "wrong-key"
+	_, err = fetchGeminiModels(channel, server.URL)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "wrong-key")
+}
+
+func TestFetchChannelModelsReusesSavedKey(t *testing.T) {
+	setupTestDB(t)
+	client.Init()
+	root := createTestUser(t, "root-test", model.RoleRootUser, 0)
+	newServer := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer sk-saved" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"data":[{"id":"%s"}]}`, name)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	saved, other := newServer("gpt-4o"), newServer("leaked")
+	baseURL := saved.URL
+	channel := &model.Channel{Type: channeltype.OpenAI, Name: "openai", Key: "sk-saved", BaseURL: &baseURL, Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.Insert())
+
+	tests := []struct {
+		name    string
+		typ     int
+		baseURL string
+		want    []any
+	}{
+		{"saved upstream", channeltype.OpenAI, saved.URL + "/", []any{"gpt-4o"}},
+		{"other base url", channeltype.OpenAI, other.URL, nil},
+		{"other type", channeltype.OpenRouter, saved.URL, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := doUserRequest(t, FetchChannelModels, root, http.MethodPost, map[string]any{
+				"id": channel.Id, "type": tt.typ, "base_url": tt.baseURL,
+			})
+			if tt.want == nil {
+				assert.Equal(t, false, response["success"])
+				assert.Equal(t, "修改渠道类型或代理地址后，请重新填写渠道密钥", response["message"])
+				return
+			}
+			require.Equal(t, true, response["success"], response["message"])
+			assert.Equal(t, tt.want, response["data"])
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/message"
 	"github.com/songquanpeng/one-api/middleware"
@@ -27,7 +28,6 @@ import (
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
-	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 func buildTestRequest(model string) *relaymodel.GeneralOpenAIRequest {
@@ -46,12 +46,55 @@ func buildTestRequest(model string) *relaymodel.GeneralOpenAIRequest {
 	return testRequest
 }
 
+// buildModeTestRequest builds the test request of a mode, the embeddings request is told apart by its input
+func buildModeTestRequest(modelName string, mode string) *relaymodel.GeneralOpenAIRequest {
+	switch mode {
+	case model.ChannelTestModeStream:
+		testRequest := buildTestRequest(modelName)
+		testRequest.Stream = true
+		return testRequest
+	case model.ChannelTestModeEmbeddings:
+		return &relaymodel.GeneralOpenAIRequest{
+			Model: modelName,
+			Input: "hi",
+		}
+	case model.ChannelTestModeTools:
+		testRequest := buildTestRequest(modelName)
+		testRequest.MaxTokens = 64
+		testRequest.Messages[0].Content = "What's the weather like in Paris?"
+		testRequest.Tools = []relaymodel.Tool{{
+			Type: "function",
+			Function: relaymodel.Function{
+				Name:        "get_current_weather",
+				Description: "Get the current weather in a given city",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"city": map[string]any{"type": "string"},
+					},
+					"required": []string{"city"},
+				},
+			},
+		}}
+		testRequest.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": "get_current_weather"},
+		}
+		return testRequest
+	}
+	return buildTestRequest(modelName)
+}
+
 func testChannel(channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (err error, openaiErr *relaymodel.Error) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	path := "/v1/chat/completions"
+	if request.Input != nil {
+		path = "/v1/embeddings"
+	}
 	c.Request = &http.Request{
 		Method: "POST",
-		URL:    &url.URL{Path: "/v1/chat/completions"},
+		URL:    &url.URL{Path: path},
 		Body:   nil,
 		Header: make(http.Header),
 	}
@@ -77,12 +120,11 @@ func testChannel(channel *model.Channel, request *relaymodel.GeneralOpenAIReques
 			modelName = modelNames[0]
 		}
 	}
-	if modelMap != nil && modelMap[modelName] != "" {
-		modelName = modelMap[modelName]
-	}
+	modelName, _ = modelMap.Map(modelName)
 	meta.OriginModelName, meta.ActualModelName = request.Model, modelName
+	meta.IsStream = request.Stream
 	request.Model = modelName
-	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, request)
+	convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, request)
 	if err != nil {
 		return err, nil
 	}
@@ -90,6 +132,10 @@ func testChannel(channel *model.Channel, request *relaymodel.GeneralOpenAIReques
 	if err != nil {
 		return err, nil
 	}
+	jsonData, err = meta.Config.ParamOverride.Apply(jsonData)
+	if err != nil {
+		return err, nil
+	}
 	logger.SysLog(string(jsonData))
 	requestBody := bytes.NewBuffer(jsonData)
 	c.Request.Body = io.NopCloser(requestBody)
@@ -115,7 +161,39 @@ func testChannel(channel *model.Channel, request *relaymodel.GeneralOpenAIReques
 		return err, nil
 	}
 	logger.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
-	return nil, nil
+	return checkTestResponse(request, respBody), nil
+}
+
+// checkTestResponse checks the response relayed to the client, a successful status is not enough
+// for the other modes than chat, the response must be in the expected shape
+func checkTestResponse(request *relaymodel.GeneralOpenAIRequest, respBody []byte) error {
+	switch {
+	case request.Stream && !bytes.Contains(respBody, []byte("data: {")):
+		return errors.New("流式响应中没有数据")
+	case request.Input != nil && !bytes.Contains(respBody, []byte(`"embedding"`)):
+		return errors.New("响应中没有 embedding")
+	case len(request.Tools) != 0 && !bytes.Contains(respBody, []byte(`"tool_calls"`)):
+		return errors.New("模型没有调用工具")
+	}
+	return nil
+}
+
+// TestChannelById tests the channel and records its response time, the response time is 0 if the test failed
+func TestChannelById(id int, modelName string) (milliseconds int64, err error) {
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		return 0, err
+	}
+	testRequest := buildTestRequest(modelName)
+	tik := time.Now()
+	err, _ = testChannel(channel, testRequest)
+	tok := time.Now()
+	milliseconds = tok.Sub(tik).Milliseconds()
+	if err != nil {
+		milliseconds = 0
+	}
+	channel.UpdateResponseTime(milliseconds)
+	return milliseconds, err
 }
 
 func TestChannel(c *gin.Context) {
@@ -127,6 +205,132 @@ func TestChannel(c *gin.Context) {
 		})
 		return
 	}
+	model := c.Query("model")
+	milliseconds, err := TestChannelById(id, model)
+	consumedTime := float64(milliseconds) / 1000.0
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"time":    consumedTime,
+			"model":   model,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"time":    consumedTime,
+		"model":   model,
+	})
+	return
+}
+
+var testChannelModelsLock sync.Mutex
+var testChannelModelsRunning = make(map[int]bool)
+
+var nonChatModelKeywords = []string{"dall-e", "tts", "whisper", "moderation", "stable-diffusion", "cogview", "flux", "wanx", "rerank"}
+
+// getModelTestModes returns the modes a model can be tested in, judged by the model name
+func getModelTestModes(modelName string) []string {
+	name := strings.ToLower(modelName)
+	if strings.Contains(name, "embed") {
+		return []string{model.ChannelTestModeEmbeddings}
+	}
+	for _, keyword := range nonChatModelKeywords {
+		if strings.Contains(name, keyword) {
+			return nil
+		}
+	}
+	return []string{model.ChannelTestModeChat, model.ChannelTestModeStream, model.ChannelTestModeTools}
+}
+
+// testChannelModels tests the models of the channel in background, each result is recorded once it's done
+func testChannelModels(channel *model.Channel, models []string, modes []string) (tests int, skipped []string, err error) {
+	type modelTest struct {
+		model string
+		mode  string
+	}
+	var modelTests []modelTest
+	for _, modelName := range models {
+		var tested bool
+		for _, mode := range getModelTestModes(modelName) {
+			if len(modes) == 0 || helper.StringSliceContains(modes, mode) {
+				modelTests = append(modelTests, modelTest{model: modelName, mode: mode})
+				tested = true
+			}
+		}
+		if !tested {
+			skipped = append(skipped, modelName)
+		}
+	}
+	if len(modelTests) == 0 {
+		return 0, skipped, errors.New("没有可以测试的模型")
+	}
+	testChannelModelsLock.Lock()
+	if testChannelModelsRunning[channel.Id] {
+		testChannelModelsLock.Unlock()
+		return 0, nil, errors.New("该渠道的测试已在运行中")
+	}
+	testChannelModelsRunning[channel.Id] = true
+	testChannelModelsLock.Unlock()
+	go func() {
+		defer func() {
+			testChannelModelsLock.Lock()
+			delete(testChannelModelsRunning, channel.Id)
+			testChannelModelsLock.Unlock()
+		}()
+		for i, test := range modelTests {
+			if i != 0 {
+				time.Sleep(config.RequestInterval)
+			}
+			tik := time.Now()
+			err, _ := testChannel(channel, buildModeTestRequest(test.model, test.mode))
+			result := &model.ChannelTestResult{
+				ChannelId: channel.Id,
+				Model:     test.model,
+				Mode:      test.mode,
+				Success:   err == nil,
+				Latency:   time.Since(tik).Milliseconds(),
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			if err = model.RecordChannelTestResult(result); err != nil {
+				logger.SysError(fmt.Sprintf("failed to record test result of channel #%d: %s", channel.Id, err.Error()))
+			}
+		}
+		logger.SysLog(fmt.Sprintf("channel #%d tested with %d model tests", channel.Id, len(modelTests)))
+	}()
+	return len(modelTests), skipped, nil
+}
+
+type testChannelModelsRequest struct {
+	Models []string `json:"models"`
+	Modes  []string `json:"modes"`
+}
+
+// TestChannelModels starts testing all the models of the channel, or the chosen ones, in the chosen modes
+func TestChannelModels(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	req := testChannelModelsRequest{}
+	if c.Request.ContentLength != 0 {
+		err = c.ShouldBindJSON(&req)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的参数",
+			})
+			return
+		}
+	}
 	channel, err := model.GetChannelById(id, true)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -135,33 +339,76 @@ func TestChannel(c *gin.Context) {
 		})
 		return
 	}
-	model := c.Query("model")
-	testRequest := buildTestRequest(model)
-	tik := time.Now()
-	err, _ = testChannel(channel, testRequest)
-	tok := time.Now()
-	milliseconds := tok.Sub(tik).Milliseconds()
+	for _, mode := range req.Modes {
+		if !helper.StringSliceContains(model.ChannelTestModes, mode) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("未知的测试模式：%s", mode),
+			})
+			return
+		}
+	}
+	channelModels := strings.Split(channel.Models, ",")
+	models := req.Models
+	if len(models) == 0 {
+		models = channelModels
+	}
+	for _, modelName := range models {
+		if !helper.StringSliceContains(channelModels, modelName) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("渠道不支持模型 %s", modelName),
+			})
+			return
+		}
+	}
+	tests, skipped, err := testChannelModels(channel, models, req.Modes)
 	if err != nil {
-		milliseconds = 0
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
 	}
-	go channel.UpdateResponseTime(milliseconds)
-	consumedTime := float64(milliseconds) / 1000.0
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"tests":   tests,
+			"skipped": skipped,
+		},
+	})
+}
+
+// GetChannelModelTestResults returns the latest result of each model and mode, and whether a test is running
+func GetChannelModelTestResults(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	results, err := model.GetChannelTestResults(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
-			"time":    consumedTime,
-			"model":   model,
 		})
 		return
 	}
+	testChannelModelsLock.Lock()
+	running := testChannelModelsRunning[id]
+	testChannelModelsLock.Unlock()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"time":    consumedTime,
-		"model":   model,
+		"data": gin.H{
+			"running": running,
+			"results": results,
+		},
 	})
-	return
 }
 
 var testAllChannelsLock sync.Mutex
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetModelTestModes(t *testing.T) {
+	allModes := []string{model.ChannelTestModeChat, model.ChannelTestModeStream, model.ChannelTestModeTools}
+	tests := []struct {
+		model string
+		want  []string
+	}{
+		{"gpt-4o", allModes},
+		{"claude-3-5-sonnet", allModes},
+		{"text-embedding-3-small", []string{model.ChannelTestModeEmbeddings}},
+		{"BAAI/bge-m3-Embedding", []string{model.ChannelTestModeEmbeddings}},
+		{"dall-e-3", nil},
+		{"tts-1", nil},
+		{"whisper-1", nil},
+		{"bge-reranker-v2", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			assert.Equal(t, tt.want, getModelTestModes(tt.model))
+		})
+	}
+}
+
+func TestBuildModeTestRequest(t *testing.T) {
+	tests := []struct {
+		mode      string
+		stream    bool
+		embedding bool
+		tools     bool
+	}{
+		{model.ChannelTestModeChat, false, false, false},
+		{model.ChannelTestModeStream, true, false, false},
+		{model.ChannelTestModeEmbeddings, false, true, false},
+		{model.ChannelTestModeTools, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			request := buildModeTestRequest("gpt-4o", tt.mode)
+			assert.Equal(t, "gpt-4o", request.Model)
+			assert.Equal(t, tt.stream, request.Stream)
+			assert.Equal(t, tt.embedding, request.Input != nil)
+			assert.Equal(t, tt.embedding, len(request.Messages) == 0)
+			assert.Equal(t, tt.tools, len(request.Tools) != 0)
+			assert.Equal(t, tt.tools, request.ToolChoice != nil)
+		})
+	}
+}
+
+const (
+	testChatResponse      = `{"id":"1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+	testToolCallResponse  = `{"id":"1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_current_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+	testStreamResponse    = "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}],\"usage\":{\"prompt_tokens\":1,\"completion_tokens\":1,\"total_tokens\":2}}\n\ndata: [DONE]\n\n"
+	testEmbeddingResponse = `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small","usage":{"prompt_tokens":1,"total_tokens":1}}`
+	testEmptyEmbeddings   = `{"object":"list","data":[],"model":"text-embedding-3-small","usage":{"prompt_tokens":1,"total_tokens":1}}`
+)
+
+func TestCheckTestResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		response string
+		wantErr  string
+	}{
+		{"chat", model.ChannelTestModeChat, testChatResponse, ""},
+		{"stream", model.ChannelTestModeStream, testStreamResponse, ""},
+		{"stream without data", model.ChannelTestModeStream, "data: [DONE]\n\n", "流式响应中没有数据"},
+		{"embeddings", model.ChannelTestModeEmbeddings, testEmbeddingResponse, ""},
+		{"embeddings without embedding", model.ChannelTestModeEmbeddings, testEmptyEmbeddings, "响应中没有 embedding"},
+		{"tools", model.ChannelTestModeTools, testToolCallResponse, ""},
+		{"tools not called", model.ChannelTestModeTools, testChatResponse, "模型没有调用工具"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTestResponse(buildModeTestRequest("gpt-4o", tt.mode), []byte(tt.response))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// the upstream responses are relayed to the checks, the tokens are not counted as the usage is returned
+func TestTestChannelResponseShape(t *testing.T) {
+	client.Init()
+	tests := []struct {
+		name     string
+		model    string
+		mode     string
+		response string
+		wantErr  string
+	}{
+		{"chat", "gpt-4o", model.ChannelTestModeChat, testChatResponse, ""},
+		{"stream", "gpt-4o", model.ChannelTestModeStream, testStreamResponse, ""},
+		{"tools", "gpt-4o", model.ChannelTestModeTools, testToolCallResponse, ""},
+		{"tools not called", "gpt-4o", model.ChannelTestModeTools, testChatResponse, "模型没有调用工具"},
+		{"embeddings", "text-embedding-3-small", model.ChannelTestModeEmbeddings, testEmbeddingResponse, ""},
+		{"embeddings without embedding", "text-embedding-3-small", model.ChannelTestModeEmbeddings, testEmptyEmbeddings, "响应中没有 embedding"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.mode == model.ChannelTestModeStream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				} else {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				_, _ = fmt.Fprint(w, tt.response)
+			}))
+			defer server.Close()
+			baseURL := server.URL
+			channel := &model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Models: tt.model, BaseURL: &baseURL}
+			err, _ := testChannel(channel, buildModeTestRequest(tt.model, tt.mode))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
+
+func TestTestChannelModelsGuards(t *testing.T) {
+	channel := &model.Channel{Id: 100, Models: "dall-e-3,gpt-4o"}
+
+	_, skipped, err := testChannelModels(channel, []string{"dall-e-3"}, nil)
+	assert.EqualError(t, err, "没有可以测试的模型")
+	assert.Equal(t, []string{"dall-e-3"}, skipped)
+
+	// the modes not supported by the model are not tested
+	_, _, err = testChannelModels(channel, []string{"gpt-4o"}, []string{model.ChannelTestModeEmbeddings})
+	assert.EqualError(t, err, "没有可以测试的模型")
+
+	testChannelModelsLock.Lock()
+	testChannelModelsRunning[channel.Id] = true
+	testChannelModelsLock.Unlock()
+	defer func() {
+		testChannelModelsLock.Lock()
+		delete(testChannelModelsRunning, channel.Id)
+		testChannelModelsLock.Unlock()
+	}()
+	tests, _, err := testChannelModels(channel, []string{"gpt-4o"}, nil)
+	assert.EqualError(t, err, "该渠道的测试已在运行中")
+	assert.Zero(t, tests)
+}
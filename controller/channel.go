@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
@@ -74,6 +77,47 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// validateChannelConfig checks the config and the model mapping saved from the page, malformed ones would be silently
+// ignored when relaying
+func validateChannelConfig(channel *model.Channel) error {
+	if channel.ModelMapping != nil && *channel.ModelMapping != "" {
+		if _, err := model.ParseModelMapping(*channel.ModelMapping); err != nil {
+			return errors.New("模型映射格式错误：" + err.Error())
+		}
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return errors.New("渠道配置格式错误：" + err.Error())
+	}
+	switch cfg.LowBalanceAction {
+	case model.LowBalanceActionNotify, model.LowBalanceActionDisable, model.LowBalanceActionDeprioritize:
+	default:
+		return fmt.Errorf("未知的余额不足处理方式：%s", cfg.LowBalanceAction)
+	}
+	if cfg.BalanceThreshold < 0 {
+		return errors.New("余额阈值不能为负数")
+	}
+	if cfg.ParamOverride != nil {
+		for path, paramRange := range cfg.ParamOverride.Clamp {
+			if paramRange.Min != nil && paramRange.Max != nil && *paramRange.Min > *paramRange.Max {
+				return fmt.Errorf("参数 %s 的最小值不能大于最大值", path)
+			}
+		}
+	}
+	if cfg.ConnectTimeout < 0 || cfg.ResponseHeaderTimeout < 0 || cfg.Timeout < 0 {
+		return errors.New("超时时间不能为负数")
+	}
+	if err = client.ValidateOptions(cfg.ClientOptions()); err != nil {
+		return errors.New("代理或 TLS 设置无效：" + err.Error())
+	}
+	for key := range cfg.Headers {
+		if key == "" || strings.ContainsAny(key, " :\r\n") {
+			return fmt.Errorf("无效的请求头：%s", key)
+		}
+	}
+	return nil
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -84,6 +128,20 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if model.IsChannelManaged(channel.Name) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": model.ErrManagedByConfigFile.Error(),
+		})
+		return
+	}
+	if err = validateChannelConfig(&channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	channel.CreatedTime = helper.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
 	channels := make([]model.Channel, 0, len(keys))
@@ -112,6 +170,13 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if isChannelManaged(id) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": model.ErrManagedByConfigFile.Error(),
+		})
+		return
+	}
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -155,6 +220,20 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if isChannelManaged(channel.Id) || model.IsChannelManaged(channel.Name) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": model.ErrManagedByConfigFile.Error(),
+		})
+		return
+	}
+	if err = validateChannelConfig(&channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -170,3 +249,12 @@ func UpdateChannel(c *gin.Context) {
 	})
 	return
 }
+
+// isChannelManaged checks the name in database, because it may be changed in the request
+func isChannelManaged(id int) bool {
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		return false
+	}
+	return model.IsChannelManaged(channel.Name)
+}
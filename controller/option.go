@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/filter"
+	"github.com/songquanpeng/one-api/relay/hook"
 	"net/http"
 	"strings"
 
@@ -42,6 +45,13 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	if model.IsOptionManaged(option.Key) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": model.ErrManagedByConfigFile.Error(),
+		})
+		return
+	}
 	switch option.Key {
 	case "Theme":
 		if !config.ValidThemes[option.Value] {
@@ -83,6 +93,68 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "LdapEnabled":
+		if option.Value == "true" && (config.LdapServerURL == "" || config.LdapBaseDN == "") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用 LDAP 登录，请先填入 LDAP 服务器地址以及 Base DN！",
+			})
+			return
+		}
+	case "LdapTLSCACert":
+		if option.Value != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(option.Value)) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "CA 证书不是合法的 PEM 格式",
+			})
+			return
+		}
+	case "LdapGroupMapping", "OidcGroupMapping", "OidcRoleMapping":
+		if option.Value != "" {
+			mapping := make(map[string]string)
+			if err = json.Unmarshal([]byte(option.Value), &mapping); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "映射不是合法的 JSON 对象：" + err.Error(),
+				})
+				return
+			}
+			if option.Key == "OidcRoleMapping" {
+				for _, role := range mapping {
+					if role != "common" && role != "admin" {
+						c.JSON(http.StatusOK, gin.H{
+							"success": false,
+							"message": "角色映射的值只能为 common 或 admin",
+						})
+						return
+					}
+				}
+			}
+		}
+	case "ContentFilterRules":
+		if _, err = filter.ParseRules(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "内容过滤规则无效：" + err.Error(),
+			})
+			return
+		}
+	case "Hooks":
+		if _, err = hook.ParseConfigs(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "钩子配置无效：" + err.Error(),
+			})
+			return
+		}
+	case "HookSecret":
+		if _, err = hook.ParseSecrets(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "钩子密钥无效：" + err.Error(),
+			})
+			return
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
@@ -0,0 +1,478 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// canManageOrganization tells whether the current user is an organization admin or has the permission to manage all organizations
+func canManageOrganization(c *gin.Context, organizationId int) bool {
+	userId := c.GetInt(ctxkey.Id)
+	if model.HasPermission(userId, c.GetInt(ctxkey.Role), model.PermissionOrganizationManage) {
+		return true
+	}
+	return model.IsOrganizationAdmin(organizationId, userId)
+}
+
+// checkOrganizationMemberChange restricts the organization admins to managing the common members
+func checkOrganizationMemberChange(c *gin.Context, before *model.OrganizationMember, after *model.OrganizationMember) error {
+	userId := c.GetInt(ctxkey.Id)
+	if model.HasPermission(userId, c.GetInt(ctxkey.Role), model.PermissionOrganizationManage) {
+		return nil
+	}
+	return model.CheckOrganizationAdminChange(userId, before, after)
+}
+
+// getManagedOrganizationId returns the organization id in the path, it responds and returns 0 if the user can't manage it
+func getManagedOrganizationId(c *gin.Context) int {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id == 0 || !canManageOrganization(c, id) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，权限不足",
+		})
+		return 0
+	}
+	return id
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	organizations, err := model.GetAllOrganizations(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organizations,
+	})
+	return
+}
+
+func SearchOrganizations(c *gin.Context) {
+	keyword := c.Query("keyword")
+	organizations, err := model.SearchOrganizations(keyword)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organizations,
+	})
+	return
+}
+
+// GetSelfOrganizations returns the organizations of the current user, the tokens can be bound to them
+func GetSelfOrganizations(c *gin.Context) {
+	organizations, members, err := model.GetUserOrganizations(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"organizations": organizations,
+			"memberships":   members,
+		},
+	})
+	return
+}
+
+func GetOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !canManageOrganization(c, id) {
+		if _, err := model.GetOrganizationMember(id, c.GetInt(ctxkey.Id)); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，权限不足",
+			})
+			return
+		}
+	}
+	organization, err := model.GetOrganizationById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organization,
+	})
+	return
+}
+
+type addOrganizationRequest struct {
+	Name    string `json:"name"`
+	Quota   int64  `json:"quota"`
+	AdminId int    `json:"admin_id"` // the first organization admin, optional
+}
+
+func AddOrganization(c *gin.Context) {
+	req := addOrganizationRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.Quota < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "额度不能为负数",
+		})
+		return
+	}
+	if req.AdminId != 0 {
+		if _, err = model.GetUserById(req.AdminId, false); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "用户不存在",
+			})
+			return
+		}
+	}
+	organization := model.Organization{
+		Name:  req.Name,
+		Quota: req.Quota,
+	}
+	err = organization.Insert()
+	if err == nil && req.AdminId != 0 {
+		member := model.OrganizationMember{
+			OrganizationId: organization.Id,
+			UserId:         req.AdminId,
+			Role:           model.OrganizationRoleAdmin,
+		}
+		err = member.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organization,
+	})
+	return
+}
+
+func UpdateOrganization(c *gin.Context) {
+	organization := model.Organization{}
+	err := c.ShouldBindJSON(&organization)
+	if err != nil || organization.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	cleanOrganization, err := model.GetOrganizationById(organization.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// the quota is changed by top-up only, so that the concurrent consumption is not overwritten
+	cleanOrganization.Name = organization.Name
+	err = cleanOrganization.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrganization,
+	})
+	return
+}
+
+func DeleteOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	organization, err := model.GetOrganizationById(id)
+	if err == nil {
+		err = organization.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+type organizationTopUpRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+// TopUpOrganization adds quota to the organization pool, a negative quota takes it back
+func TopUpOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := organizationTopUpRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.Quota == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	err = model.IncreaseOrganizationQuota(id, req.Quota, model.QuotaTransaction{
+		Type:    model.QuotaTransactionTypeTopUp,
+		ActorId: c.GetInt(ctxkey.Id),
+		Reason:  "组织充值",
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	id := getManagedOrganizationId(c)
+	if id == 0 {
+		return
+	}
+	members, err := model.GetOrganizationMembers(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+	return
+}
+
+type organizationMemberRequest struct {
+	UserId     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Role       int    `json:"role"`
+	QuotaLimit int64  `json:"quota_limit"`
+}
+
+func (req *organizationMemberRequest) getUserId() (int, error) {
+	if req.UserId != 0 {
+		return req.UserId, nil
+	}
+	if req.Username == "" {
+		return 0, errors.New("无效的参数")
+	}
+	user := model.User{Username: req.Username}
+	if err := user.FillUserByUsername(); err != nil || user.Id == 0 {
+		return 0, errors.New("用户不存在")
+	}
+	return user.Id, nil
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	id := getManagedOrganizationId(c)
+	if id == 0 {
+		return
+	}
+	req := organizationMemberRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userId, err := req.getUserId()
+	if err == nil {
+		_, err = model.GetUserById(userId, false)
+		if err != nil {
+			err = errors.New("用户不存在")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	member := model.OrganizationMember{
+		OrganizationId: id,
+		UserId:         userId,
+		Role:           req.Role,
+		QuotaLimit:     req.QuotaLimit,
+	}
+	if member.Role == 0 {
+		member.Role = model.OrganizationRoleMember
+	}
+	err = checkOrganizationMemberChange(c, nil, &member)
+	if err == nil {
+		err = member.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	id := getManagedOrganizationId(c)
+	if id == 0 {
+		return
+	}
+	req := organizationMemberRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userId, err := req.getUserId()
+	var member *model.OrganizationMember
+	if err == nil {
+		member, err = model.GetOrganizationMember(id, userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	before := *member
+	member.Role = req.Role
+	member.QuotaLimit = req.QuotaLimit
+	err = checkOrganizationMemberChange(c, &before, member)
+	if err == nil {
+		err = member.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+func DeleteOrganizationMember(c *gin.Context) {
+	id := getManagedOrganizationId(c)
+	if id == 0 {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	member, err := model.GetOrganizationMember(id, userId)
+	if err == nil {
+		err = checkOrganizationMemberChange(c, member, nil)
+	}
+	if err == nil {
+		err = member.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// GetOrganizationUsage returns the consumption of the organization by member, or by member and token if by=token
+func GetOrganizationUsage(c *gin.Context) {
+	id := getManagedOrganizationId(c)
+	if id == 0 {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	usages, err := model.GetOrganizationUsage(id, startTimestamp, endTimestamp, c.Query("by") == "token")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    usages,
+	})
+	return
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+func GetAllModelPrices(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	prices, err := model.GetAllModelPrices(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    prices,
+	})
+	return
+}
+
+func SearchModelPrices(c *gin.Context) {
+	keyword := c.Query("keyword")
+	prices, err := model.SearchModelPrices(keyword)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    prices,
+	})
+	return
+}
+
+func GetModelPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	price, err := model.GetModelPriceById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    price,
+	})
+	return
+}
+
+func AddModelPrice(c *gin.Context) {
+	price := model.ModelPrice{}
+	err := c.ShouldBindJSON(&price)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = price.Validate()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanPrice := model.ModelPrice{
+		Model:            price.Model,
+		InputPrice:       price.InputPrice,
+		OutputPrice:      price.OutputPrice,
+		CachedInputPrice: price.CachedInputPrice,
+		ImagePrice:       price.ImagePrice,
+		SecondPrice:      price.SecondPrice,
+	}
+	err = cleanPrice.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanPrice,
+	})
+	return
+}
+
+func UpdateModelPrice(c *gin.Context) {
+	price := model.ModelPrice{}
+	err := c.ShouldBindJSON(&price)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = price.Validate()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanPrice, err := model.GetModelPriceById(price.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// If you add more fields, please also update price.Update()
+	cleanPrice.Model = price.Model
+	cleanPrice.InputPrice = price.InputPrice
+	cleanPrice.OutputPrice = price.OutputPrice
+	cleanPrice.CachedInputPrice = price.CachedInputPrice
+	cleanPrice.ImagePrice = price.ImagePrice
+	cleanPrice.SecondPrice = price.SecondPrice
+	err = cleanPrice.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanPrice,
+	})
+	return
+}
+
+func DeleteModelPrice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteModelPriceById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
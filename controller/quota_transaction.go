@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+func getQuotaTransactions(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	transactionType, _ := strconv.Atoi(c.Query("type"))
+	transactions, err := model.GetUserQuotaTransactions(userId, transactionType, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    transactions,
+	})
+	return
+}
+
+func GetQuotaTransactions(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的 user id",
+		})
+		return
+	}
+	getQuotaTransactions(c, userId)
+}
+
+func GetSelfQuotaTransactions(c *gin.Context) {
+	getQuotaTransactions(c, c.GetInt(ctxkey.Id))
+}
+
+func CheckQuotaTransactions(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	inconsistencies, err := model.CheckQuotaTransactions(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"consistent":      len(inconsistencies) == 0,
+			"inconsistencies": inconsistencies,
+		},
+	})
+	return
+}
@@ -0,0 +1,733 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// SCIM 2.0 provisioning, see RFC 7643 and RFC 7644. The one-api groups are the SCIM groups,
+// a user belongs to exactly one group, so adding a user to a group moves it out of the previous one.
+
+const (
+	scimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimMaxCount           = 100
+	scimDefaultGroup       = "default"
+)
+
+type scimName struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type scimUser struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id,omitempty"`
+	ExternalId  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	Name        *scimName       `json:"name,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Emails      []scimEmail     `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Groups      []scimReference `json:"groups,omitempty"`
+	Meta        *scimMeta       `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id"`
+	DisplayName string          `json:"displayName"`
+	Members     []scimReference `json:"members"`
+	Meta        *scimMeta       `json:"meta,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type scimPatchRequest struct {
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+var scimFilterRegex = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+var scimMemberPathRegex = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*]$`)
+
+func scimJSON(c *gin.Context, status int, obj any) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, obj)
+}
+
+func scimError(c *gin.Context, status int, detail string) {
+	scimJSON(c, status, gin.H{
+		"schemas": []string{scimSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
+
+// parseScimFilter supports the `attribute eq "value"` filters, which are what the identity providers use to match resources
+func parseScimFilter(filter string) (attribute string, value string, err error) {
+	if filter == "" {
+		return "", "", nil
+	}
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", fmt.Errorf("不支持的过滤条件：%s", filter)
+	}
+	value, err = strconv.Unquote(`"` + matches[2] + `"`)
+	return strings.ToLower(matches[1]), value, err
+}
+
+// parseScimPage converts the 1-based startIndex and count to offset and limit
+func parseScimPage(c *gin.Context) (startIndex int, count int) {
+	startIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count > scimMaxCount || count < 0 {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func toScimUser(user *model.User) *scimUser {
+	active := user.Status == model.UserStatusEnabled
+	scimUser := &scimUser{
+		Schemas:     []string{scimSchemaUser},
+		Id:          strconv.Itoa(user.Id),
+		UserName:    user.Username,
+		Name:        &scimName{Formatted: user.DisplayName},
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Groups:      []scimReference{{Value: user.Group, Display: user.Group}},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Location:     fmt.Sprintf("%s/scim/v2/Users/%d", config.ServerAddress, user.Id),
+		},
+	}
+	if user.Email != "" {
+		scimUser.Emails = []scimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	return scimUser
+}
+
+func toScimGroup(group string) (*scimGroup, error) {
+	users, err := model.GetGroupUsers(group)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]scimReference, 0, len(users))
+	for _, user := range users {
+		members = append(members, scimReference{Value: strconv.Itoa(user.Id), Display: user.Username})
+	}
+	return &scimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		Id:          group,
+		DisplayName: group,
+		Members:     members,
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Location:     fmt.Sprintf("%s/scim/v2/Groups/%s", config.ServerAddress, group),
+		},
+	}, nil
+}
+
+// getScimUser returns the user in the path, it responds and returns nil if not found
+func getScimUser(c *gin.Context) *model.User {
+	id, _ := strconv.Atoi(c.Param("id"))
+	user, err := model.GetUserById(id, false)
+	if err != nil || user.Status == model.UserStatusDeleted {
+		scimError(c, http.StatusNotFound, "用户不存在")
+		return nil
+	}
+	return user
+}
+
+func (scimUser *scimUser) email() string {
+	for _, email := range scimUser.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(scimUser.Emails) > 0 {
+		return scimUser.Emails[0].Value
+	}
+	// the user name is usually the email
+	if strings.Contains(scimUser.UserName, "@") {
+		return scimUser.UserName
+	}
+	return ""
+}
+
+func (scimUser *scimUser) displayName() string {
+	if scimUser.DisplayName != "" {
+		return scimUser.DisplayName
+	}
+	if scimUser.Name != nil && scimUser.Name.Formatted != "" {
+		return scimUser.Name.Formatted
+	}
+	return scimUser.UserName
+}
+
+// truncateScimDisplayName keeps the display name within the 20 characters allowed by the user model
+func truncateScimDisplayName(displayName string) string {
+	runes := []rune(displayName)
+	if len(runes) > 20 {
+		return string(runes[:20])
+	}
+	return displayName
+}
+
+// setScimUserName renames the user if the user name is valid and not taken, otherwise the user name is kept,
+// the user can still be found by the email
+func setScimUserName(user *model.User, userName string) {
+	if userName == "" || userName == user.Username || len(userName) > 12 {
+		return
+	}
+	if model.IsUsernameAlreadyTaken(userName) {
+		return
+	}
+	user.Username = userName
+}
+
+// setScimUserActive enables or disables the user, the tokens are disabled along with the user
+func setScimUserActive(user *model.User, active bool) error {
+	if active {
+		user.Status = model.UserStatusEnabled
+		return nil
+	}
+	if user.Role == model.RoleRootUser {
+		return errors.New("无法禁用超级管理员用户")
+	}
+	user.Status = model.UserStatusDisabled
+	return nil
+}
+
+// saveScimUser saves the user, the tokens are disabled if the user is deactivated
+func saveScimUser(user *model.User) error {
+	user.DisplayName = truncateScimDisplayName(user.DisplayName)
+	err := user.Update(false)
+	if err != nil {
+		return err
+	}
+	if user.Status == model.UserStatusDisabled {
+		logger.SysLog(fmt.Sprintf("user %d is deactivated by SCIM", user.Id))
+		return model.DisableUserTokens(user.Id)
+	}
+	return nil
+}
+
+func GetScimServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the SCIM secret configured in one-api",
+		}},
+	})
+}
+
+func GetScimUsers(c *gin.Context) {
+	attribute, value, err := parseScimFilter(c.Query("filter"))
+	if err == nil && attribute != "" && attribute != "username" && attribute != "externalid" {
+		err = fmt.Errorf("不支持按 %s 过滤", attribute)
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	startIndex, count := parseScimPage(c)
+	users, total, err := model.QueryUsers(value, startIndex-1, count)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toScimUser(user))
+	}
+	scimJSON(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func GetScimUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+func CreateScimUser(c *gin.Context) {
+	req := scimUser{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.UserName == "" {
+		scimError(c, http.StatusBadRequest, "无效的参数")
+		return
+	}
+	if _, total, _ := model.QueryUsers(req.UserName, 0, 1); total > 0 {
+		scimError(c, http.StatusConflict, "用户已存在")
+		return
+	}
+	user := model.User{
+		Username:    req.UserName,
+		DisplayName: req.displayName(),
+		Email:       req.email(),
+		Role:        model.RoleCommonUser,
+		Status:      model.UserStatusEnabled,
+	}
+	if len(user.Username) > 12 || model.IsUsernameAlreadyTaken(user.Username) {
+		user.Username = "scim_" + strconv.Itoa(model.GetMaxUserId()+1)
+	}
+	user.DisplayName = truncateScimDisplayName(user.DisplayName)
+	if req.Active != nil && !*req.Active {
+		user.Status = model.UserStatusDisabled
+	}
+	err = user.Insert(0)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.SysLog(fmt.Sprintf("user %d is provisioned by SCIM", user.Id))
+	scimJSON(c, http.StatusCreated, toScimUser(&user))
+}
+
+// ReplaceScimUser handles PUT, the attributes not supported by one-api are ignored
+func ReplaceScimUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	req := scimUser{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "无效的参数")
+		return
+	}
+	setScimUserName(user, req.UserName)
+	user.DisplayName = req.displayName()
+	if email := req.email(); email != "" {
+		user.Email = email
+	}
+	if req.Active != nil {
+		err = setScimUserActive(user, *req.Active)
+	}
+	if err == nil {
+		err = saveScimUser(user)
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+// applyScimUserAttribute applies a patch operation on an attribute of the user
+func applyScimUserAttribute(user *model.User, path string, value json.RawMessage) error {
+	switch strings.ToLower(path) {
+	case "active":
+		var active bool
+		if err := json.Unmarshal(value, &active); err != nil {
+			// some identity providers send the boolean as string
+			var s string
+			if json.Unmarshal(value, &s) != nil {
+				return errors.New("无效的 active")
+			}
+			active = strings.EqualFold(s, "true")
+		}
+		return setScimUserActive(user, active)
+	case "username":
+		var userName string
+		if err := json.Unmarshal(value, &userName); err != nil {
+			return errors.New("无效的 userName")
+		}
+		setScimUserName(user, userName)
+	case "displayname", "name.formatted":
+		var displayName string
+		if err := json.Unmarshal(value, &displayName); err != nil {
+			return errors.New("无效的 displayName")
+		}
+		user.DisplayName = displayName
+	case "emails", `emails[type eq "work"].value`, "emails[primary eq true].value":
+		var email string
+		if err := json.Unmarshal(value, &email); err != nil {
+			var emails []scimEmail
+			if json.Unmarshal(value, &emails) != nil {
+				return errors.New("无效的 emails")
+			}
+			email = (&scimUser{Emails: emails}).email()
+		}
+		user.Email = email
+	}
+	return nil
+}
+
+func PatchScimUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	req := scimPatchRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "无效的参数")
+		return
+	}
+	for _, operation := range req.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" {
+			continue
+		}
+		if operation.Path != "" {
+			err = applyScimUserAttribute(user, operation.Path, operation.Value)
+		} else {
+			// without path, the value is an object of the attributes
+			attributes := make(map[string]json.RawMessage)
+			if err = json.Unmarshal(operation.Value, &attributes); err != nil {
+				err = errors.New("无效的参数")
+			}
+			for path, value := range attributes {
+				if err == nil {
+					err = applyScimUserAttribute(user, path, value)
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = saveScimUser(user)
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+// DeleteScimUser deactivates the user and marks it deleted
+func DeleteScimUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	err := setScimUserActive(user, false)
+	if err == nil {
+		err = model.DisableUserTokens(user.Id)
+	}
+	if err == nil {
+		err = user.Delete()
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	logger.SysLog(fmt.Sprintf("user %d is deleted by SCIM", user.Id))
+	c.Status(http.StatusNoContent)
+}
+
+func getScimGroupNames() []string {
+	var groups []string
+	for group := range billingratio.GroupRatio {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func GetScimGroups(c *gin.Context) {
+	attribute, value, err := parseScimFilter(c.Query("filter"))
+	if err == nil && attribute != "" && attribute != "displayname" {
+		err = fmt.Errorf("不支持按 %s 过滤", attribute)
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	var groups []string
+	for _, group := range getScimGroupNames() {
+		if value == "" || group == value {
+			groups = append(groups, group)
+		}
+	}
+	startIndex, count := parseScimPage(c)
+	resources := make([]any, 0)
+	for i := startIndex - 1; i < len(groups) && len(resources) < count; i++ {
+		group, err := toScimGroup(groups[i])
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resources = append(resources, group)
+	}
+	scimJSON(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: int64(len(groups)),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// getScimGroupName returns the group in the path, it responds and returns empty if the group is not configured
+func getScimGroupName(c *gin.Context, group string) string {
+	if _, ok := billingratio.GroupRatio[group]; !ok {
+		scimError(c, http.StatusNotFound, "分组不存在，请先在分组倍率中添加该分组")
+		return ""
+	}
+	return group
+}
+
+func GetScimGroup(c *gin.Context) {
+	group := getScimGroupName(c, c.Param("id"))
+	if group == "" {
+		return
+	}
+	scimGroup, err := toScimGroup(group)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scimJSON(c, http.StatusOK, scimGroup)
+}
+
+func parseScimMembers(value json.RawMessage) ([]int, error) {
+	var members []scimReference
+	if len(value) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(value, &members); err != nil {
+		return nil, errors.New("无效的 members")
+	}
+	var ids []int
+	for _, member := range members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的成员 %s", member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setScimGroupMember moves the user into the group, or back to the default group if the user is removed from its group
+func setScimGroupMember(group string, userId int, add bool) error {
+	user, err := model.GetUserById(userId, false)
+	if err != nil || user.Status == model.UserStatusDeleted {
+		return fmt.Errorf("用户 %d 不存在", userId)
+	}
+	if add && user.Group != group {
+		return model.UpdateUserGroup(user.Id, group)
+	}
+	if !add && user.Group == group && group != scimDefaultGroup {
+		return model.UpdateUserGroup(user.Id, scimDefaultGroup)
+	}
+	return nil
+}
+
+// replaceScimGroupMembers makes the users the only members of the group
+func replaceScimGroupMembers(group string, ids []int) error {
+	keep := make(map[int]bool)
+	for _, id := range ids {
+		keep[id] = true
+		if err := setScimGroupMember(group, id, true); err != nil {
+			return err
+		}
+	}
+	users, err := model.GetGroupUsers(group)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if !keep[user.Id] {
+			if err = setScimGroupMember(group, user.Id, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CreateScimGroup links an existing one-api group, the groups are defined by the group ratio
+func CreateScimGroup(c *gin.Context) {
+	req := scimGroup{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "无效的参数")
+		return
+	}
+	group := getScimGroupName(c, req.DisplayName)
+	if group == "" {
+		return
+	}
+	for _, member := range req.Members {
+		id, _ := strconv.Atoi(member.Value)
+		if err = setScimGroupMember(group, id, true); err != nil {
+			break
+		}
+	}
+	var scimGroup *scimGroup
+	if err == nil {
+		scimGroup, err = toScimGroup(group)
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	scimJSON(c, http.StatusCreated, scimGroup)
+}
+
+func ReplaceScimGroup(c *gin.Context) {
+	group := getScimGroupName(c, c.Param("id"))
+	if group == "" {
+		return
+	}
+	req := struct {
+		Members json.RawMessage `json:"members"`
+	}{}
+	err := c.ShouldBindJSON(&req)
+	var ids []int
+	if err == nil {
+		ids, err = parseScimMembers(req.Members)
+	}
+	if err == nil {
+		err = replaceScimGroupMembers(group, ids)
+	}
+	var scimGroup *scimGroup
+	if err == nil {
+		scimGroup, err = toScimGroup(group)
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	scimJSON(c, http.StatusOK, scimGroup)
+}
+
+func PatchScimGroup(c *gin.Context) {
+	group := getScimGroupName(c, c.Param("id"))
+	if group == "" {
+		return
+	}
+	req := scimPatchRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "无效的参数")
+		return
+	}
+	for _, operation := range req.Operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.TrimSpace(operation.Path)
+		var ids []int
+		if matches := scimMemberPathRegex.FindStringSubmatch(path); matches != nil {
+			// e.g. remove members[value eq "2"]
+			var id int
+			id, err = strconv.Atoi(matches[1])
+			ids = []int{id}
+			path = "members"
+		} else if strings.EqualFold(path, "members") {
+			ids, err = parseScimMembers(operation.Value)
+		} else {
+			// the group can't be renamed, the other attributes are ignored
+			continue
+		}
+		if err != nil {
+			break
+		}
+		switch op {
+		case "add":
+			for _, id := range ids {
+				if err = setScimGroupMember(group, id, true); err != nil {
+					break
+				}
+			}
+		case "remove":
+			if len(ids) == 0 {
+				// remove all the members
+				err = replaceScimGroupMembers(group, nil)
+			}
+			for _, id := range ids {
+				if err = setScimGroupMember(group, id, false); err != nil {
+					break
+				}
+			}
+		case "replace":
+			err = replaceScimGroupMembers(group, ids)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteScimGroup unlinks the group, its members are moved back to the default group
+func DeleteScimGroup(c *gin.Context) {
+	group := getScimGroupName(c, c.Param("id"))
+	if group == "" {
+		return
+	}
+	err := replaceScimGroupMembers(group, nil)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
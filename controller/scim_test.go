@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScimFilter(t *testing.T) {
+	tests := []struct {
+		filter    string
+		attribute string
+		value     string
+		wantErr   bool
+	}{
+		{"", "", "", false},
+		{`userName eq "alice"`, "username", "alice", false},
+		{`displayName EQ "a \"b\""`, "displayname", `a "b"`, false},
+		{`userName sw "a"`, "", "", true},
+		{`userName eq "a" and active eq true`, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			attribute, value, err := parseScimFilter(tt.filter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.attribute, attribute)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func setupTestDB(t *testing.T) {
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+}
+
+func newScimTestServer(t *testing.T) *gin.Engine {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/Users", CreateScimUser)
+	router.GET("/Users", GetScimUsers)
+	router.GET("/Users/:id", GetScimUser)
+	router.PATCH("/Users/:id", PatchScimUser)
+	router.DELETE("/Users/:id", DeleteScimUser)
+	router.GET("/Groups/:id", GetScimGroup)
+	router.PATCH("/Groups/:id", PatchScimGroup)
+	return router
+}
+
+func doScimRequest(t *testing.T, router *gin.Engine, method string, path string, body string, response any) int {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/scim+json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if response != nil && w.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), response))
+	}
+	return w.Code
+}
+
+func TestScimProvisioning(t *testing.T) {
+	router := newScimTestServer(t)
+
+	user := scimUser{}
+	code := doScimRequest(t, router, http.MethodPost, "/Users",
+		`{"userName":"alice","displayName":"Alice","emails":[{"value":"alice@example.com","primary":true}]}`, &user)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "alice", user.UserName)
+	assert.Equal(t, "alice@example.com", user.Emails[0].Value)
+	assert.True(t, *user.Active)
+	code = doScimRequest(t, router, http.MethodPost, "/Users", `{"userName":"alice"}`, nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	list := scimListResponse{}
+	code = doScimRequest(t, router, http.MethodGet, `/Users?filter=userName%20eq%20%22alice%22`, "", &list)
+	require.Equal(t, http.StatusOK, code)
+	assert.EqualValues(t, 1, list.TotalResults)
+	code = doScimRequest(t, router, http.MethodGet, `/Users?filter=emails%20co%20%22a%22`, "", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	id, _ := strconv.Atoi(user.Id)
+	token := model.Token{UserId: id, Name: "scim", Key: "scim-test-key", Status: model.TokenStatusEnabled, ExpiredTime: -1}
+	require.NoError(t, token.Insert())
+
+	// the user joins a group and leaves it
+	code = doScimRequest(t, router, http.MethodPatch, "/Groups/vip",
+		`{"Operations":[{"op":"add","path":"members","value":[{"value":"`+user.Id+`"}]}]}`, nil)
+	require.Equal(t, http.StatusNoContent, code)
+	group := scimGroup{}
+	doScimRequest(t, router, http.MethodGet, "/Groups/vip", "", &group)
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, user.Id, group.Members[0].Value)
+	code = doScimRequest(t, router, http.MethodPatch, "/Groups/vip",
+		`{"Operations":[{"op":"remove","path":"members[value eq \"`+user.Id+`\"]"}]}`, nil)
+	require.Equal(t, http.StatusNoContent, code)
+	doScimRequest(t, router, http.MethodGet, "/Users/"+user.Id, "", &user)
+	assert.Equal(t, "default", user.Groups[0].Value)
+	code = doScimRequest(t, router, http.MethodGet, "/Groups/no-such-group", "", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// deactivating the user disables the tokens, some identity providers send the boolean as string
+	code = doScimRequest(t, router, http.MethodPatch, "/Users/"+user.Id,
+		`{"Operations":[{"op":"replace","value":{"active":"False","displayName":"Alice Liddell"}}]}`, &user)
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, *user.Active)
+	assert.Equal(t, "Alice Liddell", user.DisplayName)
+	disabled, err := model.GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, model.TokenStatusDisabled, disabled.Status)
+
+	code = doScimRequest(t, router, http.MethodDelete, "/Users/"+user.Id, "", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	code = doScimRequest(t, router, http.MethodGet, "/Users/"+user.Id, "", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -117,6 +117,12 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("无效的网段：%s", err.Error())
 		}
 	}
+	if token.OrganizationId != 0 {
+		_, err := model.GetOrganizationMember(token.OrganizationId, c.GetInt(ctxkey.Id))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -150,6 +156,7 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+		OrganizationId: token.OrganizationId,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -239,6 +246,7 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.OrganizationId = token.OrganizationId
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the second factor must be provided within this many seconds after the first one
+const pendingTwoFactorTimeout = 5 * 60
+
+type twoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// setupPendingTwoFactorLogin remembers the user who passed the first factor,
+// the login is completed by LoginTwoFactor. If the user is required to enable
+// two-factor authentication but hasn't, a new secret is returned for enrollment.
+func setupPendingTwoFactorLogin(user *model.User, twoFactorEnabled bool, c *gin.Context) {
+	data := gin.H{"two_factor_required": true}
+	message := "请输入两步验证码"
+	if !twoFactorEnabled {
+		secret, uri, err := model.SetupTwoFactor(user.Id, user.Username)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		data = gin.H{
+			"two_factor_setup_required": true,
+			"secret":                    secret,
+			"uri":                       uri,
+		}
+		message = "管理员要求启用两步验证，请使用身份验证器扫描二维码或输入密钥，然后输入验证码"
+	}
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("pending_two_factor_id", user.Id)
+	session.Set("pending_two_factor_time", helper.GetTimestamp())
+	err := session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无法保存会话信息，请重试",
+			"success": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"success": false,
+		"data":    data,
+	})
+}
+
+// LoginTwoFactor completes the login with the TOTP code or a recovery code
+func LoginTwoFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	id, ok := session.Get("pending_two_factor_id").(int)
+	pendingTime, _ := session.Get("pending_two_factor_time").(int64)
+	if !ok || helper.GetTimestamp()-pendingTime > pendingTwoFactorTimeout {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "登录已过期，请重新登录",
+			"success": false,
+		})
+		return
+	}
+	var req twoFactorRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil || user.Status != model.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	var recoveryCodes []string
+	if model.IsTwoFactorEnabled(id) {
+		err = model.VerifyTwoFactor(id, req.Code)
+	} else {
+		recoveryCodes, err = model.EnableTwoFactor(id, req.Code)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	session.Delete("pending_two_factor_id")
+	session.Delete("pending_two_factor_time")
+	completeLogin(user, c, recoveryCodes)
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":  model.IsTwoFactorEnabled(c.GetInt(ctxkey.Id)),
+			"required": model.IsTwoFactorRequired(c.GetInt(ctxkey.Role)),
+		},
+	})
+}
+
+// SetupTwoFactor generates the secret, two-factor authentication is enabled after the first code is verified by EnableTwoFactor
+func SetupTwoFactor(c *gin.Context) {
+	secret, uri, err := model.SetupTwoFactor(c.GetInt(ctxkey.Id), c.GetString(ctxkey.Username))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": secret,
+			"uri":    uri,
+		},
+	})
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	var req twoFactorRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	recoveryCodes, err := model.EnableTwoFactor(c.GetInt(ctxkey.Id), req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    recoveryCodes,
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	if model.IsTwoFactorRequired(c.GetInt(ctxkey.Role)) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员要求启用两步验证，无法关闭",
+		})
+		return
+	}
+	var req twoFactorRequest
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		err = model.VerifyTwoFactor(c.GetInt(ctxkey.Id), req.Code)
+	}
+	if err == nil {
+		err = model.DisableTwoFactor(c.GetInt(ctxkey.Id))
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req twoFactorRequest
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		err = model.VerifyTwoFactor(c.GetInt(ctxkey.Id), req.Code)
+	}
+	var recoveryCodes []string
+	if err == nil {
+		recoveryCodes, err = model.RegenerateRecoveryCodes(c.GetInt(ctxkey.Id))
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    recoveryCodes,
+	})
+}
+
+// ResetTwoFactor removes the second factor of a user who has lost the authenticator and the recovery codes
+func ResetTwoFactor(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !model.CanManageUser(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.Role), user.Id, user.Role) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权重置权限与自己相同或超出自己的用户的两步验证",
+		})
+		return
+	}
+	err = model.DisableTwoFactor(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -59,11 +59,37 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
+	// the root user can always log in with password, in case the identity provider is down
+	if !config.OidcPasswordLoginEnabled && user.OidcId != "" && user.Role != model.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "该用户已绑定 OIDC，请通过 OIDC 登录",
+			"success": false,
+		})
+		return
+	}
 	SetupLogin(&user, c)
 }
 
-// setup session & cookies and then return user info
+// SetupLogin asks for the second factor if needed, otherwise it completes the login
 func SetupLogin(user *model.User, c *gin.Context) {
+	twoFactor, err := model.GetTwoFactor(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	twoFactorEnabled := twoFactor != nil && twoFactor.Enabled
+	if twoFactorEnabled || model.IsTwoFactorRequired(user.Role) {
+		setupPendingTwoFactorLogin(user, twoFactorEnabled, c)
+		return
+	}
+	completeLogin(user, c, nil)
+}
+
+// setup session & cookies and then return user info, the recovery codes are returned if two-factor authentication was just enabled
+func completeLogin(user *model.User, c *gin.Context, recoveryCodes []string) {
 	session := sessions.Default(c)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
@@ -84,11 +110,15 @@ func SetupLogin(user *model.User, c *gin.Context) {
 		Role:        user.Role,
 		Status:      user.Status,
 	}
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "",
 		"success": true,
 		"data":    cleanUser,
-	})
+	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func Logout(c *gin.Context) {
@@ -240,11 +270,10 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt(ctxkey.Role)
-	if myRole <= user.Role && myRole != model.RoleRootUser {
+	if !model.CanManageUser(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.Role), user.Id, user.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "无权获取同级或更高等级用户的信息",
+			"message": "无权获取权限与自己相同或超出自己的用户的信息",
 		})
 		return
 	}
@@ -289,6 +318,17 @@ func GenerateAccessToken(c *gin.Context) {
 		})
 		return
 	}
+	if model.IsTwoFactorEnabled(id) {
+		// the access token can manage the account without the second factor, so it needs one to be issued
+		err = model.VerifyTwoFactor(id, c.Query("code"))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	user.AccessToken = random.GetUUID()
 
 	if model.DB.Where("access_token = ?", user.AccessToken).First(user).RowsAffected != 0 {
@@ -361,9 +401,16 @@ func GetSelf(c *gin.Context) {
 	return
 }
 
+// updateUserRequest tells whether the quota is set, so that it can be set to 0
+type updateUserRequest struct {
+	model.User
+	Quota *int64 `json:"quota"`
+}
+
 func UpdateUser(c *gin.Context) {
-	var updatedUser model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&updatedUser)
+	var req updateUserRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	updatedUser := req.User
 	if err != nil || updatedUser.Id == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -389,24 +436,38 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt(ctxkey.Role)
-	if myRole <= originUser.Role && myRole != model.RoleRootUser {
+	myId, myRole := c.GetInt(ctxkey.Id), c.GetInt(ctxkey.Role)
+	if !model.CanManageUser(myId, myRole, originUser.Id, originUser.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "无权更新同权限等级或更高权限等级的用户信息",
+			"message": "无权更新权限与自己相同或超出自己的用户信息",
 		})
 		return
 	}
-	if myRole <= updatedUser.Role && myRole != model.RoleRootUser {
+	if !model.CanManageUser(myId, myRole, originUser.Id, updatedUser.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "无权将其他用户权限等级提升到大于等于自己的权限等级",
+			"message": "无权将其他用户的权限提升到与自己相同或超出自己",
 		})
 		return
 	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
+	if req.Quota != nil {
+		transaction, err := model.SetUserQuota(originUser.Id, *req.Quota, c.GetInt(ctxkey.Id))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		if transaction != nil {
+			model.RecordLog(originUser.Id, model.LogTypeManage, transaction.Reason)
+		}
+	}
+	// the cache event is published after the quota is changed
 	updatePassword := updatedUser.Password != ""
 	if err := updatedUser.Update(updatePassword); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -415,9 +476,6 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
-	if originUser.Quota != updatedUser.Quota {
-		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
-	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -489,11 +547,10 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	if originUser.Role == model.RoleRootUser || !model.CanManageUser(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.Role), originUser.Id, originUser.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "无权删除同权限等级或更高权限等级的用户",
+			"message": "无权删除权限与自己相同或超出自己的用户",
 		})
 		return
 	}
@@ -612,11 +669,11 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != model.RoleRootUser {
+	myRole := c.GetInt(ctxkey.Role)
+	if !model.CanManageUser(c.GetInt(ctxkey.Id), myRole, user.Id, user.Role) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "无权更新同权限等级或更高权限等级的用户信息",
+			"message": "无权更新权限与自己相同或超出自己的用户信息",
 		})
 		return
 	}
@@ -789,7 +846,14 @@ func AdminTopUp(c *gin.Context) {
 		})
 		return
 	}
-	err = model.IncreaseUserQuota(req.UserId, int64(req.Quota))
+	if req.Remark == "" {
+		req.Remark = fmt.Sprintf("通过 API 充值 %s", common.LogQuota(int64(req.Quota)))
+	}
+	err = model.IncreaseUserQuota(req.UserId, int64(req.Quota), model.QuotaTransaction{
+		Type:    model.QuotaTransactionTypeTopUp,
+		ActorId: c.GetInt(ctxkey.Id),
+		Reason:  req.Remark,
+	})
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -797,9 +861,6 @@ func AdminTopUp(c *gin.Context) {
 		})
 		return
 	}
-	if req.Remark == "" {
-		req.Remark = fmt.Sprintf("通过 API 充值 %s", common.LogQuota(int64(req.Quota)))
-	}
 	model.RecordTopupLog(req.UserId, req.Remark, req.Quota)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
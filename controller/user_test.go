@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestUser(t *testing.T, username string, role int, quota int64) *model.User {
+	user := &model.User{
+		Username:    username,
+		Password:    "12345678",
+		Role:        role,
+		Status:      model.UserStatusEnabled,
+		AccessToken: random.GetUUID(),
+		AffCode:     random.GetRandomString(4),
+	}
+	require.NoError(t, model.DB.Create(user).Error)
+	if quota != 0 {
+		require.NoError(t, model.ChangeUserQuota(user.Id, quota, model.QuotaTransaction{Type: model.QuotaTransactionTypeTopUp}))
+	}
+	return user
+}
+
+// doUserRequest calls the handler as the operator
+func doUserRequest(t *testing.T, handler gin.HandlerFunc, operator *model.User, method string, body any) map[string]any {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, "/api/user", func(c *gin.Context) {
+		c.Set(ctxkey.Id, operator.Id)
+		c.Set(ctxkey.Role, operator.Role)
+		c.Next()
+	}, handler)
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, "/api/user", bytes.NewReader(data)))
+	response := make(map[string]any)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestUpdateUserQuota(t *testing.T) {
+	setupTestDB(t)
+	root := createTestUser(t, "root-test", model.RoleRootUser, 0)
+	user := createTestUser(t, "quota-test", model.RoleCommonUser, 1000)
+
+	// the quota is kept if it's not in the request
+	response := doUserRequest(t, UpdateUser, root, http.MethodPut, map[string]any{
+		"id": user.Id, "username": user.Username, "display_name": "renamed",
+	})
+	require.Equal(t, true, response["success"], response["message"])
+	updated, err := model.GetUserById(user.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", updated.DisplayName)
+	assert.EqualValues(t, 1000, updated.Quota)
+
+	// the quota can be set to 0
+	response = doUserRequest(t, UpdateUser, root, http.MethodPut, map[string]any{
+		"id": user.Id, "username": user.Username, "quota": 0,
+	})
+	require.Equal(t, true, response["success"], response["message"])
+	updated, err = model.GetUserById(user.Id, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, updated.Quota)
+
+	transactions, err := model.GetUserQuotaTransactions(user.Id, model.QuotaTransactionTypeAdjust, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.EqualValues(t, -1000, transactions[0].Amount)
+	assert.EqualValues(t, 0, transactions[0].BalanceAfter)
+	assert.Equal(t, root.Id, transactions[0].ActorId)
+	inconsistencies, err := model.CheckQuotaTransactions(user.Id)
+	require.NoError(t, err)
+	assert.Empty(t, inconsistencies)
+}
+
+func TestManageUserPermissions(t *testing.T) {
+	setupTestDB(t)
+	root := createTestUser(t, "root-test", model.RoleRootUser, 0)
+	admin := createTestUser(t, "admin-test", model.RoleAdminUser, 0)
+	otherAdmin := createTestUser(t, "other-admin", model.RoleAdminUser, 0)
+	plain := createTestUser(t, "plain-test", model.RoleCommonUser, 0)
+	// a common user with a permission the admin doesn't have
+	config := createTestUser(t, "config-test", model.RoleCommonUser, 0)
+	role := &model.Role{Name: "config", Permissions: model.PermissionOptionWrite}
+	require.NoError(t, role.Insert())
+	require.NoError(t, model.AssignUserRole(config.Id, role.Id))
+
+	tests := []struct {
+		name     string
+		operator *model.User
+		target   *model.User
+		want     bool
+	}{
+		{"admin manages common user", admin, plain, true},
+		{"admin can't manage admin", admin, otherAdmin, false},
+		{"admin can't manage the user with more permissions", admin, config, false},
+		{"root manages everyone", root, config, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := doUserRequest(t, ManageUser, tt.operator, http.MethodPost, map[string]any{
+				"username": tt.target.Username, "action": "disable",
+			})
+			assert.Equal(t, tt.want, response["success"], response["message"])
+			response = doUserRequest(t, UpdateUser, tt.operator, http.MethodPut, map[string]any{
+				"id": tt.target.Id, "username": tt.target.Username, "display_name": "renamed", "role": tt.target.Role,
+			})
+			assert.Equal(t, tt.want, response["success"], response["message"])
+		})
+	}
+
+	// the admin can't raise the role of the users to its own
+	response := doUserRequest(t, UpdateUser, admin, http.MethodPut, map[string]any{
+		"id": plain.Id, "username": plain.Username, "role": model.RoleAdminUser,
+	})
+	assert.Equal(t, false, response["success"])
+}
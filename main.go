@@ -1,23 +1,32 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/songquanpeng/one-api/cli"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/graceful"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/router"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 //go:embed web/build/*
@@ -25,6 +34,9 @@ var buildFS embed.FS
 
 func main() {
 	common.Init()
+	if flag.NArg() > 0 {
+		os.Exit(cli.Run(flag.Args()))
+	}
 	logger.SetupLogger()
 	logger.SysLogf("One API %s started", common.Version)
 
@@ -35,11 +47,15 @@ func main() {
 		logger.SysLog("running in debug mode")
 	}
 
+	err := model.InitChannelSecretKeys()
+	if err != nil {
+		logger.FatalLog("failed to load channel secret keys: " + err.Error())
+	}
+
 	// Initialize SQL Database
 	model.InitDB()
 	model.InitLogDB()
 
-	var err error
 	err = model.CreateRootAccountIfNeed()
 	if err != nil {
 		logger.FatalLog("database init error: " + err.Error())
@@ -59,6 +75,9 @@ func main() {
 
 	// Initialize options
 	model.InitOptionMap()
+	model.InitModelPrices()
+	model.InitRoles()
+	model.InitConfigFile()
 	logger.SysLog(fmt.Sprintf("using theme %s", config.Theme))
 	if common.RedisEnabled {
 		// for compatibility with old versions
@@ -73,6 +92,17 @@ func main() {
 		go model.SyncOptions(config.SyncFrequency)
 		go model.SyncChannelCache(config.SyncFrequency)
 	}
+	model.InitCacheEvents()
+	if config.IsMasterNode {
+		go model.SyncQuotaReservations(60)
+	}
+	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
+		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
+		if err != nil {
+			logger.FatalLog("failed to parse CHANNEL_UPDATE_FREQUENCY: " + err.Error())
+		}
+		go controller.AutomaticallyUpdateChannels(frequency)
+	}
 	if os.Getenv("CHANNEL_TEST_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_TEST_FREQUENCY"))
 		if err != nil {
@@ -80,6 +110,13 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if os.Getenv("CHANNEL_MODEL_SYNC_FREQUENCY") != "" {
+		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_MODEL_SYNC_FREQUENCY"))
+		if err != nil {
+			logger.FatalLog("failed to parse CHANNEL_MODEL_SYNC_FREQUENCY: " + err.Error())
+		}
+		go controller.AutomaticallySyncChannelModels(frequency)
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -107,9 +144,45 @@ func main() {
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
 	}
-	logger.SysLogf("server started on http://localhost:%s", port)
-	err = server.Run(":" + port)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: server,
+	}
+	go func() {
+		logger.SysLogf("server started on http://localhost:%s", port)
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+	gracefulShutdown(srv)
+}
+
+// gracefulShutdown stops accepting new connections, then waits for in-flight requests and pending billing
+// within the grace period, the databases are closed after this. A part of the grace period is reserved for the
+// billing of the requests finished at the last moment.
+func gracefulShutdown(srv *http.Server) {
+	logger.SysLogf("shutting down, grace period is %d seconds", config.ShutdownTimeout)
+	timeout := time.Duration(config.ShutdownTimeout) * time.Second
+	billingTimeout := timeout / 3
+	ctx, cancel := context.WithTimeout(context.Background(), timeout-billingTimeout)
+	err := srv.Shutdown(ctx)
+	cancel()
+	if err != nil {
+		logger.SysError("failed to wait for in-flight requests: " + err.Error())
+	}
+	graceful.Stop()
+	ctx, cancel = context.WithTimeout(context.Background(), billingTimeout)
+	defer cancel()
+	err = graceful.WaitCriticalTasks(ctx)
 	if err != nil {
-		logger.FatalLog("failed to start HTTP server: " + err.Error())
+		logger.SysError("failed to wait for pending billing tasks: " + err.Error())
 	}
+	model.FlushBatchUpdates()
+	logger.SysLog("server exited")
 }
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the responses of admin APIs are small, larger ones are not parsed
+const maxAuditResponseSize = 64 * 1024
+
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.body.Len()+len(data) <= maxAuditResponseSize {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Audit records the mutating requests of administrators into the audit log,
+// it must be used after the auth middleware
+func Audit(targetType string) func(c *gin.Context) {
+	return audit(targetType, false)
+}
+
+// AuditAction is like Audit but records GET requests as well,
+// it's used by the GET APIs with side effects, such as testing channels
+func AuditAction(targetType string) func(c *gin.Context) {
+	return audit(targetType, true)
+}
+
+func audit(targetType string, withGet bool) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !withGet && c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		var body map[string]any
+		requestBody, err := common.GetRequestBody(c)
+		if err == nil {
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+			_ = json.Unmarshal(requestBody, &body)
+		}
+		targetId := getAuditTargetId(c, targetType, body)
+		before := model.GetAuditSnapshot(targetType, targetId)
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+		c.Next()
+
+		var response struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(writer.body.Bytes(), &response)
+		var after map[string]any
+		result, hasResult := c.Get(ctxkey.AuditResult)
+		switch {
+		case hasResult:
+			// the handler tells what to record instead of the request, e.g. the import doesn't record the keys
+			after = toAuditMap(result)
+		case targetId != "":
+			after = model.GetAuditSnapshot(targetType, targetId)
+		case c.Request.Method != http.MethodDelete:
+			// the target is being created, the request is the best we know
+			after = body
+		}
+		diff, _ := json.Marshal(model.GetAuditDiff(targetType, targetId, before, after))
+		model.RecordAuditLog(&model.AuditLog{
+			CreatedAt:  helper.GetTimestamp(),
+			ActorId:    c.GetInt(ctxkey.Id),
+			ActorName:  c.GetString(ctxkey.Username),
+			Action:     c.Request.Method + " " + c.FullPath(),
+			TargetType: targetType,
+			TargetId:   targetId,
+			Diff:       string(diff),
+			Success:    response.Success,
+			Message:    response.Message,
+			Ip:         c.ClientIP(),
+			RequestId:  c.GetString(helper.RequestIdKey),
+		})
+	}
+}
+
+func toAuditMap(value any) map[string]any {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	_ = json.Unmarshal(data, &m)
+	return m
+}
+
+func getAuditTargetId(c *gin.Context, targetType string, body map[string]any) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	switch targetType {
+	case model.AuditTargetOption:
+		if key, ok := body["key"].(string); ok {
+			return key
+		}
+	case model.AuditTargetUser:
+		if id, ok := body["id"].(float64); ok && id != 0 {
+			return strconv.Itoa(int(id))
+		}
+		if id, ok := body["user_id"].(float64); ok && id != 0 {
+			return strconv.Itoa(int(id))
+		}
+		// ManageUser only knows the username
+		if username, ok := body["username"].(string); ok && c.FullPath() == "/api/user/manage" {
+			user := model.User{Username: username}
+			if user.FillUserByUsername() == nil && user.Id != 0 {
+				return strconv.Itoa(user.Id)
+			}
+		}
+	default:
+		if id, ok := body["id"].(float64); ok && id != 0 {
+			return strconv.Itoa(int(id))
+		}
+	}
+	return ""
+}
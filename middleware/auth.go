@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/model"
@@ -12,7 +14,8 @@ import (
 	"strings"
 )
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper authenticates the user, then authorizes the user by the role and id
+func authHelper(c *gin.Context, authorized func(id int, role int) bool) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -56,7 +59,7 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
-	if role.(int) < minRole {
+	if !authorized(id.(int), role.(int)) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权进行此操作，权限不足",
@@ -70,21 +73,36 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Next()
 }
 
+func minRole(role int) func(id int, role int) bool {
+	return func(_ int, userRole int) bool {
+		return userRole >= role
+	}
+}
+
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, model.RoleCommonUser)
+		authHelper(c, minRole(model.RoleCommonUser))
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, model.RoleAdminUser)
+		authHelper(c, minRole(model.RoleAdminUser))
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, model.RoleRootUser)
+		authHelper(c, minRole(model.RoleRootUser))
+	}
+}
+
+// RequirePermission authorizes the user by the permissions of the built-in role and the custom role
+func RequirePermission(permission string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, func(id int, role int) bool {
+			return role >= model.RoleCommonUser && model.HasPermission(id, role, permission)
+		})
 	}
 }
 
@@ -150,6 +168,25 @@ func TokenAuth() func(c *gin.Context) {
 	}
 }
 
+// ScimAuth authenticates the SCIM client with the bearer secret, SCIM is disabled if the secret is not set
+func ScimAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		secret := config.ScimSecret
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			c.Header("Content-Type", "application/scim+json")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+				"status":  "401",
+				"detail":  "SCIM 未启用或 token 无效",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/completions") {
 		return true
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/hook"
+)
+
+// runRequestHooks runs the hooks on the parsed request, a hook can rewrite the body including the model, false is
+// returned if the request is aborted
+func runRequestHooks(c *gin.Context, group string) bool {
+	if !hook.Enabled(group, hook.StageRequest) || !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return true
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		abortWithMessage(c, http.StatusBadRequest, "无效的请求")
+		return false
+	}
+	result, err := hook.Run(c.Request.Context(), &hook.Event{
+		Stage:   hook.StageRequest,
+		Group:   group,
+		UserId:  c.GetInt(ctxkey.Id),
+		TokenId: c.GetInt(ctxkey.TokenId),
+		Model:   c.GetString(ctxkey.RequestModel),
+		Body:    requestBody,
+	})
+	if err != nil {
+		abortWithMessage(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if result.Body == nil {
+		return true
+	}
+	c.Set(ctxkey.KeyRequestBody, []byte(result.Body))
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(result.Body))
+	c.Request.ContentLength = int64(len(result.Body))
+	requestModel, err := getRequestModel(c)
+	if err != nil {
+		abortWithMessage(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	c.Set(ctxkey.RequestModel, requestModel)
+	return true
+}
+
+// routeByHooks returns the channel chosen by the hooks, or nil if no hook routes the request, false is returned
+// if the request is aborted
+func routeByHooks(c *gin.Context, group string, requestModel string) (*model.Channel, bool) {
+	if !hook.Enabled(group, hook.StageChannel) {
+		return nil, true
+	}
+	result, err := hook.Run(c.Request.Context(), &hook.Event{
+		Stage:   hook.StageChannel,
+		Group:   group,
+		UserId:  c.GetInt(ctxkey.Id),
+		TokenId: c.GetInt(ctxkey.TokenId),
+		Model:   requestModel,
+	})
+	if err != nil {
+		abortWithMessage(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if result.ChannelId == 0 {
+		return nil, true
+	}
+	// the hook can only choose among the channels the group could be routed to for the model
+	enabled, err := model.IsChannelEnabledForGroupModel(result.ChannelId, group, requestModel)
+	if err != nil || !enabled {
+		abortWithMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("钩子选择的渠道 %d 不可用于分组 %s 下的模型 %s", result.ChannelId, group, requestModel))
+		return nil, false
+	}
+	channel, err := model.GetChannelById(result.ChannelId, true)
+	if err != nil || channel.Status != model.ChannelStatusEnabled {
+		abortWithMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("钩子选择的渠道 %d 不可用", result.ChannelId))
+		return nil, false
+	}
+	return channel, true
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/hook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteByHooks(t *testing.T) {
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+	newChannel := func(name string, group string, models string, status int) int {
+		channel := &model.Channel{Type: 1, Name: name, Key: "sk-" + name, Models: models, Group: group, Status: status}
+		require.NoError(t, channel.Insert())
+		return channel.Id
+	}
+	gpt := newChannel("gpt", "default", "gpt-4o", model.ChannelStatusEnabled)
+	vip := newChannel("vip", "vip", "gpt-4o", model.ChannelStatusEnabled)
+	claude := newChannel("claude", "default", "claude-3-5-sonnet", model.ChannelStatusEnabled)
+	disabled := newChannel("disabled", "default", "gpt-4o", model.ChannelStatusManuallyDisabled)
+
+	var channelId int
+	hook.Register("test-route", hook.HookFunc(func(ctx context.Context, event *hook.Event) (*hook.Result, error) {
+		return &hook.Result{ChannelId: channelId}, nil
+	}))
+	require.NoError(t, hook.UpdateConfigsByJSONString(`[{"name":"test-route","stages":["channel"]}]`))
+	t.Cleanup(func() {
+		require.NoError(t, hook.UpdateConfigsByJSONString(""))
+	})
+
+	tests := []struct {
+		name      string
+		channelId int
+		wantOk    bool
+	}{
+		{"not routed", 0, true},
+		{"routed", gpt, true},
+		{"channel of another group", vip, false},
+		{"channel without the model", claude, false},
+		{"disabled channel", disabled, false},
+		{"channel does not exist", 100, false},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channelId = tt.channelId
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			channel, ok := routeByHooks(c, "default", "gpt-4o")
+			assert.Equal(t, tt.wantOk, ok)
+			if !tt.wantOk {
+				assert.Nil(t, channel)
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+				return
+			}
+			if tt.channelId == 0 {
+				assert.Nil(t, channel)
+				return
+			}
+			require.NotNil(t, channel)
+			assert.Equal(t, tt.channelId, channel.Id)
+		})
+	}
+}
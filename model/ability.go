@@ -48,6 +48,10 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 }
 
 func (channel *Channel) AddAbilities() error {
+	return channel.addAbilities(DB)
+}
+
+func (channel *Channel) addAbilities(tx *gorm.DB) error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
 	abilities := make([]Ability, 0, len(models_))
@@ -63,24 +67,32 @@ func (channel *Channel) AddAbilities() error {
 			abilities = append(abilities, ability)
 		}
 	}
-	return DB.Create(&abilities).Error
+	return tx.Create(&abilities).Error
 }
 
 func (channel *Channel) DeleteAbilities() error {
-	return DB.Where("channel_id = ?", channel.Id).Delete(&Ability{}).Error
+	return channel.deleteAbilities(DB)
+}
+
+func (channel *Channel) deleteAbilities(tx *gorm.DB) error {
+	return tx.Where("channel_id = ?", channel.Id).Delete(&Ability{}).Error
 }
 
 // UpdateAbilities updates abilities of this channel.
 // Make sure the channel is completed before calling this function.
 func (channel *Channel) UpdateAbilities() error {
+	return channel.updateAbilities(DB)
+}
+
+func (channel *Channel) updateAbilities(tx *gorm.DB) error {
 	// A quick and dirty way to update abilities
 	// First delete all abilities of this channel
-	err := channel.DeleteAbilities()
+	err := channel.deleteAbilities(tx)
 	if err != nil {
 		return err
 	}
 	// Then add new abilities
-	err = channel.AddAbilities()
+	err = channel.addAbilities(tx)
 	if err != nil {
 		return err
 	}
@@ -91,6 +103,19 @@ func UpdateAbilityStatus(channelId int, status bool) error {
 	return DB.Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
 }
 
+// IsChannelEnabledForGroupModel tells whether the channel serves the model for the group by the abilities
+func IsChannelEnabledForGroupModel(channelId int, group string, model string) (bool, error) {
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+	var count int64
+	err := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and channel_id = ? and enabled = "+trueVal, group, model, channelId).Count(&count).Error
+	return count > 0, err
+}
+
 func GetGroupModels(ctx context.Context, group string) ([]string, error) {
 	groupCol := "`group`"
 	trueVal := "1"
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// AuditLog records a mutating request made by an administrator
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"index;default:''"`
+	Action     string `json:"action" gorm:"index;default:''"` // method and route, e.g. PUT /api/channel/
+	TargetType string `json:"target_type" gorm:"index:idx_audit_target;default:''"`
+	TargetId   string `json:"target_id" gorm:"index:idx_audit_target;default:''"`
+	Diff       string `json:"diff" gorm:"type:text"` // changed fields, {"field": {"before": ..., "after": ...}}
+	Success    bool   `json:"success"`
+	Message    string `json:"message" gorm:"type:text"`
+	Ip         string `json:"ip" gorm:"default:''"`
+	RequestId  string `json:"request_id" gorm:"default:''"`
+}
+
+const (
+	AuditTargetChannel      = "channel"
+	AuditTargetUser         = "user"
+	AuditTargetOption       = "option"
+	AuditTargetRedemption   = "redemption"
+	AuditTargetPrice        = "price"
+	AuditTargetLog          = "log"
+	AuditTargetRole         = "role"
+	AuditTargetOrganization = "organization"
+)
+
+const auditRedacted = "[REDACTED]"
+
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+func RecordAuditLog(auditLog *AuditLog) {
+	err := LOG_DB.Create(auditLog).Error
+	if err != nil {
+		logger.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+func GetAuditLogs(actorId int, targetType string, targetId string, action string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (auditLogs []*AuditLog, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if actorId != 0 {
+		tx = tx.Where("actor_id = ?", actorId)
+	}
+	if targetType != "" {
+		tx = tx.Where("target_type = ?", targetType)
+	}
+	if targetId != "" {
+		tx = tx.Where("target_id = ?", targetId)
+	}
+	if action != "" {
+		tx = tx.Where("action LIKE ?", "%"+action+"%")
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&auditLogs).Error
+	return auditLogs, err
+}
+
+// GetAuditSnapshot returns the current state of the audit target as a map, nil if it doesn't exist
+func GetAuditSnapshot(targetType string, targetId string) map[string]any {
+	if targetId == "" {
+		return nil
+	}
+	var target any
+	var err error
+	id, _ := strconv.Atoi(targetId)
+	switch targetType {
+	case AuditTargetChannel:
+		target, err = GetChannelById(id, true)
+	case AuditTargetUser:
+		target, err = GetUserById(id, true)
+	case AuditTargetRedemption:
+		target, err = GetRedemptionById(id)
+	case AuditTargetPrice:
+		target, err = GetModelPriceById(id)
+	case AuditTargetRole:
+		target, err = GetRoleById(id)
+	case AuditTargetOrganization:
+		target, err = GetOrganizationById(id)
+	case AuditTargetOption:
+		config.OptionMapRWMutex.RLock()
+		value, ok := config.OptionMap[targetId]
+		config.OptionMapRWMutex.RUnlock()
+		if !ok {
+			return nil
+		}
+		return map[string]any{"value": value}
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil
+	}
+	snapshot := make(map[string]any)
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// isAuditSecret tells whether the field should be redacted, the rules of options follow GetOptions
+func isAuditSecret(targetType string, targetId string, field string) bool {
+	if targetType == AuditTargetOption {
+		return strings.HasSuffix(targetId, "Token") || strings.HasSuffix(targetId, "Secret")
+	}
+	switch strings.ToLower(field) {
+	case "key", "password", "access_token", "config", "sk", "ak", "vertex_ai_adc", "verification_code":
+		return true
+	}
+	return false
+}
+
+// redactAuditValue redacts the secret fields nested in objects and arrays, such as the keys of imported channels
+func redactAuditValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(value))
+		for field, fieldValue := range value {
+			if fieldValue != nil && isAuditSecret("", "", field) {
+				redacted[field] = auditRedacted
+			} else {
+				redacted[field] = redactAuditValue(fieldValue)
+			}
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(value))
+		for i, item := range value {
+			redacted[i] = redactAuditValue(item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// GetAuditDiff returns the changed fields between before and after with secrets redacted,
+// for creations before is nil, for deletions after is nil
+func GetAuditDiff(targetType string, targetId string, before map[string]any, after map[string]any) map[string]*AuditChange {
+	diff := make(map[string]*AuditChange)
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+	for field := range fields {
+		beforeValue, afterValue := before[field], after[field]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		if isAuditSecret(targetType, targetId, field) {
+			if beforeValue != nil {
+				beforeValue = auditRedacted
+			}
+			if afterValue != nil {
+				afterValue = auditRedacted
+			}
+		} else {
+			beforeValue = redactAuditValue(beforeValue)
+			afterValue = redactAuditValue(afterValue)
+		}
+		diff[field] = &AuditChange{Before: beforeValue, After: afterValue}
+	}
+	return diff
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuditDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetType string
+		targetId   string
+		before     map[string]any
+		after      map[string]any
+		want       map[string]*AuditChange
+	}{
+		{
+			"unchanged fields are skipped", AuditTargetChannel, "1",
+			map[string]any{"name": "a", "weight": 1.0},
+			map[string]any{"name": "b", "weight": 1.0},
+			map[string]*AuditChange{"name": {Before: "a", After: "b"}},
+		},
+		{
+			"channel secrets are redacted", AuditTargetChannel, "1",
+			map[string]any{"key": "sk-old", "config": "{}"},
+			map[string]any{"key": "sk-new", "config": "{}"},
+			map[string]*AuditChange{"key": {Before: auditRedacted, After: auditRedacted}},
+		},
+		{
+			"creation", AuditTargetUser, "",
+			nil,
+			map[string]any{"username": "test", "password": "12345678"},
+			map[string]*AuditChange{
+				"username": {Before: nil, After: "test"},
+				"password": {Before: nil, After: auditRedacted},
+			},
+		},
+		{
+			"deletion", AuditTargetRedemption, "1",
+			map[string]any{"name": "test"},
+			nil,
+			map[string]*AuditChange{"name": {Before: "test", After: nil}},
+		},
+		{
+			"nested secrets are redacted", AuditTargetChannel, "",
+			nil,
+			map[string]any{"channels": []any{
+				map[string]any{"name": "openai", "key": "sk-1", "config": `{"sk":"SK"}`},
+				map[string]any{"name": "azure", "key": nil, "other": map[string]any{"password": "123"}},
+			}},
+			map[string]*AuditChange{"channels": {Before: nil, After: []any{
+				map[string]any{"name": "openai", "key": auditRedacted, "config": auditRedacted},
+				map[string]any{"name": "azure", "key": nil, "other": map[string]any{"password": auditRedacted}},
+			}}},
+		},
+		{
+			"secret options are redacted", AuditTargetOption, "GitHubClientSecret",
+			map[string]any{"value": "old"},
+			map[string]any{"value": "new"},
+			map[string]*AuditChange{"value": {Before: auditRedacted, After: auditRedacted}},
+		},
+		{
+			"hook secrets are redacted", AuditTargetOption, "HookSecret",
+			map[string]any{"value": ""},
+			map[string]any{"value": `{"guardrail":"secret"}`},
+			map[string]*AuditChange{"value": {Before: auditRedacted, After: auditRedacted}},
+		},
+		{
+			"other options are not", AuditTargetOption, "SystemName",
+			map[string]any{"value": "old"},
+			map[string]any{"value": "new"},
+			map[string]*AuditChange{"value": {Before: "old", After: "new"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GetAuditDiff(tt.targetType, tt.targetId, tt.before, tt.after))
+		})
+	}
+}
+
+func TestGetAuditLogs(t *testing.T) {
+	setupTestDB(t)
+	createTestChannel(t, "openai", "sk-audit")
+	snapshot := GetAuditSnapshot(AuditTargetChannel, "1")
+	require.NotNil(t, snapshot)
+	assert.Equal(t, "sk-audit", snapshot["key"])
+	assert.Nil(t, GetAuditSnapshot(AuditTargetChannel, "100"))
+
+	RecordAuditLog(&AuditLog{CreatedAt: 100, ActorId: 1, Action: "GET /api/channel/test", TargetType: AuditTargetChannel})
+	RecordAuditLog(&AuditLog{CreatedAt: 200, ActorId: 2, Action: "POST /api/channel/test/:id/models", TargetType: AuditTargetChannel, TargetId: "1"})
+	RecordAuditLog(&AuditLog{CreatedAt: 300, ActorId: 1, Action: "PUT /api/option/", TargetType: AuditTargetOption, TargetId: "SystemName"})
+
+	tests := []struct {
+		name       string
+		actorId    int
+		targetType string
+		targetId   string
+		action     string
+		start      int64
+		want       int
+	}{
+		{"all", 0, "", "", "", 0, 3},
+		{"actor", 1, "", "", "", 0, 2},
+		{"target", 0, AuditTargetChannel, "1", "", 0, 1},
+		{"action", 0, "", "", "/api/channel/test", 0, 2},
+		{"time", 0, "", "", "", 200, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditLogs, err := GetAuditLogs(tt.actorId, tt.targetType, tt.targetId, tt.action, tt.start, 0, 0, 10)
+			require.NoError(t, err)
+			assert.Len(t, auditLogs, tt.want)
+		})
+	}
+}
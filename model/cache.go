@@ -11,7 +11,6 @@ import (
 	"github.com/songquanpeng/one-api/common/random"
 	"math/rand"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,19 +24,21 @@ var (
 	GroupModelsCacheSeconds   = config.SyncFrequency
 )
 
+// CacheGetTokenByKey looks up the token by the hash of the key, the plaintext key is never cached
 func CacheGetTokenByKey(key string) (*Token, error) {
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
+	keyHash := HashTokenKey(key)
 	var token Token
 	if !common.RedisEnabled {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		err := DB.Where(keyCol+" = ?", keyHash).First(&token).Error
 		return &token, err
 	}
-	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", key))
+	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", keyHash))
 	if err != nil {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		err := DB.Where(keyCol+" = ?", keyHash).First(&token).Error
 		if err != nil {
 			return nil, err
 		}
@@ -45,13 +46,14 @@ func CacheGetTokenByKey(key string) (*Token, error) {
 		if err != nil {
 			return nil, err
 		}
-		err = common.RedisSet(fmt.Sprintf("token:%s", key), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
+		err = common.RedisSet(fmt.Sprintf("token:%s", keyHash), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
 		if err != nil {
 			logger.SysError("Redis set token error: " + err.Error())
 		}
 		return &token, nil
 	}
 	err = json.Unmarshal([]byte(tokenObjectString), &token)
+	token.KeyHash = keyHash
 	return &token, err
 }
 
@@ -73,57 +75,6 @@ func CacheGetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
-func fetchAndUpdateUserQuota(ctx context.Context, id int) (quota int64, err error) {
-	quota, err = GetUserQuota(id)
-	if err != nil {
-		return 0, err
-	}
-	err = common.RedisSet(fmt.Sprintf("user_quota:%d", id), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
-	if err != nil {
-		logger.Error(ctx, "Redis set user quota error: "+err.Error())
-	}
-	return
-}
-
-func CacheGetUserQuota(ctx context.Context, id int) (quota int64, err error) {
-	if !common.RedisEnabled {
-		return GetUserQuota(id)
-	}
-	quotaString, err := common.RedisGet(fmt.Sprintf("user_quota:%d", id))
-	if err != nil {
-		return fetchAndUpdateUserQuota(ctx, id)
-	}
-	quota, err = strconv.ParseInt(quotaString, 10, 64)
-	if err != nil {
-		return 0, nil
-	}
-	if quota <= config.PreConsumedQuota { // when user's quota is less than pre-consumed quota, we need to fetch from db
-		logger.Infof(ctx, "user %d's cached quota is too low: %d, refreshing from db", quota, id)
-		return fetchAndUpdateUserQuota(ctx, id)
-	}
-	return quota, nil
-}
-
-func CacheUpdateUserQuota(ctx context.Context, id int) error {
-	if !common.RedisEnabled {
-		return nil
-	}
-	quota, err := CacheGetUserQuota(ctx, id)
-	if err != nil {
-		return err
-	}
-	err = common.RedisSet(fmt.Sprintf("user_quota:%d", id), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
-	return err
-}
-
-func CacheDecreaseUserQuota(id int, quota int64) error {
-	if !common.RedisEnabled {
-		return nil
-	}
-	err := common.RedisDecrease(fmt.Sprintf("user_quota:%d", id), int64(quota))
-	return err
-}
-
 func CacheIsUserEnabled(userId int) (bool, error) {
 	if !common.RedisEnabled {
 		return IsUserEnabled(userId)
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// cacheEventRedisChannel is the Redis pub/sub channel shared by all the nodes
+const cacheEventRedisChannel = "one-api:cache_event"
+
+const (
+	cacheEventChannel = "channel"
+	cacheEventOption  = "option"
+	cacheEventPrice   = "price"
+	cacheEventRole    = "role"
+	cacheEventToken   = "token"
+	cacheEventUser    = "user"
+)
+
+// cacheEvent tells every node that some entries have been changed in database,
+// for channels Key is the groups, for tokens Key is the token key
+type cacheEvent struct {
+	Type string `json:"type"`
+	Id   int    `json:"id,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// publishCacheEvent broadcasts the event to all the nodes including this one,
+// without Redis there is only one node, so the event is handled locally
+func publishCacheEvent(event cacheEvent) {
+	if !common.RedisEnabled {
+		handleCacheEvent(event)
+		return
+	}
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = common.RedisPublish(cacheEventRedisChannel, string(data))
+	}
+	if err != nil {
+		logger.SysError("failed to publish cache event: " + err.Error())
+		handleCacheEvent(event)
+	}
+}
+
+func handleCacheEvent(event cacheEvent) {
+	switch event.Type {
+	case cacheEventChannel:
+		if common.RedisEnabled {
+			for _, group := range strings.Split(event.Key, ",") {
+				_ = common.RedisDel(fmt.Sprintf("group_models:%s", group))
+			}
+		}
+		if config.MemoryCacheEnabled {
+			requestChannelCacheReload()
+		}
+	case cacheEventOption:
+		loadOptionsFromDatabase()
+	case cacheEventPrice:
+		loadModelPrices()
+	case cacheEventRole:
+		InitRoles()
+	case cacheEventToken:
+		if common.RedisEnabled {
+			_ = common.RedisDel(fmt.Sprintf("token:%s", event.Key))
+			invalidateQuotaCache(tokenQuotaCacheKey(event.Id))
+		}
+	case cacheEventUser:
+		if common.RedisEnabled {
+			_ = common.RedisDel(fmt.Sprintf("user_group:%d", event.Id))
+			_ = common.RedisDel(fmt.Sprintf("user_enabled:%d", event.Id))
+			_ = common.RedisDel(fmt.Sprintf("user_role_id:%d", event.Id))
+			invalidateQuotaCache(userQuotaCacheKey(event.Id))
+		}
+		enabled, err := IsUserEnabled(event.Id)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to check status of user %d: %s", event.Id, err.Error()))
+			return
+		}
+		if enabled {
+			blacklist.UnbanUser(event.Id)
+		} else {
+			blacklist.BanUser(event.Id)
+		}
+	default:
+		logger.SysError("unknown cache event type: " + event.Type)
+	}
+}
+
+// channelCacheReloadSignal merges the reload requests, so that bulk changes only reload the cache a few times
+var channelCacheReloadSignal = make(chan struct{}, 1)
+
+func requestChannelCacheReload() {
+	select {
+	case channelCacheReloadSignal <- struct{}{}:
+	default:
+	}
+}
+
+// InitCacheEvents must be called after the caches are initialized,
+// the periodical sync is kept as a fallback in case some events are lost
+func InitCacheEvents() {
+	go func() {
+		for range channelCacheReloadSignal {
+			InitChannelCache()
+		}
+	}()
+	if !common.RedisEnabled {
+		return
+	}
+	go func() {
+		pubsub := common.RedisSubscribe(cacheEventRedisChannel)
+		defer pubsub.Close()
+		logger.SysLog("subscribed to cache events")
+		// the channel is reconnected automatically by the Redis client
+		for msg := range pubsub.Channel() {
+			var event cacheEvent
+			err := json.Unmarshal([]byte(msg.Payload), &event)
+			if err != nil {
+				logger.SysError("failed to unmarshal cache event: " + err.Error())
+				continue
+			}
+			handleCacheEvent(event)
+		}
+	}()
+}
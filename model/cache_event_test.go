@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/blacklist"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheEventsWithoutRedis(t *testing.T) {
+	setupTestDB(t)
+	user, _ := createTestUserAndToken(t, 0, 0)
+
+	// the user is banned and unbanned on this node as soon as the status is changed
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("status", UserStatusDisabled).Error)
+	publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: user.Id})
+	assert.True(t, blacklist.IsUserBanned(user.Id))
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("status", UserStatusEnabled).Error)
+	publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: user.Id})
+	assert.False(t, blacklist.IsUserBanned(user.Id))
+
+	// the price table is reloaded
+	defer billingratio.UpdateModelPrices(map[string]billingratio.Price{})
+	price := &ModelPrice{Model: "cache-event-test", InputPrice: 1, OutputPrice: 2}
+	require.NoError(t, price.Insert())
+	assert.InDelta(t, 2, billingratio.GetCompletionRatio("cache-event-test", 1), 1e-9)
+
+	// the channel cache reload requests are merged
+	requestChannelCacheReload()
+	requestChannelCacheReload()
+	assert.Len(t, channelCacheReloadSignal, 1)
+	<-channelCacheReloadSignal
+}
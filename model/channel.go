@@ -3,7 +3,9 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
@@ -38,6 +40,9 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	// LowBalanceTime is when the balance fell below the threshold, 0 if the balance is sufficient
+	LowBalanceTime           int64  `json:"low_balance_time" gorm:"bigint;default:0"`
+	PriorityBeforeLowBalance *int64 `json:"-" gorm:"bigint"`
 }
 
 type ChannelConfig struct {
@@ -50,8 +55,39 @@ type ChannelConfig struct {
 	Plugin            string `json:"plugin,omitempty"`
 	VertexAIProjectID string `json:"vertex_ai_project_id,omitempty"`
 	VertexAIADC       string `json:"vertex_ai_adc,omitempty"`
+	// BalanceThreshold enables the low-balance alert, in the unit of the balance
+	BalanceThreshold   float64 `json:"balance_threshold,omitempty"`
+	LowBalanceAction   string  `json:"low_balance_action,omitempty"`
+	LowBalancePriority int64   `json:"low_balance_priority,omitempty"`
+	// ParamOverride is applied to the converted request body, Headers are added to the upstream request
+	ParamOverride *ParamOverride    `json:"param_override,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	// Proxy and the timeouts in seconds override RELAY_PROXY and RELAY_TIMEOUT for the channel
+	Proxy                 string `json:"proxy,omitempty"`
+	ConnectTimeout        int    `json:"connect_timeout,omitempty"`
+	ResponseHeaderTimeout int    `json:"response_header_timeout,omitempty"`
+	Timeout               int    `json:"timeout,omitempty"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty"`
+	TLSServerName         string `json:"tls_server_name,omitempty"`
 }
 
+func (cfg *ChannelConfig) ClientOptions() client.Options {
+	return client.Options{
+		Proxy:                 cfg.Proxy,
+		ConnectTimeout:        time.Duration(cfg.ConnectTimeout) * time.Second,
+		ResponseHeaderTimeout: time.Duration(cfg.ResponseHeaderTimeout) * time.Second,
+		Timeout:               time.Duration(cfg.Timeout) * time.Second,
+		InsecureSkipVerify:    cfg.TLSInsecureSkipVerify,
+		ServerName:            cfg.TLSServerName,
+	}
+}
+
+const (
+	LowBalanceActionNotify       = ""
+	LowBalanceActionDisable      = "disable"
+	LowBalanceActionDeprioritize = "deprioritize"
+)
+
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
 	var channels []*Channel
 	var err error
@@ -67,7 +103,15 @@ func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
 }
 
 func SearchChannels(keyword string) (channels []*Channel, err error) {
-	err = DB.Omit("key").Where("id = ? or name LIKE ?", helper.String2Int(keyword), keyword+"%").Find(&channels).Error
+	keyIds, err := searchChannelIdsByKey(keyword)
+	if err != nil {
+		return nil, err
+	}
+	tx := DB.Omit("key").Where("id = ? or name LIKE ?", helper.String2Int(keyword), keyword+"%")
+	if len(keyIds) != 0 {
+		tx = tx.Or("id in ?", keyIds)
+	}
+	err = tx.Find(&channels).Error
 	return channels, err
 }
 
@@ -83,13 +127,41 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 }
 
 func BatchInsertChannels(channels []Channel) error {
-	var err error
-	err = DB.Create(&channels).Error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return insertChannels(tx, channels)
+	})
 	if err != nil {
 		return err
 	}
 	for _, channel_ := range channels {
-		err = channel_.AddAbilities()
+		channel_.publishCacheEvent()
+	}
+	return nil
+}
+
+// insertChannels inserts the channels and their abilities, the cache events are left to the caller
+func insertChannels(tx *gorm.DB, channels []Channel) error {
+	encryptedChannels := make([]*Channel, 0, len(channels))
+	for i := range channels {
+		encryptedChannel, err := channels[i].withEncryptedSecrets()
+		if err != nil {
+			return err
+		}
+		encryptedChannels = append(encryptedChannels, encryptedChannel)
+	}
+	err := tx.Create(&encryptedChannels).Error
+	if err != nil {
+		return err
+	}
+	for i := range channels {
+		channels[i].Id = encryptedChannels[i].Id
+	}
+	for _, channel_ := range channels {
+		err = channel_.addAbilities(tx)
+		if err != nil {
+			return err
+		}
+		err = updateChannelKeyHashes(tx, channel_.Id, channel_.Key)
 		if err != nil {
 			return err
 		}
@@ -111,12 +183,11 @@ func (channel *Channel) GetBaseURL() string {
 	return *channel.BaseURL
 }
 
-func (channel *Channel) GetModelMapping() map[string]string {
+func (channel *Channel) GetModelMapping() ModelMapping {
 	if channel.ModelMapping == nil || *channel.ModelMapping == "" || *channel.ModelMapping == "{}" {
 		return nil
 	}
-	modelMapping := make(map[string]string)
-	err := json.Unmarshal([]byte(*channel.ModelMapping), &modelMapping)
+	modelMapping, err := ParseModelMapping(*channel.ModelMapping)
 	if err != nil {
 		logger.SysError(fmt.Sprintf("failed to unmarshal model mapping for channel %d, error: %s", channel.Id, err.Error()))
 		return nil
@@ -125,23 +196,49 @@ func (channel *Channel) GetModelMapping() map[string]string {
 }
 
 func (channel *Channel) Insert() error {
-	var err error
-	err = DB.Create(channel).Error
+	encryptedChannel, err := channel.withEncryptedSecrets()
 	if err != nil {
 		return err
 	}
+	err = DB.Create(encryptedChannel).Error
+	if err != nil {
+		return err
+	}
+	channel.Id = encryptedChannel.Id
 	err = channel.AddAbilities()
+	if err == nil {
+		err = updateChannelKeyHashes(DB, channel.Id, channel.Key)
+	}
+	channel.publishCacheEvent()
 	return err
 }
 
 func (channel *Channel) Update() error {
-	var err error
-	err = DB.Model(channel).Updates(channel).Error
+	encryptedChannel, err := channel.withEncryptedSecrets()
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if channel.Priority != nil {
+			// the priority edited during the low balance is not restored once the balance is sufficient again
+			err := tx.Model(&Channel{}).Where("id = ? and priority <> ?", channel.Id, *channel.Priority).
+				Update("priority_before_low_balance", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+		// the low-balance state is maintained by the balance check only
+		return tx.Model(encryptedChannel).Omit("low_balance_time", "priority_before_low_balance").Updates(encryptedChannel).Error
+	})
 	if err != nil {
 		return err
 	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities()
+	if err == nil {
+		err = updateChannelKeyHashes(DB, channel.Id, channel.Key)
+	}
+	channel.publishCacheEvent()
 	return err
 }
 
@@ -165,6 +262,61 @@ func (channel *Channel) UpdateBalance(balance float64) {
 	}
 }
 
+// MarkLowBalance records that the balance fell below the threshold, if priority is given the channel is
+// deprioritized and its priority is kept to be restored once the balance is sufficient again
+func (channel *Channel) MarkLowBalance(priority *int64) error {
+	updates := map[string]any{"low_balance_time": helper.GetTimestamp()}
+	if priority != nil && *priority < channel.GetPriority() {
+		updates["priority_before_low_balance"] = channel.GetPriority()
+		updates["priority"] = *priority
+	}
+	return channel.updateLowBalance(updates)
+}
+
+// ClearLowBalance records that the balance is sufficient again and restores the priority, the kept priority
+// is read in the transaction as it's dropped once the priority is edited during the low balance, see Update
+func (channel *Channel) ClearLowBalance() error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Channel{}).Where("id = ? and priority_before_low_balance is not null", channel.Id).
+			Update("priority", gorm.Expr("priority_before_low_balance"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 0 {
+			err := tx.Model(&Ability{}).Where("channel_id = ?", channel.Id).
+				Update("priority", tx.Model(&Channel{}).Select("priority").Where("id = ?", channel.Id)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Channel{}).Where("id = ?", channel.Id).
+			Updates(map[string]any{"low_balance_time": 0, "priority_before_low_balance": nil}).Error
+	})
+	if err != nil {
+		return err
+	}
+	channel.publishCacheEvent()
+	return nil
+}
+
+func (channel *Channel) updateLowBalance(updates map[string]any) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Channel{}).Where("id = ?", channel.Id).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		if priority, ok := updates["priority"]; ok {
+			return tx.Model(&Ability{}).Where("channel_id = ?", channel.Id).Update("priority", priority).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	channel.publishCacheEvent()
+	return nil
+}
+
 func (channel *Channel) Delete() error {
 	var err error
 	err = DB.Delete(channel).Error
@@ -172,9 +324,21 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
+	if err == nil {
+		err = DeleteChannelTestResults(channel.Id)
+	}
+	if err == nil {
+		err = DB.Where("channel_id = ?", channel.Id).Delete(&ChannelKeyHash{}).Error
+	}
+	channel.publishCacheEvent()
 	return err
 }
 
+// publishCacheEvent makes all the nodes reload the channel cache
+func (channel *Channel) publishCacheEvent() {
+	publishCacheEvent(cacheEvent{Type: cacheEventChannel, Id: channel.Id, Key: channel.Group})
+}
+
 func (channel *Channel) LoadConfig() (ChannelConfig, error) {
 	var cfg ChannelConfig
 	if channel.Config == "" {
@@ -196,6 +360,11 @@ func UpdateChannelStatusById(id int, status int) {
 	if err != nil {
 		logger.SysError("failed to update channel status: " + err.Error())
 	}
+	channel, err := GetChannelById(id, false)
+	if err != nil {
+		channel = &Channel{Id: id}
+	}
+	channel.publishCacheEvent()
 }
 
 func UpdateChannelUsedQuota(id int, quota int64) {
@@ -215,10 +384,27 @@ func updateChannelUsedQuota(id int, quota int64) {
 
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
+	if result.RowsAffected > 0 {
+		if err := deleteOrphanChannelKeyHashes(); err != nil {
+			logger.SysError("failed to delete channel key hashes: " + err.Error())
+		}
+		publishCacheEvent(cacheEvent{Type: cacheEventChannel})
+	}
 	return result.RowsAffected, result.Error
 }
 
 func DeleteDisabledChannel() (int64, error) {
-	result := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Delete(&Channel{})
+	tx := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled)
+	if names := getManagedChannelNames(); len(names) != 0 {
+		// channels managed by the config file can't be deleted
+		tx = tx.Where("name not in ?", names)
+	}
+	result := tx.Delete(&Channel{})
+	if result.RowsAffected > 0 {
+		if err := deleteOrphanChannelKeyHashes(); err != nil {
+			logger.SysError("failed to delete channel key hashes: " + err.Error())
+		}
+		publishCacheEvent(cacheEvent{Type: cacheEventChannel})
+	}
 	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,241 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"gorm.io/gorm"
+)
+
+const channelExportVersion = 1
+
+const (
+	ChannelImportConflictSkip      = "skip"      // keep the existing channel
+	ChannelImportConflictOverwrite = "overwrite" // update the existing channel with the same name
+	ChannelImportConflictDuplicate = "duplicate" // create a new channel anyway
+)
+
+const (
+	channelImportActionCreate    = "create"
+	channelImportActionOverwrite = "overwrite"
+	channelImportActionSkip      = "skip"
+)
+
+// ChannelExport is the file format of exported channels,
+// if Encrypted is true, the keys and configs are encrypted with the key derived from the passphrase and Salt
+type ChannelExport struct {
+	Version    int        `json:"version"`
+	ExportedAt int64      `json:"exported_at"`
+	Encrypted  bool       `json:"encrypted"`
+	Salt       string     `json:"salt,omitempty"`
+	Channels   []*Channel `json:"channels"`
+}
+
+type ChannelImportItem struct {
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	ChannelId int    `json:"channel_id,omitempty"` // the overwritten channel
+	Reason    string `json:"reason,omitempty"`
+}
+
+type ChannelImportResult struct {
+	DryRun      bool                 `json:"dry_run"`
+	Created     int                  `json:"created"`
+	Overwritten int                  `json:"overwritten"`
+	Skipped     int                  `json:"skipped"`
+	Items       []*ChannelImportItem `json:"items"`
+}
+
+// ExportChannels exports all the channels, the keys and configs are encrypted if passphrase is not empty
+func ExportChannels(passphrase string) (*ChannelExport, error) {
+	var channels []*Channel
+	err := DB.Order("id asc").Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	export := &ChannelExport{
+		Version:    channelExportVersion,
+		ExportedAt: helper.GetTimestamp(),
+		Channels:   channels,
+	}
+	if passphrase == "" {
+		return export, nil
+	}
+	salt, err := common.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := common.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		channel.Key, err = common.EncryptAESGCM(key, channel.Key)
+		if err != nil {
+			return nil, err
+		}
+		if channel.Config != "" {
+			channel.Config, err = common.EncryptAESGCM(key, channel.Config)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	export.Encrypted = true
+	export.Salt = base64.StdEncoding.EncodeToString(salt)
+	return export, nil
+}
+
+// decryptSecrets decrypts the keys and configs in place, all of them must be decrypted before anything is imported
+func (export *ChannelExport) decryptSecrets(passphrase string) error {
+	if !export.Encrypted {
+		return nil
+	}
+	if passphrase == "" {
+		return errors.New("导出文件已加密，请提供口令")
+	}
+	salt, err := base64.StdEncoding.DecodeString(export.Salt)
+	if err != nil {
+		return errors.New("导出文件的 salt 无效")
+	}
+	key, err := common.DeriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	for _, channel := range export.Channels {
+		channel.Key, err = common.DecryptAESGCM(key, channel.Key)
+		if err != nil {
+			return errors.New("口令错误或导出文件已损坏")
+		}
+		if channel.Config != "" {
+			channel.Config, err = common.DecryptAESGCM(key, channel.Config)
+			if err != nil {
+				return errors.New("口令错误或导出文件已损坏")
+			}
+		}
+	}
+	export.Encrypted = false
+	return nil
+}
+
+// ImportChannels imports the exported channels, channels are matched by name,
+// when there are several channels with the same name, they are matched in the order of id.
+// Nothing is written if dryRun is true.
+func ImportChannels(export *ChannelExport, passphrase string, conflict string, dryRun bool) (*ChannelImportResult, error) {
+	if export.Version != channelExportVersion {
+		return nil, fmt.Errorf("不支持的导出文件版本：%d", export.Version)
+	}
+	switch conflict {
+	case "":
+		conflict = ChannelImportConflictSkip
+	case ChannelImportConflictSkip, ChannelImportConflictOverwrite, ChannelImportConflictDuplicate:
+	default:
+		return nil, fmt.Errorf("无效的冲突处理方式：%s", conflict)
+	}
+	for i, channel := range export.Channels {
+		if channel == nil || channel.Name == "" || channel.Key == "" {
+			return nil, fmt.Errorf("第 %d 个渠道缺少名称或密钥", i+1)
+		}
+	}
+	err := export.decryptSecrets(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var existingChannels []*Channel
+	err = DB.Select("id", "name").Order("id asc").Find(&existingChannels).Error
+	if err != nil {
+		return nil, err
+	}
+	existingIds := make(map[string][]int)
+	for _, channel := range existingChannels {
+		existingIds[channel.Name] = append(existingIds[channel.Name], channel.Id)
+	}
+
+	result := &ChannelImportResult{DryRun: dryRun}
+	var newChannels []Channel
+	var overwrittenChannels []*Channel
+	now := helper.GetTimestamp()
+	for _, channel := range export.Channels {
+		item := &ChannelImportItem{Name: channel.Name}
+		result.Items = append(result.Items, item)
+		// runtime states are not imported
+		channel.Id = 0
+		channel.CreatedTime = now
+		channel.TestTime = 0
+		channel.ResponseTime = 0
+		channel.Balance = 0
+		channel.BalanceUpdatedTime = 0
+		channel.UsedQuota = 0
+		if channel.Status == ChannelStatusUnknown {
+			channel.Status = ChannelStatusEnabled
+		}
+		if IsChannelManaged(channel.Name) {
+			item.Action = channelImportActionSkip
+			item.Reason = ErrManagedByConfigFile.Error()
+			result.Skipped++
+			continue
+		}
+		ids := existingIds[channel.Name]
+		if len(ids) == 0 || conflict == ChannelImportConflictDuplicate {
+			item.Action = channelImportActionCreate
+			newChannels = append(newChannels, *channel)
+			result.Created++
+			continue
+		}
+		if conflict == ChannelImportConflictSkip {
+			item.Action = channelImportActionSkip
+			item.Reason = "已存在同名渠道"
+			result.Skipped++
+			continue
+		}
+		item.Action = channelImportActionOverwrite
+		item.ChannelId = ids[0]
+		existingIds[channel.Name] = ids[1:]
+		channel.Id = ids[0]
+		overwrittenChannels = append(overwrittenChannels, channel)
+		result.Overwritten++
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	// nothing is imported if any of the channels fails
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, channel := range overwrittenChannels {
+			encryptedChannel, err := channel.withEncryptedSecrets()
+			if err != nil {
+				return err
+			}
+			err = tx.Model(encryptedChannel).Select("type", "key", "status", "name", "weight", "base_url", "other", "models",
+				"group", "model_mapping", "priority", "config", "system_prompt").Updates(encryptedChannel).Error
+			if err != nil {
+				return err
+			}
+			err = channel.updateAbilities(tx)
+			if err != nil {
+				return err
+			}
+			err = updateChannelKeyHashes(tx, channel.Id, channel.Key)
+			if err != nil {
+				return err
+			}
+		}
+		if len(newChannels) > 0 {
+			return insertChannels(tx, newChannels)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range overwrittenChannels {
+		channel.publishCacheEvent()
+	}
+	for _, channel := range newChannels {
+		channel.publishCacheEvent()
+	}
+	return result, nil
+}
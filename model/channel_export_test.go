@@ -0,0 +1,98 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestChannel(t *testing.T, name string, key string) *Channel {
+	channel := &Channel{Type: 1, Name: name, Key: key, Models: "gpt-4o", Group: "default", Config: `{"region":"us"}`, Status: ChannelStatusEnabled}
+	require.NoError(t, channel.Insert())
+	return channel
+}
+
+func TestExportAndImportChannels(t *testing.T) {
+	setupTestDB(t)
+	createTestChannel(t, "openai", "sk-openai")
+	createTestChannel(t, "azure", "sk-azure")
+
+	export, err := ExportChannels("passphrase")
+	require.NoError(t, err)
+	assert.True(t, export.Encrypted)
+	require.Len(t, export.Channels, 2)
+	assert.NotEqual(t, "sk-openai", export.Channels[0].Key)
+	assert.NotEqual(t, `{"region":"us"}`, export.Channels[0].Config)
+
+	// the wrong passphrase is rejected before anything is written
+	_, err = ImportChannels(export, "wrong", ChannelImportConflictSkip, false)
+	assert.Error(t, err)
+
+	tests := []struct {
+		conflict    string
+		created     int
+		overwritten int
+		skipped     int
+		channels    int64
+	}{
+		{ChannelImportConflictSkip, 0, 0, 2, 2},
+		{ChannelImportConflictOverwrite, 0, 2, 0, 2},
+		{ChannelImportConflictDuplicate, 2, 0, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.conflict, func(t *testing.T) {
+			export, err := ExportChannels("passphrase")
+			require.NoError(t, err)
+			export.Channels = export.Channels[:2]
+			// dry run reports the same result without writing
+			result, err := ImportChannels(export, "passphrase", tt.conflict, true)
+			require.NoError(t, err)
+			assert.Equal(t, tt.created, result.Created)
+			export, err = ExportChannels("passphrase")
+			require.NoError(t, err)
+			export.Channels = export.Channels[:2]
+			result, err = ImportChannels(export, "passphrase", tt.conflict, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.created, result.Created)
+			assert.Equal(t, tt.overwritten, result.Overwritten)
+			assert.Equal(t, tt.skipped, result.Skipped)
+			var count int64
+			DB.Model(&Channel{}).Count(&count)
+			assert.Equal(t, tt.channels, count)
+		})
+	}
+
+	channels, err := SearchChannels("openai")
+	require.NoError(t, err)
+	require.NotEmpty(t, channels)
+	channel, err := GetChannelById(channels[len(channels)-1].Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-openai", channel.Key)
+	assert.Equal(t, `{"region":"us"}`, channel.Config)
+}
+
+func TestImportChannelsRollsBack(t *testing.T) {
+	setupTestDB(t)
+	origin := createTestChannel(t, "openai", "sk-openai")
+
+	export, err := ExportChannels("")
+	require.NoError(t, err)
+	export.Channels[0].Models = "gpt-4o-mini"
+	export.Channels[0].Key = "sk-overwritten"
+	// the duplicated model fails the abilities of the new channel after the overwrite
+	export.Channels = append(export.Channels, &Channel{Type: 1, Name: "broken", Key: "sk-broken", Models: "gpt-4o,gpt-4o", Group: "default", Status: ChannelStatusEnabled})
+	_, err = ImportChannels(export, "", ChannelImportConflictOverwrite, false)
+	require.Error(t, err)
+
+	var count int64
+	DB.Model(&Channel{}).Count(&count)
+	assert.EqualValues(t, 1, count)
+	channel, err := GetChannelById(origin.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", channel.Models)
+	assert.Equal(t, "sk-openai", channel.Key)
+	var models []string
+	DB.Model(&Ability{}).Where("channel_id = ?", origin.Id).Pluck("model", &models)
+	assert.Equal(t, []string{"gpt-4o"}, models)
+}
@@ -0,0 +1,348 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+// Channel keys and configs are protected by envelope encryption: every value is encrypted with a random data key,
+// and the data key is encrypted (wrapped) with the master key, so rotating the master key only rewraps the data keys.
+// The stored format is enc:v1:<master key id>:<wrapped data key>:<ciphertext>
+const channelSecretPrefix = "enc:v1:"
+
+type channelSecretKey struct {
+	id  string
+	key []byte
+}
+
+var currentChannelSecretKey *channelSecretKey
+var channelSecretKeys = make(map[string]*channelSecretKey)
+
+func newChannelSecretKey(material string) *channelSecretKey {
+	key := sha256.Sum256([]byte(material))
+	id := sha256.Sum256(key[:])
+	return &channelSecretKey{
+		id:  hex.EncodeToString(id[:4]),
+		key: key[:],
+	}
+}
+
+// InitChannelSecretKeys loads the master keys, channel secrets are stored in plaintext if no master key is set
+func InitChannelSecretKeys() error {
+	material := config.ChannelSecretKey
+	if config.ChannelSecretKeyFile != "" {
+		data, err := os.ReadFile(config.ChannelSecretKeyFile)
+		if err != nil {
+			return err
+		}
+		material = strings.TrimSpace(string(data))
+	}
+	if material != "" {
+		currentChannelSecretKey = newChannelSecretKey(material)
+		channelSecretKeys[currentChannelSecretKey.id] = currentChannelSecretKey
+		logger.SysLog("channel secret encryption enabled, master key id: " + currentChannelSecretKey.id)
+	}
+	for _, oldMaterial := range strings.Split(config.ChannelSecretOldKeys, ",") {
+		oldMaterial = strings.TrimSpace(oldMaterial)
+		if oldMaterial == "" {
+			continue
+		}
+		key := newChannelSecretKey(oldMaterial)
+		channelSecretKeys[key.id] = key
+	}
+	return nil
+}
+
+func isEncryptedChannelSecret(value string) bool {
+	return strings.HasPrefix(value, channelSecretPrefix)
+}
+
+func encryptChannelSecret(value string) (string, error) {
+	if value == "" || currentChannelSecretKey == nil || isEncryptedChannelSecret(value) {
+		return value, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	ciphertext, err := common.EncryptAESGCM(dataKey, value)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := common.EncryptAESGCM(currentChannelSecretKey.key, string(dataKey))
+	if err != nil {
+		return "", err
+	}
+	return channelSecretPrefix + currentChannelSecretKey.id + ":" + wrappedKey + ":" + ciphertext, nil
+}
+
+// parseChannelSecret returns the master key, the unwrapped data key and the ciphertext
+func parseChannelSecret(value string) (*channelSecretKey, []byte, string, error) {
+	parts := strings.Split(strings.TrimPrefix(value, channelSecretPrefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, "", errors.New("invalid encrypted channel secret")
+	}
+	masterKey, ok := channelSecretKeys[parts[0]]
+	if !ok {
+		return nil, nil, "", fmt.Errorf("master key %s of channel secret not found", parts[0])
+	}
+	dataKey, err := common.DecryptAESGCM(masterKey.key, parts[1])
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return masterKey, []byte(dataKey), parts[2], nil
+}
+
+func decryptChannelSecret(value string) (string, error) {
+	if !isEncryptedChannelSecret(value) {
+		return value, nil
+	}
+	_, dataKey, ciphertext, err := parseChannelSecret(value)
+	if err != nil {
+		return "", err
+	}
+	return common.DecryptAESGCM(dataKey, ciphertext)
+}
+
+// rotateChannelSecret encrypts the plaintext value, or rewraps the data key with the current master key
+func rotateChannelSecret(value string) (string, error) {
+	if currentChannelSecretKey == nil {
+		return "", errors.New("master key is not set")
+	}
+	if !isEncryptedChannelSecret(value) {
+		return encryptChannelSecret(value)
+	}
+	masterKey, dataKey, ciphertext, err := parseChannelSecret(value)
+	if err != nil {
+		return "", err
+	}
+	if masterKey == currentChannelSecretKey {
+		return value, nil
+	}
+	wrappedKey, err := common.EncryptAESGCM(currentChannelSecretKey.key, string(dataKey))
+	if err != nil {
+		return "", err
+	}
+	return channelSecretPrefix + currentChannelSecretKey.id + ":" + wrappedKey + ":" + ciphertext, nil
+}
+
+// verifyChannelSecrets makes sure that all the encrypted secrets can be decrypted with the loaded master keys,
+// so that a missing or wrong master key is reported on startup instead of channels failing with empty keys
+func verifyChannelSecrets() error {
+	// scan into another struct, so that the values are not decrypted by AfterFind
+	var rows []struct {
+		Id     int
+		Key    string
+		Config string
+	}
+	err := DB.Model(&Channel{}).Select("id", "key", "config").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	var failedIds []string
+	var lastErr error
+	for _, row := range rows {
+		for _, value := range []string{row.Key, row.Config} {
+			if _, err = decryptChannelSecret(value); err != nil {
+				lastErr = err
+				failedIds = append(failedIds, strconv.Itoa(row.Id))
+				break
+			}
+		}
+	}
+	if len(failedIds) != 0 {
+		return fmt.Errorf("failed to decrypt secrets of channels %s: %s, please check CHANNEL_SECRET_KEY and CHANNEL_SECRET_OLD_KEYS",
+			strings.Join(failedIds, ","), lastErr.Error())
+	}
+	return nil
+}
+
+// ChannelKeyHash is the keyed hash of a line of a channel key, so that the channels can be searched by key
+// without decrypting all of them. The hash key is derived from the master key, KeyId tells which one.
+type ChannelKeyHash struct {
+	Id        int    `json:"id"`
+	ChannelId int    `json:"channel_id" gorm:"index"`
+	KeyId     string `json:"key_id" gorm:"type:varchar(16);default:''"`
+	Hash      string `json:"hash" gorm:"type:varchar(64);index"`
+}
+
+// channelKeyHashKey returns the id and the HMAC key of the key hashes, the keys are only hashed if there is no master key
+func channelKeyHashKey() (string, []byte) {
+	if currentChannelSecretKey == nil {
+		return "", []byte("one-api channel key")
+	}
+	key := sha256.Sum256(append([]byte("one-api channel key hash:"), currentChannelSecretKey.key...))
+	return currentChannelSecretKey.id, key[:]
+}
+
+func hashChannelKey(key string) string {
+	_, hashKey := channelKeyHashKey()
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// updateChannelKeyHashes replaces the key hashes of the channel with the ones of the plaintext key
+func updateChannelKeyHashes(tx *gorm.DB, channelId int, key string) error {
+	err := tx.Where("channel_id = ?", channelId).Delete(&ChannelKeyHash{}).Error
+	if err != nil {
+		return err
+	}
+	keyId, _ := channelKeyHashKey()
+	var hashes []*ChannelKeyHash
+	hashed := make(map[string]bool)
+	for _, line := range strings.Split(key, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || hashed[line] {
+			continue
+		}
+		hashed[line] = true
+		hashes = append(hashes, &ChannelKeyHash{ChannelId: channelId, KeyId: keyId, Hash: hashChannelKey(line)})
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(hashes, 100).Error
+}
+
+// deleteOrphanChannelKeyHashes deletes the key hashes of the deleted channels
+func deleteOrphanChannelKeyHashes() error {
+	return DB.Where("channel_id not in (?)", DB.Model(&Channel{}).Select("id")).Delete(&ChannelKeyHash{}).Error
+}
+
+// migrateChannelKeyHashes rebuilds the key hashes if the master key is changed or the channels haven't been hashed,
+// the channels whose secrets can't be decrypted are skipped, they are reported by verifyChannelSecrets
+func migrateChannelKeyHashes() error {
+	keyId, _ := channelKeyHashKey()
+	var staleCount int64
+	err := DB.Model(&ChannelKeyHash{}).Where("key_id <> ?", keyId).Count(&staleCount).Error
+	if err != nil {
+		return err
+	}
+	var channelCount, hashedCount int64
+	err = DB.Model(&Channel{}).Not(map[string]any{"key": ""}).Count(&channelCount).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&ChannelKeyHash{}).Distinct("channel_id").Count(&hashedCount).Error
+	if err != nil {
+		return err
+	}
+	if staleCount == 0 && channelCount == hashedCount {
+		return nil
+	}
+	logger.SysLog("rebuilding channel key hashes")
+	var rows []struct {
+		Id  int
+		Key string
+	}
+	err = DB.Model(&Channel{}).Select("id", "key").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&ChannelKeyHash{}).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			key, err := decryptChannelSecret(row.Key)
+			if err != nil {
+				continue
+			}
+			err = updateChannelKeyHashes(tx, row.Id, key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// searchChannelIdsByKey matches the keyword against every line of the keys by the key hashes
+func searchChannelIdsByKey(keyword string) ([]int, error) {
+	var ids []int
+	err := DB.Model(&ChannelKeyHash{}).Where("hash = ?", hashChannelKey(strings.TrimSpace(keyword))).Distinct().Pluck("channel_id", &ids).Error
+	return ids, err
+}
+
+// AfterFind decrypts the secrets, so that channels are always in plaintext in memory
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	var err error
+	channel.Key, err = decryptChannelSecret(channel.Key)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to decrypt key of channel %d: %s", channel.Id, err.Error()))
+	}
+	channel.Config, err = decryptChannelSecret(channel.Config)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to decrypt config of channel %d: %s", channel.Id, err.Error()))
+	}
+	return nil
+}
+
+// withEncryptedSecrets returns a copy to be written into database, the channel itself is not changed
+// because it may be shared by the channel cache
+func (channel *Channel) withEncryptedSecrets() (*Channel, error) {
+	encrypted := *channel
+	var err error
+	encrypted.Key, err = encryptChannelSecret(channel.Key)
+	if err != nil {
+		return nil, err
+	}
+	encrypted.Config, err = encryptChannelSecret(channel.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &encrypted, nil
+}
+
+// RotateChannelSecrets encrypts the plaintext channel secrets with the current master key,
+// and rewraps the ones encrypted with old master keys, it returns the number of updated channels
+func RotateChannelSecrets() (int, error) {
+	if currentChannelSecretKey == nil {
+		return 0, errors.New("CHANNEL_SECRET_KEY is not set")
+	}
+	// scan into another struct, so that the values are not decrypted by AfterFind
+	var rows []struct {
+		Id     int
+		Key    string
+		Config string
+	}
+	err := DB.Model(&Channel{}).Select("id", "key", "config").Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, row := range rows {
+		key, err := rotateChannelSecret(row.Key)
+		if err != nil {
+			return updated, fmt.Errorf("channel %d: %s", row.Id, err.Error())
+		}
+		cfg, err := rotateChannelSecret(row.Config)
+		if err != nil {
+			return updated, fmt.Errorf("channel %d: %s", row.Id, err.Error())
+		}
+		if key == row.Key && cfg == row.Config {
+			continue
+		}
+		err = DB.Model(&Channel{}).Where("id = ?", row.Id).Updates(map[string]any{"key": key, "config": cfg}).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
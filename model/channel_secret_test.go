@@ -0,0 +1,140 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setChannelSecretKeys resets the master keys, they are restored after the test
+func setChannelSecretKeys(t *testing.T, key string, oldKeys string) {
+	currentChannelSecretKey = nil
+	channelSecretKeys = make(map[string]*channelSecretKey)
+	config.ChannelSecretKey = key
+	config.ChannelSecretOldKeys = oldKeys
+	require.NoError(t, InitChannelSecretKeys())
+	t.Cleanup(func() {
+		currentChannelSecretKey = nil
+		channelSecretKeys = make(map[string]*channelSecretKey)
+		config.ChannelSecretKey = ""
+		config.ChannelSecretOldKeys = ""
+	})
+}
+
+func TestChannelSecretRoundTrip(t *testing.T) {
+	setChannelSecretKeys(t, "master-key", "")
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"key", "sk-123456"},
+		{"multiple keys", "sk-1\nsk-2"},
+		{"config", `{"region":"us-east-1","ak":"AK","sk":"SK"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := encryptChannelSecret(tt.value)
+			require.NoError(t, err)
+			if tt.value == "" {
+				assert.Equal(t, "", encrypted)
+				return
+			}
+			assert.True(t, isEncryptedChannelSecret(encrypted))
+			assert.NotContains(t, encrypted, tt.value)
+			// encrypting twice is a no-op
+			again, err := encryptChannelSecret(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, encrypted, again)
+			decrypted, err := decryptChannelSecret(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, tt.value, decrypted)
+		})
+	}
+	// plaintext values are returned as is
+	decrypted, err := decryptChannelSecret("sk-plaintext")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plaintext", decrypted)
+}
+
+func TestChannelSecretRotation(t *testing.T) {
+	setupTestDB(t)
+	setChannelSecretKeys(t, "old-key", "")
+	channel := createTestChannel(t, "openai", "sk-rotate")
+	var stored string
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", channel.Id).Select("key").Find(&stored).Error)
+	assert.True(t, isEncryptedChannelSecret(stored))
+
+	// the new key can't decrypt the secrets without the old key
+	setChannelSecretKeys(t, "new-key", "")
+	assert.Error(t, verifyChannelSecrets())
+
+	setChannelSecretKeys(t, "new-key", "old-key")
+	require.NoError(t, verifyChannelSecrets())
+	updated, err := RotateChannelSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	// the old key can be removed after rotation
+	setChannelSecretKeys(t, "new-key", "")
+	require.NoError(t, verifyChannelSecrets())
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-rotate", loaded.Key)
+	assert.Equal(t, `{"region":"us"}`, loaded.Config)
+
+	// channels are found by the decrypted key
+	createTestChannel(t, "azure", "sk-other\nsk-azure")
+	channels, err := SearchChannels("sk-azure")
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "azure", channels[0].Name)
+	assert.Empty(t, channels[0].Key)
+}
+
+func TestSearchChannelsByKeyHash(t *testing.T) {
+	setupTestDB(t)
+	setChannelSecretKeys(t, "old-key", "")
+	channel := createTestChannel(t, "openai", "sk-1\n sk-2 \n\nsk-1")
+	searchNames := func(keyword string) []string {
+		channels, err := SearchChannels(keyword)
+		require.NoError(t, err)
+		var names []string
+		for _, channel := range channels {
+			names = append(names, channel.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"openai"}, searchNames("sk-2"))
+	var hashes []ChannelKeyHash
+	require.NoError(t, DB.Find(&hashes).Error)
+	require.Len(t, hashes, 2)
+	for _, hash := range hashes {
+		assert.NotContains(t, hash.Hash, "sk-")
+		assert.Equal(t, currentChannelSecretKey.id, hash.KeyId)
+	}
+
+	// the hashes follow the key
+	channel.Key = "sk-3"
+	require.NoError(t, channel.Update())
+	assert.Empty(t, searchNames("sk-1"))
+	assert.Equal(t, []string{"openai"}, searchNames("sk-3"))
+
+	// the hashes are rebuilt with the new master key
+	setChannelSecretKeys(t, "new-key", "old-key")
+	assert.Empty(t, searchNames("sk-3"))
+	require.NoError(t, migrateChannelKeyHashes())
+	assert.Equal(t, []string{"openai"}, searchNames("sk-3"))
+
+	// the missing hashes are rebuilt too
+	require.NoError(t, DB.Where("1 = 1").Delete(&ChannelKeyHash{}).Error)
+	require.NoError(t, migrateChannelKeyHashes())
+	assert.Equal(t, []string{"openai"}, searchNames("sk-3"))
+
+	require.NoError(t, channel.Delete())
+	var count int64
+	require.NoError(t, DB.Model(&ChannelKeyHash{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLowBalancePriority(t *testing.T) {
+	setupTestDB(t)
+	channel := createTestChannel(t, "openai", "sk-balance")
+	priority := int64(10)
+	channel.Priority = &priority
+	require.NoError(t, channel.Update())
+	getPriorities := func() (int64, *int64, []int64) {
+		stored, err := GetChannelById(channel.Id, true)
+		require.NoError(t, err)
+		var abilityPriorities []int64
+		require.NoError(t, DB.Model(&Ability{}).Where("channel_id = ?", channel.Id).Pluck("priority", &abilityPriorities).Error)
+		return stored.GetPriority(), stored.PriorityBeforeLowBalance, abilityPriorities
+	}
+	lowPriority := int64(-5)
+
+	// the priority is kept and restored
+	require.NoError(t, channel.MarkLowBalance(&lowPriority))
+	current, before, abilities := getPriorities()
+	assert.EqualValues(t, -5, current)
+	require.NotNil(t, before)
+	assert.EqualValues(t, 10, *before)
+	assert.Equal(t, []int64{-5}, abilities)
+	require.NoError(t, channel.ClearLowBalance())
+	current, before, abilities = getPriorities()
+	assert.EqualValues(t, 10, current)
+	assert.Nil(t, before)
+	assert.Equal(t, []int64{10}, abilities)
+
+	// editing other fields keeps the priority to be restored
+	channel, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.NoError(t, channel.MarkLowBalance(&lowPriority))
+	channel, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	channel.Name = "renamed"
+	require.NoError(t, channel.Update())
+	require.NoError(t, channel.ClearLowBalance())
+	current, _, abilities = getPriorities()
+	assert.EqualValues(t, 10, current)
+	assert.Equal(t, []int64{10}, abilities)
+
+	// the priority edited during the low balance is not restored
+	channel, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.NoError(t, channel.MarkLowBalance(&lowPriority))
+	channel, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	edited := int64(3)
+	channel.Priority = &edited
+	require.NoError(t, channel.Update())
+	require.NoError(t, channel.ClearLowBalance())
+	current, before, abilities = getPriorities()
+	assert.EqualValues(t, 3, current)
+	assert.Nil(t, before)
+	assert.Equal(t, []int64{3}, abilities)
+	stored, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.Zero(t, stored.LowBalanceTime)
+
+	// the priority is not raised by the low balance
+	high := int64(20)
+	require.NoError(t, stored.MarkLowBalance(&high))
+	current, before, _ = getPriorities()
+	assert.EqualValues(t, 3, current)
+	assert.Nil(t, before)
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/songquanpeng/one-api/common/helper"
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelTestModeChat       = "chat"
+	ChannelTestModeStream     = "stream"
+	ChannelTestModeEmbeddings = "embeddings"
+	ChannelTestModeTools      = "tools"
+)
+
+var ChannelTestModes = []string{ChannelTestModeChat, ChannelTestModeStream, ChannelTestModeEmbeddings, ChannelTestModeTools}
+
+// ChannelTestResult is the result of testing a model of a channel in a mode, only the latest result is kept
+type ChannelTestResult struct {
+	Id        int    `json:"id"`
+	ChannelId int    `json:"channel_id" gorm:"index:idx_channel_test_result"`
+	Model     string `json:"model" gorm:"index:idx_channel_test_result"`
+	Mode      string `json:"mode" gorm:"index:idx_channel_test_result"`
+	Success   bool   `json:"success"`
+	Latency   int64  `json:"latency"` // in milliseconds
+	Error     string `json:"error" gorm:"type:text"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+// RecordChannelTestResult replaces the previous result of the same model and mode
+func RecordChannelTestResult(result *ChannelTestResult) error {
+	result.CreatedAt = helper.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("channel_id = ? and model = ? and mode = ?", result.ChannelId, result.Model, result.Mode).Delete(&ChannelTestResult{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(result).Error
+	})
+}
+
+func GetChannelTestResults(channelId int) (results []*ChannelTestResult, err error) {
+	err = DB.Where("channel_id = ?", channelId).Order("model asc, mode asc").Find(&results).Error
+	return results, err
+}
+
+func DeleteChannelTestResults(channelId int) error {
+	return DB.Where("channel_id = ?", channelId).Delete(&ChannelTestResult{}).Error
+}
@@ -0,0 +1,445 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the declarative configuration loaded from CONFIG_FILE, in YAML or TOML format.
+// Environment variables like ${OPENAI_KEY} in the file are expanded before parsing, "$VAR" is not expanded.
+type ConfigFile struct {
+	// ReadOnly blocks the edits of managed options and channels from the web UI and API
+	ReadOnly        bool                `yaml:"read_only" toml:"read_only"`
+	Options         map[string]any      `yaml:"options" toml:"options"`
+	ModelRatio      map[string]float64  `yaml:"model_ratio" toml:"model_ratio"`
+	CompletionRatio map[string]float64  `yaml:"completion_ratio" toml:"completion_ratio"`
+	GroupRatio      map[string]float64  `yaml:"group_ratio" toml:"group_ratio"`
+	Channels        []ConfigFileChannel `yaml:"channels" toml:"channels"`
+}
+
+// ConfigFileChannel is identified by its name, channels not in the file are left untouched
+type ConfigFileChannel struct {
+	Name         string            `yaml:"name" toml:"name"`
+	Type         int               `yaml:"type" toml:"type"`
+	Key          string            `yaml:"key" toml:"key"`
+	BaseURL      string            `yaml:"base_url" toml:"base_url"`
+	Models       []string          `yaml:"models" toml:"models"`
+	Groups       []string          `yaml:"groups" toml:"groups"`
+	ModelMapping map[string]string `yaml:"model_mapping" toml:"model_mapping"`
+	Priority     int64             `yaml:"priority" toml:"priority"`
+	Weight       uint              `yaml:"weight" toml:"weight"`
+	Config       map[string]any    `yaml:"config" toml:"config"`
+	SystemPrompt string            `yaml:"system_prompt" toml:"system_prompt"`
+	// Enabled is optional, if not set, the status is kept so that automatically disabled channels stay disabled
+	Enabled *bool `yaml:"enabled" toml:"enabled"`
+}
+
+type managedConfig struct {
+	readOnly bool
+	options  map[string]string
+	channels map[string]*Channel
+}
+
+var managed managedConfig
+var managedLock sync.RWMutex
+
+var ErrManagedByConfigFile = errors.New("该配置由配置文件管理，无法修改")
+
+// IsOptionManaged tells whether the option can't be changed because it's managed by the config file
+func IsOptionManaged(key string) bool {
+	managedLock.RLock()
+	defer managedLock.RUnlock()
+	_, ok := managed.options[key]
+	return managed.readOnly && ok
+}
+
+// IsChannelManaged tells whether the channel can't be changed because it's managed by the config file
+func IsChannelManaged(name string) bool {
+	managedLock.RLock()
+	defer managedLock.RUnlock()
+	_, ok := managed.channels[name]
+	return managed.readOnly && ok
+}
+
+func getManagedChannelNames() []string {
+	managedLock.RLock()
+	defer managedLock.RUnlock()
+	if !managed.readOnly {
+		return nil
+	}
+	names := make([]string, 0, len(managed.channels))
+	for name := range managed.channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+// envPattern only matches the braced form, so that values like "$1" in model mappings and keys are kept
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} with the environment variable,
+// unset variables are kept as is, e.g. the "${name}" capture group reference in model mappings
+func expandEnv(data string) string {
+	return envPattern.ReplaceAllStringFunc(data, func(match string) string {
+		if value, ok := os.LookupEnv(match[2 : len(match)-1]); ok {
+			return value
+		}
+		return match
+	})
+}
+
+func parseConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = []byte(expandEnv(string(data)))
+	var file ConfigFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&file)
+	case ".toml":
+		decoder := toml.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %s, only YAML and TOML are supported", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func configValue2String(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		// nested values like ratios are stored as JSON
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
+
+func validateRatios(name string, ratios map[string]float64) error {
+	for key, ratio := range ratios {
+		if ratio < 0 {
+			return fmt.Errorf("%s of %s must not be negative", name, key)
+		}
+	}
+	return nil
+}
+
+// toManagedConfig validates the config file and converts it to the options and channels to be applied
+func (file *ConfigFile) toManagedConfig() (*managedConfig, error) {
+	result := &managedConfig{
+		readOnly: file.ReadOnly,
+		options:  make(map[string]string),
+		channels: make(map[string]*Channel),
+	}
+	for key, value := range file.Options {
+		stringValue, err := configValue2String(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of option %s: %s", key, err.Error())
+		}
+		if strings.HasSuffix(key, "Enabled") && stringValue != "true" && stringValue != "false" {
+			return nil, fmt.Errorf("option %s must be true or false", key)
+		}
+		if key == "Theme" && !config.ValidThemes[stringValue] {
+			return nil, fmt.Errorf("invalid theme %s", stringValue)
+		}
+		config.OptionMapRWMutex.RLock()
+		_, ok := config.OptionMap[key]
+		config.OptionMapRWMutex.RUnlock()
+		if !ok {
+			logger.SysLog(fmt.Sprintf("config file: option %s is unknown, please check the spelling", key))
+		}
+		result.options[key] = stringValue
+	}
+	ratios := []struct {
+		key    string
+		ratios map[string]float64
+	}{
+		{"ModelRatio", file.ModelRatio},
+		{"CompletionRatio", file.CompletionRatio},
+		{"GroupRatio", file.GroupRatio},
+	}
+	for _, ratio := range ratios {
+		if ratio.ratios == nil {
+			continue
+		}
+		if _, ok := result.options[ratio.key]; ok {
+			return nil, fmt.Errorf("%s is set in both options and ratios", ratio.key)
+		}
+		err := validateRatios(ratio.key, ratio.ratios)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(ratio.ratios)
+		if err != nil {
+			return nil, err
+		}
+		result.options[ratio.key] = string(data)
+	}
+	for i := range file.Channels {
+		fileChannel := file.Channels[i]
+		if fileChannel.Name == "" {
+			return nil, fmt.Errorf("name of channel #%d is empty", i+1)
+		}
+		if _, ok := result.channels[fileChannel.Name]; ok {
+			return nil, fmt.Errorf("duplicated channel name %s", fileChannel.Name)
+		}
+		if fileChannel.Type <= channeltype.Unknown || fileChannel.Type >= channeltype.Dummy {
+			return nil, fmt.Errorf("invalid type %d of channel %s", fileChannel.Type, fileChannel.Name)
+		}
+		if fileChannel.Key == "" {
+			return nil, fmt.Errorf("key of channel %s is empty", fileChannel.Name)
+		}
+		if len(fileChannel.Models) == 0 {
+			return nil, fmt.Errorf("models of channel %s is empty", fileChannel.Name)
+		}
+		groups := fileChannel.Groups
+		if len(groups) == 0 {
+			groups = []string{"default"}
+		}
+		channel := &Channel{
+			Type:         fileChannel.Type,
+			Key:          fileChannel.Key,
+			Name:         fileChannel.Name,
+			Weight:       &fileChannel.Weight,
+			BaseURL:      &fileChannel.BaseURL,
+			Models:       strings.Join(fileChannel.Models, ","),
+			Group:        strings.Join(groups, ","),
+			Priority:     &fileChannel.Priority,
+			SystemPrompt: &fileChannel.SystemPrompt,
+		}
+		modelMapping := ""
+		if len(fileChannel.ModelMapping) != 0 {
+			data, err := json.Marshal(fileChannel.ModelMapping)
+			if err != nil {
+				return nil, err
+			}
+			modelMapping = string(data)
+		}
+		channel.ModelMapping = &modelMapping
+		if len(fileChannel.Config) != 0 {
+			data, err := json.Marshal(fileChannel.Config)
+			if err != nil {
+				return nil, err
+			}
+			channel.Config = string(data)
+		}
+		if fileChannel.Enabled != nil {
+			channel.Status = ChannelStatusManuallyDisabled
+			if *fileChannel.Enabled {
+				channel.Status = ChannelStatusEnabled
+			}
+		}
+		result.channels[channel.Name] = channel
+	}
+	return result, nil
+}
+
+func applyManagedOptions(options map[string]string) error {
+	current, err := AllOption()
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string, len(current))
+	for _, option := range current {
+		values[option.Key] = option.Value
+	}
+	for key, value := range options {
+		if dbValue, ok := values[key]; ok && dbValue == value {
+			continue
+		}
+		logger.SysLog("config file: updating option " + key)
+		err = UpdateOption(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to update option %s: %s", key, err.Error())
+		}
+	}
+	return nil
+}
+
+var managedChannelFields = []string{"type", "key", "status", "weight", "base_url", "models", "group", "model_mapping", "priority", "config", "system_prompt"}
+
+func isManagedChannelChanged(current *Channel, desired *Channel) bool {
+	return current.Type != desired.Type ||
+		current.Key != desired.Key ||
+		current.Status != desired.Status ||
+		current.Weight == nil || *current.Weight != *desired.Weight ||
+		current.GetBaseURL() != desired.GetBaseURL() ||
+		current.Models != desired.Models ||
+		current.Group != desired.Group ||
+		current.ModelMapping == nil || *current.ModelMapping != *desired.ModelMapping ||
+		current.GetPriority() != desired.GetPriority() ||
+		current.Config != desired.Config ||
+		current.SystemPrompt == nil || *current.SystemPrompt != *desired.SystemPrompt
+}
+
+func applyManagedChannels(channels map[string]*Channel) error {
+	if len(channels) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	var existing []*Channel
+	err := DB.Where("name in ?", names).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	name2channel := make(map[string]*Channel, len(existing))
+	for _, channel := range existing {
+		if _, ok := name2channel[channel.Name]; ok {
+			return fmt.Errorf("there are multiple channels named %s in database", channel.Name)
+		}
+		name2channel[channel.Name] = channel
+	}
+	for name, desired := range channels {
+		channel := *desired
+		current, ok := name2channel[name]
+		if !ok {
+			if channel.Status == ChannelStatusUnknown {
+				channel.Status = ChannelStatusEnabled
+			}
+			channel.CreatedTime = helper.GetTimestamp()
+			logger.SysLog("config file: creating channel " + name)
+			err = channel.Insert()
+			if err != nil {
+				return fmt.Errorf("failed to create channel %s: %s", name, err.Error())
+			}
+			continue
+		}
+		channel.Id = current.Id
+		if channel.Status == ChannelStatusUnknown {
+			channel.Status = current.Status
+		}
+		if !isManagedChannelChanged(current, &channel) {
+			continue
+		}
+		logger.SysLog("config file: updating channel " + name)
+		encryptedChannel, err := channel.withEncryptedSecrets()
+		if err == nil {
+			err = DB.Model(encryptedChannel).Select(managedChannelFields).Updates(encryptedChannel).Error
+		}
+		if err == nil {
+			err = channel.UpdateAbilities()
+		}
+		if err == nil {
+			err = updateChannelKeyHashes(DB, channel.Id, channel.Key)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update channel %s: %s", name, err.Error())
+		}
+		channel.publishCacheEvent()
+	}
+	return nil
+}
+
+func loadConfigFile(path string) error {
+	file, err := parseConfigFile(path)
+	if err != nil {
+		return err
+	}
+	result, err := file.toManagedConfig()
+	if err != nil {
+		return err
+	}
+	// only the master node writes the database, the others get the changes by syncing
+	if config.IsMasterNode {
+		err = applyManagedOptions(result.options)
+		if err != nil {
+			return err
+		}
+		err = applyManagedChannels(result.channels)
+		if err != nil {
+			return err
+		}
+	}
+	managedLock.Lock()
+	managed = *result
+	managedLock.Unlock()
+	logger.SysLog(fmt.Sprintf("config file %s loaded, %d options and %d channels managed, read only: %t", path, len(result.options), len(result.channels), result.readOnly))
+	return nil
+}
+
+// InitConfigFile loads CONFIG_FILE if set, it must be called after InitOptionMap.
+// The file is reloaded on SIGHUP or when it's changed, invalid changes are ignored.
+func InitConfigFile() {
+	if config.ConfigFile == "" {
+		return
+	}
+	err := loadConfigFile(config.ConfigFile)
+	if err != nil {
+		logger.FatalLog("failed to load config file: " + err.Error())
+	}
+	go watchConfigFile(config.ConfigFile)
+}
+
+func getConfigFileVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+func watchConfigFile(path string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	version := getConfigFileVersion(path)
+	for {
+		select {
+		case <-hangup:
+			logger.SysLog("SIGHUP received, reloading config file")
+		case <-ticker.C:
+			newVersion := getConfigFileVersion(path)
+			if newVersion == version || newVersion == "" {
+				continue
+			}
+			logger.SysLog("config file changed, reloading")
+		}
+		version = getConfigFileVersion(path)
+		err := loadConfigFile(path)
+		if err != nil {
+			logger.SysError("failed to reload config file, keep using the previous one: " + err.Error())
+		}
+	}
+}
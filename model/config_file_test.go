@@ -0,0 +1,72 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigFileExpandEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE_TEST_KEY", "sk-from-env")
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "one-api.yaml", `
+channels:
+  - name: openai
+    type: 1
+    key: ${CONFIG_FILE_TEST_KEY}
+    base_url: https://example.com/$path
+    models: [claude-3-opus]
+    model_mapping:
+      "^claude-(.*)$": "anthropic/claude-$1"
+      "^gpt-(?P<name>.*)$": "openai/${name}"
+`},
+		{"toml", "one-api.toml", `
+[[channels]]
+name = "openai"
+type = 1
+key = "${CONFIG_FILE_TEST_KEY}"
+base_url = "https://example.com/$path"
+models = ["claude-3-opus"]
+[channels.model_mapping]
+"^claude-(.*)$" = "anthropic/claude-$1"
+"^gpt-(?P<name>.*)$" = "openai/${name}"
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+			file, err := parseConfigFile(path)
+			require.NoError(t, err)
+			require.Len(t, file.Channels, 1)
+			channel := file.Channels[0]
+			assert.Equal(t, "sk-from-env", channel.Key)
+			assert.Equal(t, "https://example.com/$path", channel.BaseURL)
+			assert.Equal(t, "anthropic/claude-$1", channel.ModelMapping["^claude-(.*)$"])
+			assert.Equal(t, "openai/${name}", channel.ModelMapping["^gpt-(?P<name>.*)$"])
+
+			managedConfig, err := file.toManagedConfig()
+			require.NoError(t, err)
+			mapping, err := ParseModelMapping(*managedConfig.channels["openai"].ModelMapping)
+			require.NoError(t, err)
+			modelName, _ := mapping.Map("claude-3-opus")
+			assert.Equal(t, "anthropic/claude-3-opus", modelName)
+			modelName, _ = mapping.Map("gpt-4o")
+			assert.Equal(t, "openai/4o", modelName)
+		})
+	}
+}
+
+func TestParseConfigFileUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "one-api.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("read_olny: true\n"), 0600))
+	_, err := parseConfigFile(path)
+	assert.Error(t, err)
+}
@@ -24,6 +24,7 @@ type Log struct {
 	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
 	ChannelId        int    `json:"channel" gorm:"index"`
+	OrganizationId   int    `json:"organization_id" gorm:"index;default:0"`
 }
 
 const (
@@ -34,9 +35,10 @@ const (
 	LogTypeSystem
 )
 
-func RecordLog(userId int, logType int, content string) {
+// RecordLog returns the id of the log, 0 if the log is not recorded
+func RecordLog(userId int, logType int, content string) int {
 	if logType == LogTypeConsume && !config.LogConsumeEnabled {
-		return
+		return 0
 	}
 	log := &Log{
 		UserId:    userId,
@@ -49,9 +51,10 @@ func RecordLog(userId int, logType int, content string) {
 	if err != nil {
 		logger.SysError("failed to record log: " + err.Error())
 	}
+	return log.Id
 }
 
-func RecordTopupLog(userId int, content string, quota int) {
+func RecordTopupLog(userId int, content string, quota int) int {
 	log := &Log{
 		UserId:    userId,
 		Username:  GetUsernameById(userId),
@@ -64,12 +67,13 @@ func RecordTopupLog(userId int, content string, quota int) {
 	if err != nil {
 		logger.SysError("failed to record log: " + err.Error())
 	}
+	return log.Id
 }
 
-func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int64, content string) {
+func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int64, content string) int {
 	logger.Info(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
 	if !config.LogConsumeEnabled {
-		return
+		return 0
 	}
 	log := &Log{
 		UserId:           userId,
@@ -88,6 +92,7 @@ func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptToke
 	if err != nil {
 		logger.Error(ctx, "failed to record log: "+err.Error())
 	}
+	return log.Id
 }
 
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int) (logs []*Log, err error) {
@@ -43,7 +43,17 @@ func CreateRootAccountIfNeed() error {
 			AccessToken: accessToken,
 			Quota:       500000000000000,
 		}
-		DB.Create(&rootUser)
+		DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Create(&rootUser).Error
+			if err != nil {
+				return err
+			}
+			_, err = recordQuotaTransaction(tx, rootUser.Id, rootUser.Quota, QuotaTransaction{
+				Type:   QuotaTransactionTypeOpening,
+				Reason: "初始化 root 用户",
+			})
+			return err
+		})
 		if config.InitialRootToken != "" {
 			logger.SysLog("creating initial root token as requested")
 			token := Token{
@@ -58,7 +68,10 @@ func CreateRootAccountIfNeed() error {
 				RemainQuota:    500000000000000,
 				UnlimitedQuota: true,
 			}
-			DB.Create(&token)
+			err := token.Insert()
+			if err != nil {
+				logger.SysError("failed to create initial root token: " + err.Error())
+			}
 		}
 	}
 	return nil
@@ -119,6 +132,9 @@ func InitDB() {
 	sqlDB := setDBConns(DB)
 
 	if !config.IsMasterNode {
+		if err = verifyChannelSecrets(); err != nil {
+			logger.FatalLog(err.Error())
+		}
 		return
 	}
 
@@ -132,6 +148,12 @@ func InitDB() {
 		return
 	}
 	logger.SysLog("database migrated")
+	if err = verifyChannelSecrets(); err != nil {
+		logger.FatalLog(err.Error())
+	}
+	if err = migrateChannelKeyHashes(); err != nil {
+		logger.FatalLog("failed to migrate channel key hashes: " + err.Error())
+	}
 }
 
 func migrateDB() error {
@@ -142,9 +164,24 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Token{}); err != nil {
 		return err
 	}
+	if err = migrateTokenKeys(); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&User{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&Role{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&TwoFactor{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Organization{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&OrganizationMember{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Option{}); err != nil {
 		return err
 	}
@@ -154,9 +191,37 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&ChannelTestResult{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ChannelKeyHash{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
+	modelPricesTableCreated = !DB.Migrator().HasTable(&ModelPrice{})
+	if err = DB.AutoMigrate(&ModelPrice{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&QuotaReservation{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&QuotaTransaction{}); err != nil {
+		return err
+	}
+	if err = migrateQuotaTransactions(); err != nil {
+		return err
+	}
+	if err = migrateTokenQuotaTransactions(); err != nil {
+		return err
+	}
+	if err = migrateOrganizationQuotaTransactions(); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Channel{}); err != nil {
 		return err
 	}
@@ -197,6 +262,9 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
 	return nil
 }
 
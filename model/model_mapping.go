@@ -0,0 +1,106 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ModelMappingRule maps the requested model name to the actual one, the name is matched by:
+//   - a regular expression if it starts with ^, e.g. ^claude-(.*)$ -> anthropic/claude-$1
+//   - a wildcard if it contains *, each * is a capture group, e.g. gpt-4o-* -> gpt-4o
+//   - the exact name otherwise
+type ModelMappingRule struct {
+	From    string
+	To      string
+	pattern *regexp.Regexp
+}
+
+// ModelMapping keeps the rules in the order of the JSON object, the exact rules are tried first, then the
+// pattern rules in order, the first matched one wins
+type ModelMapping []ModelMappingRule
+
+func newModelMappingRule(from string, to string) (ModelMappingRule, error) {
+	rule := ModelMappingRule{From: from, To: to}
+	var expr string
+	switch {
+	case strings.HasPrefix(from, "^"):
+		expr = from
+	case strings.Contains(from, "*"):
+		parts := strings.Split(from, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		expr = "^" + strings.Join(parts, "(.*)") + "$"
+	default:
+		return rule, nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return rule, fmt.Errorf("%s 不是有效的正则表达式：%s", from, err.Error())
+	}
+	rule.pattern = pattern
+	return rule, nil
+}
+
+// ParseModelMapping parses the JSON object of the model mapping, json.Unmarshal is not used since it loses
+// the order of the keys
+func ParseModelMapping(data string) (ModelMapping, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("必须为 JSON 对象")
+	}
+	var mapping ModelMapping
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		from := token.(string)
+		var to string
+		err = decoder.Decode(&to)
+		if err != nil {
+			return nil, fmt.Errorf("%s 的值必须为字符串", from)
+		}
+		if to == "" {
+			continue
+		}
+		rule, err := newModelMappingRule(from, to)
+		if err != nil {
+			return nil, err
+		}
+		mapping = append(mapping, rule)
+	}
+	_, err = decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// Map returns the actual model name and whether the model is mapped
+func (mapping ModelMapping) Map(modelName string) (string, bool) {
+	for _, rule := range mapping {
+		if rule.pattern == nil && rule.From == modelName {
+			return rule.To, true
+		}
+	}
+	for _, rule := range mapping {
+		if rule.pattern == nil {
+			continue
+		}
+		match := rule.pattern.FindStringSubmatchIndex(modelName)
+		if match == nil {
+			continue
+		}
+		return string(rule.pattern.ExpandString(nil, rule.To, modelName, match)), true
+	}
+	return modelName, false
+}
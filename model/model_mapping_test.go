@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModelMapping(t *testing.T) {
+	Convey("ModelMapping", t, func() {
+		mapping, err := ParseModelMapping(`{
+			"^claude-(.*)$": "anthropic/claude-$1",
+			"gpt-4o-*": "gpt-4o",
+			"gpt-4o-mini-*": "gpt-4o-mini",
+			"claude-3-haiku": "claude-3-5-haiku",
+			"empty": ""
+		}`)
+		So(err, ShouldBeNil)
+		modelName, mapped := mapping.Map("claude-3-opus")
+		So(modelName, ShouldEqual, "anthropic/claude-3-opus")
+		So(mapped, ShouldBeTrue)
+		modelName, _ = mapping.Map("claude-3-haiku")
+		So(modelName, ShouldEqual, "claude-3-5-haiku")
+		modelName, _ = mapping.Map("gpt-4o-mini-2024-07-18")
+		So(modelName, ShouldEqual, "gpt-4o")
+		modelName, mapped = mapping.Map("empty")
+		So(modelName, ShouldEqual, "empty")
+		So(mapped, ShouldBeFalse)
+		modelName, mapped = ModelMapping(nil).Map("gpt-4")
+		So(modelName, ShouldEqual, "gpt-4")
+		So(mapped, ShouldBeFalse)
+
+		_, err = ParseModelMapping(`{"^gpt-(": "gpt"}`)
+		So(err, ShouldNotBeNil)
+		_, err = ParseModelMapping(`["gpt-4"]`)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,9 +1,12 @@
 package model
 
 import (
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/filter"
+	"github.com/songquanpeng/one-api/relay/hook"
 	"strconv"
 	"strings"
 	"time"
@@ -29,8 +32,13 @@ func InitOptionMap() {
 	config.OptionMap["EmailVerificationEnabled"] = strconv.FormatBool(config.EmailVerificationEnabled)
 	config.OptionMap["GitHubOAuthEnabled"] = strconv.FormatBool(config.GitHubOAuthEnabled)
 	config.OptionMap["OidcEnabled"] = strconv.FormatBool(config.OidcEnabled)
+	config.OptionMap["OidcPasswordLoginEnabled"] = strconv.FormatBool(config.OidcPasswordLoginEnabled)
+	config.OptionMap["LdapEnabled"] = strconv.FormatBool(config.LdapEnabled)
+	config.OptionMap["LdapStartTLSEnabled"] = strconv.FormatBool(config.LdapStartTLSEnabled)
+	config.OptionMap["LdapTLSSkipVerifyEnabled"] = strconv.FormatBool(config.LdapTLSSkipVerifyEnabled)
 	config.OptionMap["WeChatAuthEnabled"] = strconv.FormatBool(config.WeChatAuthEnabled)
 	config.OptionMap["TurnstileCheckEnabled"] = strconv.FormatBool(config.TurnstileCheckEnabled)
+	config.OptionMap["AdminTwoFactorEnabled"] = strconv.FormatBool(config.AdminTwoFactorEnabled)
 	config.OptionMap["RegisterEnabled"] = strconv.FormatBool(config.RegisterEnabled)
 	config.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(config.AutomaticDisableChannelEnabled)
 	config.OptionMap["AutomaticEnableChannelEnabled"] = strconv.FormatBool(config.AutomaticEnableChannelEnabled)
@@ -55,6 +63,22 @@ func InitOptionMap() {
 	config.OptionMap["ServerAddress"] = ""
 	config.OptionMap["GitHubClientId"] = ""
 	config.OptionMap["GitHubClientSecret"] = ""
+	config.OptionMap["OidcGroupClaim"] = ""
+	config.OptionMap["OidcGroupMapping"] = ""
+	config.OptionMap["OidcRoleClaim"] = ""
+	config.OptionMap["OidcRoleMapping"] = ""
+	config.OptionMap["ScimSecret"] = ""
+	config.OptionMap["LdapServerURL"] = ""
+	config.OptionMap["LdapBindDN"] = ""
+	config.OptionMap["LdapBindSecret"] = ""
+	config.OptionMap["LdapBaseDN"] = ""
+	config.OptionMap["LdapTLSCACert"] = ""
+	config.OptionMap["LdapUserFilter"] = config.LdapUserFilter
+	config.OptionMap["LdapUsernameAttribute"] = config.LdapUsernameAttribute
+	config.OptionMap["LdapEmailAttribute"] = config.LdapEmailAttribute
+	config.OptionMap["LdapDisplayNameAttribute"] = config.LdapDisplayNameAttribute
+	config.OptionMap["LdapGroupAttribute"] = config.LdapGroupAttribute
+	config.OptionMap["LdapGroupMapping"] = ""
 	config.OptionMap["WeChatServerAddress"] = ""
 	config.OptionMap["WeChatServerToken"] = ""
 	config.OptionMap["WeChatAccountQRCodeImageURL"] = ""
@@ -69,6 +93,9 @@ func InitOptionMap() {
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
+	config.OptionMap["ContentFilterRules"] = filter.Rules2JSONString()
+	config.OptionMap["Hooks"] = hook.Configs2JSONString()
+	config.OptionMap["HookSecret"] = ""
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
@@ -97,6 +124,7 @@ func SyncOptions(frequency int) {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		logger.SysLog("syncing options from database")
 		loadOptionsFromDatabase()
+		loadModelPrices()
 	}
 }
 
@@ -113,7 +141,15 @@ func UpdateOption(key string, value string) error {
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	err := updateOptionMap(key, value)
+	if err != nil {
+		return err
+	}
+	// let the other nodes reload the options
+	if common.RedisEnabled {
+		publishCacheEvent(cacheEvent{Type: cacheEventOption, Key: key})
+	}
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -133,10 +169,20 @@ func updateOptionMap(key string, value string) (err error) {
 			config.GitHubOAuthEnabled = boolValue
 		case "OidcEnabled":
 			config.OidcEnabled = boolValue
+		case "OidcPasswordLoginEnabled":
+			config.OidcPasswordLoginEnabled = boolValue
+		case "LdapEnabled":
+			config.LdapEnabled = boolValue
+		case "LdapStartTLSEnabled":
+			config.LdapStartTLSEnabled = boolValue
+		case "LdapTLSSkipVerifyEnabled":
+			config.LdapTLSSkipVerifyEnabled = boolValue
 		case "WeChatAuthEnabled":
 			config.WeChatAuthEnabled = boolValue
 		case "TurnstileCheckEnabled":
 			config.TurnstileCheckEnabled = boolValue
+		case "AdminTwoFactorEnabled":
+			config.AdminTwoFactorEnabled = boolValue
 		case "RegisterEnabled":
 			config.RegisterEnabled = boolValue
 		case "EmailDomainRestrictionEnabled":
@@ -191,6 +237,38 @@ func updateOptionMap(key string, value string) (err error) {
 		config.OidcTokenEndpoint = value
 	case "OidcUserinfoEndpoint":
 		config.OidcUserinfoEndpoint = value
+	case "OidcGroupClaim":
+		config.OidcGroupClaim = value
+	case "OidcGroupMapping":
+		config.OidcGroupMapping = value
+	case "OidcRoleClaim":
+		config.OidcRoleClaim = value
+	case "OidcRoleMapping":
+		config.OidcRoleMapping = value
+	case "ScimSecret":
+		config.ScimSecret = value
+	case "LdapServerURL":
+		config.LdapServerURL = value
+	case "LdapBindDN":
+		config.LdapBindDN = value
+	case "LdapBindSecret":
+		config.LdapBindSecret = value
+	case "LdapBaseDN":
+		config.LdapBaseDN = value
+	case "LdapTLSCACert":
+		config.LdapTLSCACert = value
+	case "LdapUserFilter":
+		config.LdapUserFilter = value
+	case "LdapUsernameAttribute":
+		config.LdapUsernameAttribute = value
+	case "LdapEmailAttribute":
+		config.LdapEmailAttribute = value
+	case "LdapDisplayNameAttribute":
+		config.LdapDisplayNameAttribute = value
+	case "LdapGroupAttribute":
+		config.LdapGroupAttribute = value
+	case "LdapGroupMapping":
+		config.LdapGroupMapping = value
 	case "Footer":
 		config.Footer = value
 	case "SystemName":
@@ -229,6 +307,12 @@ func updateOptionMap(key string, value string) (err error) {
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "ContentFilterRules":
+		err = filter.UpdateRulesByJSONString(value)
+	case "Hooks":
+		err = hook.UpdateConfigsByJSONString(value)
+	case "HookSecret":
+		err = hook.UpdateSecretsByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
@@ -0,0 +1,309 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInsufficientOrganizationQuota = errors.New("组织额度不足")
+	ErrOrganizationMemberQuotaLimit  = errors.New("组织成员额度已达上限")
+	ErrNotOrganizationMember         = errors.New("用户不是该组织的成员")
+)
+
+const (
+	OrganizationRoleMember = 1
+	OrganizationRoleAdmin  = 10
+)
+
+// Organization owns a quota pool, the tokens bound to the organization draw from the pool instead of the user quota
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Quota       int64  `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota   int64  `json:"used_quota" gorm:"bigint;default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	MemberCount int64  `json:"member_count" gorm:"-:all"`
+}
+
+// OrganizationMember is the membership of a user, QuotaLimit caps the quota the member can use, 0 means no cap
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_organization_user"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_organization_user;index"`
+	Username       string `json:"username" gorm:"-:all"`
+	Role           int    `json:"role" gorm:"default:1"`
+	QuotaLimit     int64  `json:"quota_limit" gorm:"bigint;default:0"`
+	UsedQuota      int64  `json:"used_quota" gorm:"bigint;default:0"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+// OrganizationUsage is the consumption of an organization grouped by member, or by member and token
+type OrganizationUsage struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	TokenName        string `json:"token_name,omitempty"`
+	Quota            int64  `json:"quota"`
+	RequestCount     int64  `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+func GetAllOrganizations(startIdx int, num int) (organizations []*Organization, err error) {
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&organizations).Error
+	if err != nil {
+		return nil, err
+	}
+	return organizations, fillOrganizationMemberCount(organizations)
+}
+
+func SearchOrganizations(keyword string) (organizations []*Organization, err error) {
+	err = DB.Where("id = ? or name LIKE ?", helper.String2Int(keyword), keyword+"%").Order("id desc").Find(&organizations).Error
+	if err != nil {
+		return nil, err
+	}
+	return organizations, fillOrganizationMemberCount(organizations)
+}
+
+func fillOrganizationMemberCount(organizations []*Organization) error {
+	for _, organization := range organizations {
+		err := DB.Model(&OrganizationMember{}).Where("organization_id = ?", organization.Id).Count(&organization.MemberCount).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	organization := Organization{}
+	err := DB.First(&organization, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(&OrganizationMember{}).Where("organization_id = ?", id).Count(&organization.MemberCount).Error
+	return &organization, err
+}
+
+// GetUserOrganizations returns the organizations the user belongs to along with the memberships
+func GetUserOrganizations(userId int) (organizations []*Organization, members []*OrganizationMember, err error) {
+	err = DB.Where("user_id = ?", userId).Order("organization_id asc").Find(&members).Error
+	if err != nil || len(members) == 0 {
+		return nil, nil, err
+	}
+	var ids []int
+	for _, member := range members {
+		ids = append(ids, member.OrganizationId)
+	}
+	err = DB.Where("id in (?)", ids).Order("id asc").Find(&organizations).Error
+	return organizations, members, err
+}
+
+func (organization *Organization) Insert() error {
+	organization.Name = strings.TrimSpace(organization.Name)
+	if organization.Name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	organization.CreatedTime = helper.GetTimestamp()
+	return DB.Create(organization).Error
+}
+
+func (organization *Organization) Update() error {
+	organization.Name = strings.TrimSpace(organization.Name)
+	if organization.Name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	return DB.Model(organization).Select("name").Updates(organization).Error
+}
+
+// IncreaseOrganizationQuota adds quota to the pool, a negative quota takes it back but the pool can't go below zero
+func IncreaseOrganizationQuota(id int, quota int64, transaction QuotaTransaction) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Organization{}).Where("id = ? and quota + ? >= 0", id, quota).Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if _, err := GetOrganizationById(id); err != nil {
+				return errors.New("组织不存在")
+			}
+			return ErrInsufficientOrganizationQuota
+		}
+		transaction.OrganizationId = id
+		transaction.OrganizationAmount = quota
+		_, err := recordQuotaTransaction(tx, 0, 0, transaction)
+		return err
+	})
+}
+
+// Delete removes the organization and its members, the tokens bound to it stop working
+func (organization *Organization) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("organization_id = ?", organization.Id).Delete(&OrganizationMember{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(organization).Error
+	})
+}
+
+func GetOrganizationMembers(organizationId int) (members []*OrganizationMember, err error) {
+	err = DB.Where("organization_id = ?", organizationId).Order("id asc").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		member.Username = GetUsernameById(member.UserId)
+	}
+	return members, nil
+}
+
+func GetOrganizationMember(organizationId int, userId int) (*OrganizationMember, error) {
+	member := OrganizationMember{}
+	err := DB.First(&member, "organization_id = ? and user_id = ?", organizationId, userId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func IsOrganizationAdmin(organizationId int, userId int) bool {
+	member, err := GetOrganizationMember(organizationId, userId)
+	return err == nil && member.Role >= OrganizationRoleAdmin
+}
+
+func (member *OrganizationMember) validate() error {
+	if member.Role != OrganizationRoleMember && member.Role != OrganizationRoleAdmin {
+		return errors.New("无效的组织角色")
+	}
+	if member.QuotaLimit < 0 {
+		return errors.New("成员额度上限不能为负数")
+	}
+	return nil
+}
+
+// CheckOrganizationAdminChange checks the membership change made by an organization admin without the permission
+// to manage all organizations, such admins can only manage the common members, not the admins or themselves.
+// before is nil if the member is being added, after is nil if the member is being removed.
+func CheckOrganizationAdminChange(operatorId int, before *OrganizationMember, after *OrganizationMember) error {
+	for _, member := range []*OrganizationMember{before, after} {
+		if member == nil {
+			continue
+		}
+		if member.UserId == operatorId {
+			return errors.New("不能修改自己的组织成员信息")
+		}
+		if member.Role >= OrganizationRoleAdmin {
+			return errors.New("无权进行此操作，只有组织管理权限才能管理组织管理员")
+		}
+	}
+	return nil
+}
+
+func (member *OrganizationMember) Insert() error {
+	if member.Role == 0 {
+		member.Role = OrganizationRoleMember
+	}
+	err := member.validate()
+	if err != nil {
+		return err
+	}
+	var count int64
+	err = DB.Model(&OrganizationMember{}).Where("organization_id = ? and user_id = ?", member.OrganizationId, member.UserId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("用户已是该组织的成员")
+	}
+	member.UsedQuota = 0
+	member.CreatedTime = helper.GetTimestamp()
+	return DB.Create(member).Error
+}
+
+func (member *OrganizationMember) Update() error {
+	err := member.validate()
+	if err != nil {
+		return err
+	}
+	return DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+}
+
+// Delete removes the member, the organization tokens of the member stop working
+func (member *OrganizationMember) Delete() error {
+	return DB.Delete(member).Error
+}
+
+// reserveOrganizationQuota decreases the organization pool and checks the member cap, it must be called in a db transaction
+func reserveOrganizationQuota(tx *gorm.DB, organizationId int, userId int, quota int64) error {
+	result := tx.Model(&OrganizationMember{}).
+		Where("organization_id = ? and user_id = ? and (quota_limit = 0 or used_quota + ? <= quota_limit)", organizationId, userId, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := GetOrganizationMember(organizationId, userId); err != nil {
+			return err
+		}
+		return ErrOrganizationMemberQuotaLimit
+	}
+	result = tx.Model(&Organization{}).Where("id = ? and quota >= ?", organizationId, quota).Updates(
+		map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		},
+	)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientOrganizationQuota
+	}
+	return nil
+}
+
+// postConsumeOrganizationQuota is PostConsumeTokenQuota for the tokens bound to organizations,
+// quota is charged (quota > 0) or refunded (quota < 0) to the organization and the member without checks
+func postConsumeOrganizationQuota(reservation *QuotaReservation, quota int64, transaction QuotaTransaction) error {
+	token, err := GetTokenById(reservation.TokenId)
+	if err != nil {
+		return err
+	}
+	transaction.UserId = reservation.UserId
+	transaction.TokenId = token.Id
+	transaction.OrganizationId = reservation.OrganizationId
+	transaction.OrganizationAmount = -quota
+	if !token.UnlimitedQuota {
+		transaction.TokenAmount = -quota
+	}
+	return changeQuota(&transaction)
+}
+
+// GetOrganizationUsage sums up the consume logs of the organization by member, or by member and token if byToken is true
+func GetOrganizationUsage(organizationId int, startTimestamp int64, endTimestamp int64, byToken bool) (usages []*OrganizationUsage, err error) {
+	groupBy := "user_id, username"
+	if byToken {
+		groupBy = "user_id, username, token_name"
+	}
+	tx := LOG_DB.Table("logs").
+		Select(groupBy+", sum(quota) as quota, count(*) as request_count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+		Where("organization_id = ? and type = ?", organizationId, LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Group(groupBy).Order("quota desc").Scan(&usages).Error
+	return usages, err
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOrganizationAdminChange(t *testing.T) {
+	member := &OrganizationMember{UserId: 2, Role: OrganizationRoleMember}
+	admin := &OrganizationMember{UserId: 3, Role: OrganizationRoleAdmin}
+	self := &OrganizationMember{UserId: 1, Role: OrganizationRoleAdmin, QuotaLimit: 100}
+	tests := []struct {
+		name    string
+		before  *OrganizationMember
+		after   *OrganizationMember
+		wantErr bool
+	}{
+		{"add member", nil, member, false},
+		{"change member cap", member, &OrganizationMember{UserId: 2, Role: OrganizationRoleMember, QuotaLimit: 100}, false},
+		{"remove member", member, nil, false},
+		{"add admin", nil, admin, true},
+		{"promote member", member, &OrganizationMember{UserId: 2, Role: OrganizationRoleAdmin}, true},
+		{"demote admin", admin, &OrganizationMember{UserId: 3, Role: OrganizationRoleMember}, true},
+		{"remove admin", admin, nil, true},
+		{"lift own cap", self, &OrganizationMember{UserId: 1, Role: OrganizationRoleAdmin}, true},
+		{"remove self", self, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckOrganizationAdminChange(1, tt.before, tt.after)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOrganizationQuotaTransactions(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, token := createTestUserAndToken(t, 1000, 500)
+	organization := &Organization{Name: "test"}
+	require.NoError(t, organization.Insert())
+	require.NoError(t, IncreaseOrganizationQuota(organization.Id, 300, QuotaTransaction{Type: QuotaTransactionTypeTopUp, ActorId: 1}))
+	assert.ErrorIs(t, IncreaseOrganizationQuota(organization.Id, -400, QuotaTransaction{Type: QuotaTransactionTypeAdjust}), ErrInsufficientOrganizationQuota)
+	member := &OrganizationMember{OrganizationId: organization.Id, UserId: user.Id, QuotaLimit: 250}
+	require.NoError(t, member.Insert())
+	require.NoError(t, DB.Model(token).Update("organization_id", organization.Id).Error)
+
+	reservation, err := ReserveQuota(ctx, user.Id, token.Id, 200)
+	require.NoError(t, err)
+	_, err = ReserveQuota(ctx, user.Id, token.Id, 100)
+	assert.ErrorIs(t, err, ErrOrganizationMemberQuotaLimit)
+	require.NoError(t, SettleQuotaReservation(ctx, reservation, 150, 0))
+
+	organization, err = GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 150, organization.Quota)
+	assert.EqualValues(t, 150, organization.UsedQuota)
+	member, err = GetOrganizationMember(organization.Id, user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 150, member.UsedQuota)
+	// the user quota is not used
+	userQuota, tokenQuota := getTestQuotas(t, user.Id, token.Id)
+	assert.EqualValues(t, 1000, userQuota)
+	assert.EqualValues(t, 350, tokenQuota)
+
+	transactions, err := GetUserQuotaTransactions(user.Id, QuotaTransactionTypeUnknown, 0, 10)
+	require.NoError(t, err)
+	// top up, token opening, reserve and settle
+	require.Len(t, transactions, 4)
+	settle := transactions[0]
+	assert.Equal(t, QuotaTransactionTypeSettle, settle.Type)
+	assert.Equal(t, organization.Id, settle.OrganizationId)
+	assert.EqualValues(t, 50, settle.OrganizationAmount)
+	assert.EqualValues(t, 100, settle.OrganizationBalanceBefore)
+	assert.EqualValues(t, 150, settle.OrganizationBalanceAfter)
+	assert.EqualValues(t, 300, settle.TokenBalanceBefore)
+	assert.EqualValues(t, 350, settle.TokenBalanceAfter)
+
+	inconsistencies, err := CheckQuotaTransactions(0)
+	require.NoError(t, err)
+	assert.Empty(t, inconsistencies)
+
+	// the pool is changed without the ledger
+	require.NoError(t, DB.Model(&Organization{}).Where("id = ?", organization.Id).Update("quota", 100).Error)
+	inconsistencies, err = CheckQuotaTransactions(0)
+	require.NoError(t, err)
+	require.Len(t, inconsistencies, 1)
+	assert.Equal(t, organization.Id, inconsistencies[0].OrganizationId)
+	assert.EqualValues(t, -50, inconsistencies[0].Difference)
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ParamOverride changes the fields of the request body, a field is named by its dotted path, e.g.
+// generationConfig.temperature, the deletions are applied first, then the defaults, the sets and the clamps
+type ParamOverride struct {
+	// Set overwrites the fields
+	Set map[string]any `json:"set,omitempty"`
+	// Default sets the fields which are absent in the request
+	Default map[string]any `json:"default,omitempty"`
+	Delete  []string       `json:"delete,omitempty"`
+	// Clamp limits the numeric fields which are present in the request
+	Clamp map[string]ParamRange `json:"clamp,omitempty"`
+}
+
+type ParamRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+func (override *ParamOverride) IsEmpty() bool {
+	return override == nil || (len(override.Set) == 0 && len(override.Default) == 0 && len(override.Delete) == 0 && len(override.Clamp) == 0)
+}
+
+// lookupParam returns the map holding the last segment of the path, the missing maps are created if create is true
+func lookupParam(body map[string]any, path string, create bool) (map[string]any, string) {
+	keys := strings.Split(path, ".")
+	current := body
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			if !create {
+				return nil, ""
+			}
+			next = make(map[string]any)
+			current[key] = next
+		}
+		current = next
+	}
+	return current, keys[len(keys)-1]
+}
+
+// Apply applies the override to the JSON request body
+func (override *ParamOverride) Apply(jsonData []byte) ([]byte, error) {
+	if override.IsEmpty() {
+		return jsonData, nil
+	}
+	body := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	// keep the large integers, e.g. seed, as they are
+	decoder.UseNumber()
+	err := decoder.Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range override.Delete {
+		if parent, key := lookupParam(body, path, false); parent != nil {
+			delete(parent, key)
+		}
+	}
+	for path, value := range override.Default {
+		parent, key := lookupParam(body, path, true)
+		if _, ok := parent[key]; !ok {
+			parent[key] = value
+		}
+	}
+	for path, value := range override.Set {
+		parent, key := lookupParam(body, path, true)
+		parent[key] = value
+	}
+	for path, paramRange := range override.Clamp {
+		parent, key := lookupParam(body, path, false)
+		if parent == nil {
+			continue
+		}
+		number, ok := parent[key].(json.Number)
+		if !ok {
+			continue
+		}
+		value, err := number.Float64()
+		if err != nil {
+			continue
+		}
+		if paramRange.Min != nil && value < *paramRange.Min {
+			parent[key] = *paramRange.Min
+		}
+		if paramRange.Max != nil && value > *paramRange.Max {
+			parent[key] = *paramRange.Max
+		}
+	}
+	return json.Marshal(body)
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParamOverrideApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		body     string
+		want     string
+	}{
+		{"empty", `{}`, `{"model":"gpt-4o","seed":12345678901234567890}`, `{"model":"gpt-4o","seed":12345678901234567890}`},
+		{"set", `{"set":{"temperature":0.2,"generationConfig.topK":5}}`, `{"temperature":1}`, `{"temperature":0.2,"generationConfig":{"topK":5}}`},
+		{"default only when absent", `{"default":{"temperature":0.5,"max_tokens":100}}`, `{"temperature":1}`, `{"temperature":1,"max_tokens":100}`},
+		{"delete", `{"delete":["logit_bias","stream_options.include_usage","missing.field"]}`, `{"logit_bias":{},"stream_options":{"include_usage":true}}`, `{"stream_options":{}}`},
+		{"delete before default", `{"delete":["user"],"default":{"user":"one-api"}}`, `{"user":"alice"}`, `{"user":"one-api"}`},
+		{"clamp", `{"clamp":{"temperature":{"min":0.1,"max":1},"top_p":{"max":0.9},"n":{"min":1}}}`, `{"temperature":1.5,"top_p":0.5,"n":0}`, `{"temperature":1,"top_p":0.5,"n":1}`},
+		{"clamp ignores absent and non-numeric fields", `{"clamp":{"temperature":{"max":1},"stop":{"max":1}}}`, `{"stop":"\n"}`, `{"stop":"\n"}`},
+		{"large integers are kept", `{"set":{"temperature":0}}`, `{"seed":12345678901234567890}`, `{"seed":12345678901234567890,"temperature":0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			override := &ParamOverride{}
+			require.NoError(t, json.Unmarshal([]byte(tt.override), override))
+			result, err := override.Apply([]byte(tt.body))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(result))
+		})
+	}
+
+	// JSONEq compares the numbers as float64, check the digits of the large integer
+	result, err := (&ParamOverride{Set: map[string]any{"temperature": 0}}).Apply([]byte(`{"seed":12345678901234567891}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(result), "12345678901234567891")
+
+	var override *ParamOverride
+	assert.True(t, override.IsEmpty())
+	result, err = override.Apply([]byte(`not json`))
+	require.NoError(t, err)
+	assert.Equal(t, "not json", string(result))
+	_, err = (&ParamOverride{Delete: []string{"user"}}).Apply([]byte(`not json`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,216 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// ModelPrice is the absolute price of a model, token prices are in USD per 1M tokens.
+// Model can be channel specific, e.g. "llama3-8b-8192(33)", the same as ModelRatio.
+type ModelPrice struct {
+	Id               int     `json:"id"`
+	Model            string  `json:"model" gorm:"type:varchar(128);uniqueIndex"`
+	InputPrice       float64 `json:"input_price" gorm:"default:0"`
+	OutputPrice      float64 `json:"output_price" gorm:"default:0"`
+	CachedInputPrice float64 `json:"cached_input_price" gorm:"default:0"`
+	ImagePrice       float64 `json:"image_price" gorm:"default:0"`  // per image
+	SecondPrice      float64 `json:"second_price" gorm:"default:0"` // per second of audio
+	CreatedTime      int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime      int64   `json:"updated_time" gorm:"bigint"`
+	// derived ratios, only for api response
+	ModelRatio      float64 `json:"model_ratio" gorm:"-:all"`
+	CompletionRatio float64 `json:"completion_ratio" gorm:"-:all"`
+}
+
+func (price *ModelPrice) toRatioPrice() billingratio.Price {
+	return billingratio.Price{
+		Input:       price.InputPrice,
+		Output:      price.OutputPrice,
+		CachedInput: price.CachedInputPrice,
+		Image:       price.ImagePrice,
+		Second:      price.SecondPrice,
+	}
+}
+
+func (price *ModelPrice) fillRatios() {
+	ratioPrice := price.toRatioPrice()
+	price.ModelRatio = billingratio.Price2ModelRatio(ratioPrice)
+	price.CompletionRatio = billingratio.Price2CompletionRatio(ratioPrice)
+}
+
+func isValidPrice(value float64) bool {
+	return value >= 0 && !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+func (price *ModelPrice) Validate() error {
+	if price.Model == "" {
+		return errors.New("模型名称不能为空")
+	}
+	if len(price.Model) > 128 {
+		return errors.New("模型名称过长")
+	}
+	for _, value := range []float64{price.InputPrice, price.OutputPrice, price.CachedInputPrice, price.ImagePrice, price.SecondPrice} {
+		if !isValidPrice(value) {
+			return errors.New("价格必须为非负数")
+		}
+	}
+	if price.InputPrice == 0 && price.ImagePrice == 0 && price.SecondPrice == 0 && price.OutputPrice == 0 {
+		return errors.New("至少需要设置一项价格")
+	}
+	if price.InputPrice == 0 && (price.OutputPrice > 0 || price.CachedInputPrice > 0) {
+		return errors.New("设置输出价格或缓存输入价格时必须设置输入价格")
+	}
+	if price.CachedInputPrice > price.InputPrice {
+		return errors.New("缓存输入价格不能高于输入价格")
+	}
+	return nil
+}
+
+func GetAllModelPrices(startIdx int, num int) ([]*ModelPrice, error) {
+	var prices []*ModelPrice
+	err := DB.Order("model asc").Limit(num).Offset(startIdx).Find(&prices).Error
+	for _, price := range prices {
+		price.fillRatios()
+	}
+	return prices, err
+}
+
+func SearchModelPrices(keyword string) (prices []*ModelPrice, err error) {
+	err = DB.Where("model LIKE ?", "%"+keyword+"%").Order("model asc").Find(&prices).Error
+	for _, price := range prices {
+		price.fillRatios()
+	}
+	return prices, err
+}
+
+func GetModelPriceById(id int) (*ModelPrice, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	price := ModelPrice{Id: id}
+	err := DB.First(&price, "id = ?", id).Error
+	price.fillRatios()
+	return &price, err
+}
+
+func (price *ModelPrice) Insert() error {
+	price.CreatedTime = helper.GetTimestamp()
+	price.UpdatedTime = price.CreatedTime
+	err := DB.Create(price).Error
+	if err != nil {
+		return err
+	}
+	price.fillRatios()
+	publishCacheEvent(cacheEvent{Type: cacheEventPrice, Id: price.Id})
+	return nil
+}
+
+func (price *ModelPrice) Update() error {
+	price.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(price).Select("model", "input_price", "output_price", "cached_input_price", "image_price", "second_price", "updated_time").Updates(price).Error
+	if err != nil {
+		return err
+	}
+	price.fillRatios()
+	publishCacheEvent(cacheEvent{Type: cacheEventPrice, Id: price.Id})
+	return nil
+}
+
+func DeleteModelPriceById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	err := DB.Delete(&ModelPrice{Id: id}).Error
+	if err != nil {
+		return err
+	}
+	publishCacheEvent(cacheEvent{Type: cacheEventPrice, Id: id})
+	return nil
+}
+
+func loadModelPrices() {
+	var prices []*ModelPrice
+	err := DB.Find(&prices).Error
+	if err != nil {
+		logger.SysError("failed to load model prices: " + err.Error())
+		return
+	}
+	newPrices := make(map[string]billingratio.Price, len(prices))
+	for _, price := range prices {
+		newPrices[price.Model] = price.toRatioPrice()
+	}
+	billingratio.UpdateModelPrices(newPrices)
+}
+
+// modelPricesTableCreated is set by migrateDB when the model_prices table did not exist before
+var modelPricesTableCreated bool
+
+// isCustomizedRatio reports whether the admin changed the ratios of the key in the option editor,
+// untouched defaults stay in ModelRatio & CompletionRatio so that the option editor keeps working for them
+func isCustomizedRatio(key string, modelRatio float64) bool {
+	if defaultRatio, ok := billingratio.DefaultModelRatio[key]; !ok || defaultRatio != modelRatio {
+		return true
+	}
+	completionRatio, ok := billingratio.CompletionRatio[key]
+	return ok && completionRatio != billingratio.DefaultCompletionRatio[key]
+}
+
+// migrateModelPrices converts the customized ratios into the price table,
+// it only runs once when the table is created
+func migrateModelPrices() error {
+	if !modelPricesTableCreated {
+		return nil
+	}
+	var count int64
+	err := DB.Model(&ModelPrice{}).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	now := helper.GetTimestamp()
+	prices := make([]ModelPrice, 0)
+	for key, modelRatio := range billingratio.ModelRatio {
+		if !isCustomizedRatio(key, modelRatio) {
+			continue
+		}
+		name, channelType := billingratio.SplitModelKey(key)
+		price := ModelPrice{
+			Model:       key,
+			CreatedTime: now,
+			UpdatedTime: now,
+		}
+		if _, ok := billingratio.ImageGenerationAmounts[name]; ok {
+			price.ImagePrice = modelRatio / billingratio.USD
+		} else {
+			ratioPrice := billingratio.Ratio2Price(modelRatio, billingratio.GetCompletionRatio(name, channelType))
+			price.InputPrice = ratioPrice.Input
+			price.OutputPrice = ratioPrice.Output
+		}
+		if price.Validate() != nil {
+			// free models, keep them in ModelRatio
+			continue
+		}
+		prices = append(prices, price)
+	}
+	if len(prices) == 0 {
+		return nil
+	}
+	logger.SysLog(fmt.Sprintf("migrating %d model ratios to model prices", len(prices)))
+	return DB.CreateInBatches(&prices, 100).Error
+}
+
+// InitModelPrices must be called after InitOptionMap, so that ModelRatio is loaded from database
+func InitModelPrices() {
+	if config.IsMasterNode {
+		err := migrateModelPrices()
+		if err != nil {
+			logger.SysError("failed to migrate model prices: " + err.Error())
+		}
+	}
+	loadModelPrices()
+}
@@ -0,0 +1,521 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInsufficientUserQuota  = errors.New("用户额度不足")
+	ErrInsufficientTokenQuota = errors.New("令牌额度不足")
+)
+
+// QuotaReservation is the quota pre-consumed for a relay request.
+// It is deleted when settled, or returned by the sweeper after ExpiredTime.
+type QuotaReservation struct {
+	Id             int   `json:"id"`
+	UserId         int   `json:"user_id" gorm:"index"`
+	TokenId        int   `json:"token_id"`
+	OrganizationId int   `json:"organization_id" gorm:"default:0"` // the quota is reserved from the organization if not 0
+	Quota          int64 `json:"quota" gorm:"bigint"`
+	CreatedTime    int64 `json:"created_time" gorm:"bigint"`
+	ExpiredTime    int64 `json:"expired_time" gorm:"bigint;index"`
+}
+
+// The cached quota is the database quota plus the changes applied to the cache but not yet to database,
+// e.g. the reservations queued by the batch updater or not committed yet. These changes are summed in the
+// pending key of each quota key, and every change of the cache or the pending amount bumps the version key,
+// so that the cache can be rebuilt from database without giving back the reserved quota.
+
+// reserveQuotaScript checks and decreases all the quota keys atomically, KEYS are triples of the quota,
+// pending and version keys, returns {1, user quota left} on success, {0, 0} on cache miss
+// and {-i, 0} if the i-th quota key is not enough
+var reserveQuotaScript = redis.NewScript(`
+local amount = tonumber(ARGV[1])
+for i = 1, #KEYS, 3 do
+	local value = redis.call('GET', KEYS[i])
+	if not value then
+		return {0, 0}
+	end
+	if tonumber(value) < amount then
+		return {-(i + 2) / 3, 0}
+	end
+end
+for i = 1, #KEYS, 3 do
+	redis.call('DECRBY', KEYS[i], amount)
+	redis.call('DECRBY', KEYS[i + 1], amount)
+	redis.call('INCR', KEYS[i + 2])
+end
+return {1, tonumber(redis.call('GET', KEYS[1]))}
+`)
+
+// applyQuotaScript adds ARGV[i] to the i-th quota key if it's still cached, and to its pending amount
+var applyQuotaScript = redis.NewScript(`
+for i = 1, #KEYS, 3 do
+	local delta = ARGV[(i + 2) / 3]
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		redis.call('INCRBY', KEYS[i], delta)
+	end
+	redis.call('INCRBY', KEYS[i + 1], delta)
+	redis.call('INCR', KEYS[i + 2])
+end
+return 1
+`)
+
+// releaseQuotaScript removes ARGV[i] from the i-th pending amount once the change is written into database
+var releaseQuotaScript = redis.NewScript(`
+for i = 1, #KEYS, 3 do
+	redis.call('DECRBY', KEYS[i + 1], ARGV[(i + 2) / 3])
+	redis.call('INCR', KEYS[i + 2])
+end
+return 1
+`)
+
+// refreshQuotaScript sets the quota key to the database quota ARGV[1] plus the pending amount,
+// unless the version has changed since ARGV[2] was read, returns 1 if the key is set
+var refreshQuotaScript = redis.NewScript(`
+local version = redis.call('GET', KEYS[3]) or '0'
+if version ~= ARGV[2] then
+	return 0
+end
+local pending = tonumber(redis.call('GET', KEYS[2]) or '0')
+redis.call('SET', KEYS[1], tonumber(ARGV[1]) + pending, 'EX', ARGV[3])
+return 1
+`)
+
+// invalidateQuotaScript deletes the quota key after its database quota is changed directly
+var invalidateQuotaScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('INCR', KEYS[3])
+return 1
+`)
+
+func tokenQuotaCacheKey(tokenId int) string {
+	return fmt.Sprintf("token_quota:%d", tokenId)
+}
+
+func userQuotaCacheKey(userId int) string {
+	return fmt.Sprintf("user_quota:%d", userId)
+}
+
+// quotaCacheKeys returns the quota, pending and version keys of the quota key
+func quotaCacheKeys(key string) []string {
+	return []string{key, key + ":pending", key + ":version"}
+}
+
+// quotaTransactionCacheKeys returns the keys and the changes of the cached quota changed by the transaction
+func quotaTransactionCacheKeys(transaction *QuotaTransaction) ([]string, []interface{}) {
+	var keys []string
+	var deltas []interface{}
+	if transaction.Amount != 0 {
+		keys = append(keys, quotaCacheKeys(userQuotaCacheKey(transaction.UserId))...)
+		deltas = append(deltas, transaction.Amount)
+	}
+	if transaction.TokenId != 0 && transaction.TokenAmount != 0 {
+		keys = append(keys, quotaCacheKeys(tokenQuotaCacheKey(transaction.TokenId))...)
+		deltas = append(deltas, transaction.TokenAmount)
+	}
+	return keys, deltas
+}
+
+// refreshQuotaCacheKey rebuilds the quota key from the database quota returned by getQuota,
+// it gives up if the cache or the pending amount is changed meanwhile
+func refreshQuotaCacheKey(ctx context.Context, key string, expiration time.Duration, getQuota func() (int64, error)) error {
+	keys := quotaCacheKeys(key)
+	version, err := common.RDB.Get(ctx, keys[2]).Result()
+	if errors.Is(err, redis.Nil) {
+		version, err = "0", nil
+	}
+	if err != nil {
+		return err
+	}
+	quota, err := getQuota()
+	if err != nil {
+		return err
+	}
+	return refreshQuotaScript.Run(ctx, common.RDB, keys, quota, version, int64(expiration/time.Second)).Err()
+}
+
+func refreshQuotaCache(ctx context.Context, userId int, token *Token) error {
+	err := refreshQuotaCacheKey(ctx, userQuotaCacheKey(userId), time.Duration(UserId2QuotaCacheSeconds)*time.Second, func() (int64, error) {
+		return GetUserQuota(userId)
+	})
+	if err != nil {
+		return err
+	}
+	if token.UnlimitedQuota {
+		return nil
+	}
+	return refreshQuotaCacheKey(ctx, tokenQuotaCacheKey(token.Id), time.Duration(TokenCacheSeconds)*time.Second, func() (int64, error) {
+		var remainQuota int64
+		err := DB.Model(&Token{}).Where("id = ?", token.Id).Select("remain_quota").Find(&remainQuota).Error
+		return remainQuota, err
+	})
+}
+
+func cacheReserveQuota(ctx context.Context, userId int, token *Token, quota int64) (int64, error) {
+	keys := quotaCacheKeys(userQuotaCacheKey(userId))
+	if !token.UnlimitedQuota {
+		keys = append(keys, quotaCacheKeys(tokenQuotaCacheKey(token.Id))...)
+	}
+	// the cache may be missing or stale, refresh it from database and retry once
+	for i := 0; i < 2; i++ {
+		result, err := reserveQuotaScript.Run(ctx, common.RDB, keys, quota).Int64Slice()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case result[0] == 1:
+			return result[1], nil
+		case i == 0:
+			err = refreshQuotaCache(ctx, userId, token)
+			if err != nil {
+				return 0, err
+			}
+		case result[0] == -1:
+			return 0, ErrInsufficientUserQuota
+		case result[0] == -2:
+			return 0, ErrInsufficientTokenQuota
+		}
+	}
+	return 0, errors.New("quota cache is not available")
+}
+
+// cacheApplyQuotaTransaction applies the transaction to the cached quota before it's written into database,
+// the transaction is marked so that the pending amount is released once it's written
+func cacheApplyQuotaTransaction(ctx context.Context, transaction *QuotaTransaction) {
+	if !common.RedisEnabled {
+		return
+	}
+	keys, deltas := quotaTransactionCacheKeys(transaction)
+	if len(keys) == 0 {
+		return
+	}
+	err := applyQuotaScript.Run(ctx, common.RDB, keys, deltas...).Err()
+	if err != nil {
+		logger.Error(ctx, "Redis apply quota error: "+err.Error())
+		return
+	}
+	transaction.cached = true
+}
+
+// cacheRevertQuotaTransaction reverts the cached quota if the transaction fails to be written into database
+func cacheRevertQuotaTransaction(ctx context.Context, transaction *QuotaTransaction) {
+	if !transaction.cached {
+		return
+	}
+	reverted := *transaction
+	reverted.Amount = -transaction.Amount
+	reverted.TokenAmount = -transaction.TokenAmount
+	keys, deltas := quotaTransactionCacheKeys(&reverted)
+	err := applyQuotaScript.Run(ctx, common.RDB, keys, deltas...).Err()
+	if err != nil {
+		logger.Error(ctx, "Redis revert quota error: "+err.Error())
+	}
+	transaction.cached = false
+}
+
+// invalidateQuotaCache deletes the quota key, the refresh running meanwhile is given up
+func invalidateQuotaCache(key string) {
+	err := invalidateQuotaScript.Run(context.Background(), common.RDB, quotaCacheKeys(key)).Err()
+	if err != nil {
+		logger.SysError("Redis invalidate quota error: " + err.Error())
+	}
+}
+
+// syncQuotaCache is called after the transactions are written into database, the pending amounts of the cached
+// transactions are released, and the cached quota changed by the others is invalidated
+func syncQuotaCache(transactions []*QuotaTransaction) {
+	if !common.RedisEnabled {
+		return
+	}
+	ctx := context.Background()
+	for _, transaction := range transactions {
+		keys, deltas := quotaTransactionCacheKeys(transaction)
+		if len(keys) == 0 {
+			continue
+		}
+		if !transaction.cached {
+			for i := 0; i < len(keys); i += 3 {
+				invalidateQuotaCache(keys[i])
+			}
+			continue
+		}
+		err := releaseQuotaScript.Run(ctx, common.RDB, keys, deltas...).Err()
+		if err != nil {
+			logger.SysError("Redis release quota error: " + err.Error())
+		}
+	}
+}
+
+// dbReserveQuota uses conditional updates, so that concurrent requests can't overdraw
+func dbReserveQuota(reservation *QuotaReservation, token *Token) (userQuota int64, err error) {
+	quota := reservation.Quota
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and quota >= ?", reservation.UserId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientUserQuota
+		}
+		if !token.UnlimitedQuota {
+			result = tx.Model(&Token{}).Where("id = ? and remain_quota >= ?", token.Id, quota).Updates(
+				map[string]interface{}{
+					"remain_quota":  gorm.Expr("remain_quota - ?", quota),
+					"used_quota":    gorm.Expr("used_quota + ?", quota),
+					"accessed_time": helper.GetTimestamp(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrInsufficientTokenQuota
+			}
+		}
+		err := tx.Create(reservation).Error
+		if err != nil {
+			return err
+		}
+		transaction := QuotaTransaction{
+			Type:          QuotaTransactionTypeReserve,
+			TokenId:       token.Id,
+			Reason:        "预扣费",
+			ReservationId: reservation.Id,
+		}
+		if !token.UnlimitedQuota {
+			transaction.TokenAmount = -quota
+		}
+		recorded, err := recordQuotaTransaction(tx, reservation.UserId, -quota, transaction)
+		if err != nil {
+			return err
+		}
+		userQuota = recorded.BalanceAfter
+		return nil
+	})
+	return userQuota, err
+}
+
+// dbReserveOrganizationQuota reserves the quota from the organization pool and the token,
+// the organization quota is not cached, so it always goes to database
+func dbReserveOrganizationQuota(reservation *QuotaReservation, token *Token) error {
+	quota := reservation.Quota
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := reserveOrganizationQuota(tx, reservation.OrganizationId, reservation.UserId, quota)
+		if err != nil {
+			return err
+		}
+		if !token.UnlimitedQuota {
+			result := tx.Model(&Token{}).Where("id = ? and remain_quota >= ?", token.Id, quota).Updates(
+				map[string]interface{}{
+					"remain_quota":  gorm.Expr("remain_quota - ?", quota),
+					"used_quota":    gorm.Expr("used_quota + ?", quota),
+					"accessed_time": helper.GetTimestamp(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrInsufficientTokenQuota
+			}
+		}
+		err = tx.Create(reservation).Error
+		if err != nil {
+			return err
+		}
+		transaction := QuotaTransaction{
+			Type:               QuotaTransactionTypeReserve,
+			TokenId:            token.Id,
+			OrganizationId:     reservation.OrganizationId,
+			OrganizationAmount: -quota,
+			Reason:             "预扣费",
+			ReservationId:      reservation.Id,
+		}
+		if !token.UnlimitedQuota {
+			transaction.TokenAmount = -quota
+		}
+		_, err = recordQuotaTransaction(tx, reservation.UserId, 0, transaction)
+		return err
+	})
+}
+
+// ReserveQuota pre-consumes quota from both user and token atomically,
+// or from the organization and token if the token is bound to an organization,
+// the returned reservation must be settled by SettleQuotaReservation or ReleaseQuotaReservation
+func ReserveQuota(ctx context.Context, userId int, tokenId int, quota int64) (*QuotaReservation, error) {
+	if quota < 0 {
+		return nil, errors.New("quota 不能为负数！")
+	}
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return nil, err
+	}
+	reservation := &QuotaReservation{
+		UserId:         userId,
+		TokenId:        tokenId,
+		OrganizationId: token.OrganizationId,
+	}
+	if quota == 0 {
+		return reservation, nil
+	}
+	reservation.Quota = quota
+	reservation.CreatedTime = helper.GetTimestamp()
+	reservation.ExpiredTime = reservation.CreatedTime + int64(config.QuotaReservationTimeout)
+	if reservation.OrganizationId != 0 {
+		err = dbReserveOrganizationQuota(reservation, token)
+		if err != nil {
+			return nil, err
+		}
+		return reservation, nil
+	}
+	var userQuota int64
+	if common.RedisEnabled {
+		userQuota, err = cacheReserveQuota(ctx, userId, token, quota)
+		if err != nil {
+			return nil, err
+		}
+		// the reserve script has applied the transaction to the cache
+		transaction := QuotaTransaction{
+			Type:    QuotaTransactionTypeReserve,
+			UserId:  userId,
+			Amount:  -quota,
+			TokenId: tokenId,
+			Reason:  "预扣费",
+			cached:  true,
+		}
+		if !token.UnlimitedQuota {
+			transaction.TokenAmount = -quota
+		}
+		err = DB.Create(reservation).Error
+		if err == nil {
+			transaction.ReservationId = reservation.Id
+			err = changeQuota(&transaction)
+		}
+		if err != nil {
+			cacheRevertQuotaTransaction(ctx, &transaction)
+			if reservation.Id != 0 {
+				DB.Delete(reservation)
+			}
+		}
+	} else {
+		userQuota, err = dbReserveQuota(reservation, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	notifyUserQuotaLow(userId, userQuota+quota, quota)
+	return reservation, nil
+}
+
+// SettleQuotaReservation consumes the actual quota, the difference with the reserved quota is returned or charged.
+// If the reservation has been expired and returned by the sweeper, the full quota is charged.
+// logId is the consume log of the request, 0 if there is none.
+func SettleQuotaReservation(ctx context.Context, reservation *QuotaReservation, quota int64, logId int) error {
+	if reservation == nil {
+		return errors.New("quota reservation is nil")
+	}
+	if reservation.OrganizationId != 0 && logId != 0 {
+		err := LOG_DB.Model(&Log{}).Where("id = ?", logId).Update("organization_id", reservation.OrganizationId).Error
+		if err != nil {
+			logger.Error(ctx, "failed to set organization of log: "+err.Error())
+		}
+	}
+	delta := quota
+	if reservation.Id != 0 {
+		// deleting the row claims the reservation, so it can't be settled twice
+		result := DB.Delete(&QuotaReservation{}, "id = ?", reservation.Id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			delta = quota - reservation.Quota
+		} else {
+			logger.Warnf(ctx, "quota reservation #%d has expired before settled", reservation.Id)
+		}
+	}
+	if delta == 0 {
+		return nil
+	}
+	transaction := QuotaTransaction{
+		Type:          QuotaTransactionTypeSettle,
+		Reason:        "结算",
+		LogId:         logId,
+		ReservationId: reservation.Id,
+	}
+	if quota == 0 {
+		transaction.Type = QuotaTransactionTypeRefund
+		transaction.Reason = "退还预扣费"
+	}
+	if reservation.OrganizationId != 0 {
+		return postConsumeOrganizationQuota(reservation, delta, transaction)
+	}
+	return postConsumeTokenQuota(ctx, reservation.TokenId, delta, transaction)
+}
+
+// ReleaseQuotaReservation returns all the reserved quota
+func ReleaseQuotaReservation(ctx context.Context, reservation *QuotaReservation) error {
+	return SettleQuotaReservation(ctx, reservation, 0, 0)
+}
+
+func expireQuotaReservations() {
+	ctx := context.Background()
+	var reservations []*QuotaReservation
+	err := DB.Where("expired_time < ?", helper.GetTimestamp()).Limit(1000).Find(&reservations).Error
+	if err != nil {
+		logger.SysError("failed to get expired quota reservations: " + err.Error())
+		return
+	}
+	for _, reservation := range reservations {
+		err = ReleaseQuotaReservation(ctx, reservation)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to return expired quota reservation #%d: %s", reservation.Id, err.Error()))
+			continue
+		}
+		logger.SysLog(fmt.Sprintf("expired quota reservation #%d returned, user id %d, quota %d", reservation.Id, reservation.UserId, reservation.Quota))
+	}
+}
+
+func SyncQuotaReservations(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		expireQuotaReservations()
+	}
+}
+
+func notifyUserQuotaLow(userId int, userQuota int64, quota int64) {
+	quotaTooLow := userQuota >= config.QuotaRemindThreshold && userQuota-quota < config.QuotaRemindThreshold
+	noMoreQuota := userQuota-quota <= 0
+	if !quotaTooLow && !noMoreQuota {
+		return
+	}
+	go func() {
+		email, err := GetUserEmail(userId)
+		if err != nil {
+			logger.SysError("failed to fetch user email: " + err.Error())
+		}
+		prompt := "您的额度即将用尽"
+		if noMoreQuota {
+			prompt = "您的额度已用尽"
+		}
+		if email != "" {
+			topUpLink := fmt.Sprintf("%s/topup", config.ServerAddress)
+			err = message.SendEmail(prompt, email,
+				fmt.Sprintf("%s，当前剩余额度为 %d，为了不影响您的使用，请及时充值。<br/>充值链接：<a href='%s'>%s</a>", prompt, userQuota, topUpLink, topUpLink))
+			if err != nil {
+				logger.SysError("failed to send email" + err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestRedis(t *testing.T) *miniredis.Miniredis {
+	server := miniredis.RunT(t)
+	rdb := common.RDB
+	common.RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		_ = common.RDB.Close()
+		common.RDB = rdb
+		common.RedisEnabled = false
+	})
+	return server
+}
+
+func getCachedQuota(t *testing.T, server *miniredis.Miniredis, key string) int64 {
+	value, err := server.Get(key)
+	require.NoError(t, err)
+	quota, err := strconv.ParseInt(value, 10, 64)
+	require.NoError(t, err)
+	return quota
+}
+
+func TestQuotaCacheKeepsPendingReservations(t *testing.T) {
+	setupTestDB(t)
+	user, token := createTestUserAndToken(t, 1000, 500)
+	server := setupTestRedis(t)
+	ctx := context.Background()
+	batchUpdateEnabled := config.BatchUpdateEnabled
+	config.BatchUpdateEnabled = true
+	defer func() {
+		config.BatchUpdateEnabled = batchUpdateEnabled
+	}()
+	userKey := userQuotaCacheKey(user.Id)
+	tokenKey := tokenQuotaCacheKey(token.Id)
+
+	_, err := ReserveQuota(ctx, user.Id, token.Id, 100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 900, getCachedQuota(t, server, userKey))
+	assert.EqualValues(t, 400, getCachedQuota(t, server, tokenKey))
+	// the reservation is still queued by the batch updater
+	userQuota, tokenQuota := getTestQuotas(t, user.Id, token.Id)
+	assert.EqualValues(t, 1000, userQuota)
+	assert.EqualValues(t, 500, tokenQuota)
+
+	// the expired cache is rebuilt without giving back the queued reservation
+	server.Del(userKey)
+	server.Del(tokenKey)
+	reservation, err := ReserveQuota(ctx, user.Id, token.Id, 100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 800, getCachedQuota(t, server, userKey))
+	assert.EqualValues(t, 300, getCachedQuota(t, server, tokenKey))
+
+	// the settlement is applied to the cache before it's queued
+	require.NoError(t, SettleQuotaReservation(ctx, reservation, 150, 0))
+	assert.EqualValues(t, 750, getCachedQuota(t, server, userKey))
+	assert.EqualValues(t, 250, getCachedQuota(t, server, tokenKey))
+	_, err = ReserveQuota(ctx, user.Id, token.Id, 300)
+	assert.ErrorIs(t, err, ErrInsufficientTokenQuota)
+
+	FlushBatchUpdates()
+	userQuota, tokenQuota = getTestQuotas(t, user.Id, token.Id)
+	assert.EqualValues(t, 750, userQuota)
+	assert.EqualValues(t, 250, tokenQuota)
+	pending, err := server.Get(userKey + ":pending")
+	require.NoError(t, err)
+	assert.Equal(t, "0", pending)
+	pending, err = server.Get(tokenKey + ":pending")
+	require.NoError(t, err)
+	assert.Equal(t, "0", pending)
+}
+
+func TestQuotaCacheInvalidatedByDirectChanges(t *testing.T) {
+	setupTestDB(t)
+	user, token := createTestUserAndToken(t, 1000, 500)
+	server := setupTestRedis(t)
+	ctx := context.Background()
+	userKey := userQuotaCacheKey(user.Id)
+
+	_, err := ReserveQuota(ctx, user.Id, token.Id, 100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 900, getCachedQuota(t, server, userKey))
+
+	require.NoError(t, IncreaseUserQuota(user.Id, 1000, QuotaTransaction{Type: QuotaTransactionTypeTopUp}))
+	assert.False(t, server.Exists(userKey))
+	_, err = ReserveQuota(ctx, user.Id, token.Id, 100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1800, getCachedQuota(t, server, userKey))
+
+	redemption := &Redemption{UserId: user.Id, Key: "quota-cache-test", Name: "test", Quota: 500, Status: RedemptionCodeStatusEnabled}
+	require.NoError(t, redemption.Insert())
+	_, err = Redeem(redemption.Key, user.Id)
+	require.NoError(t, err)
+	assert.False(t, server.Exists(userKey))
+
+	require.NoError(t, ChangeUserQuota(user.Id, -300, QuotaTransaction{Type: QuotaTransactionTypeAdjust}))
+	assert.False(t, server.Exists(userKey))
+}
+
+func TestRefreshQuotaCacheGivesUpOnChanges(t *testing.T) {
+	server := setupTestRedis(t)
+	ctx := context.Background()
+	key := userQuotaCacheKey(1)
+
+	// a reservation is applied while the quota is read from database
+	err := refreshQuotaCacheKey(ctx, key, time.Minute, func() (int64, error) {
+		cacheApplyQuotaTransaction(ctx, &QuotaTransaction{UserId: 1, Amount: -100})
+		return 1000, nil
+	})
+	require.NoError(t, err)
+	assert.False(t, server.Exists(key))
+
+	err = refreshQuotaCacheKey(ctx, key, time.Minute, func() (int64, error) {
+		return 1000, nil
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 900, getCachedQuota(t, server, key))
+}
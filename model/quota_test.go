@@ -0,0 +1,165 @@
+package model
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestDB opens a migrated SQLite database in a temporary directory, Redis is disabled
+func setupTestDB(t *testing.T) {
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	var err error
+	DB, err = openSQLite()
+	require.NoError(t, err)
+	LOG_DB = DB
+	require.NoError(t, migrateDB())
+	t.Cleanup(func() {
+		_ = closeDB(DB)
+	})
+}
+
+func createTestUserAndToken(t *testing.T, userQuota int64, tokenQuota int64) (*User, *Token) {
+	user := &User{Username: "quota-test", Password: "12345678", Status: UserStatusEnabled}
+	require.NoError(t, DB.Create(user).Error)
+	require.NoError(t, ChangeUserQuota(user.Id, userQuota, QuotaTransaction{Type: QuotaTransactionTypeTopUp}))
+	token := &Token{UserId: user.Id, Name: "test", Key: "test-key", Status: TokenStatusEnabled, RemainQuota: tokenQuota, ExpiredTime: -1}
+	require.NoError(t, token.Insert())
+	return user, token
+}
+
+func getTestQuotas(t *testing.T, userId int, tokenId int) (int64, int64) {
+	user, err := GetUserById(userId, false)
+	require.NoError(t, err)
+	token, err := GetTokenById(tokenId)
+	require.NoError(t, err)
+	return user.Quota, token.RemainQuota
+}
+
+func TestReserveAndSettleQuota(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, token := createTestUserAndToken(t, 1000, 500)
+
+	tests := []struct {
+		name       string
+		reserve    int64
+		settle     int64 // -1 means release
+		userQuota  int64
+		tokenQuota int64
+	}{
+		{"settle less than reserved", 300, 100, 900, 400},
+		{"settle more than reserved", 100, 150, 750, 250},
+		{"release", 200, -1, 750, 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reservation, err := ReserveQuota(ctx, user.Id, token.Id, tt.reserve)
+			require.NoError(t, err)
+			var count int64
+			DB.Model(&QuotaReservation{}).Where("id = ?", reservation.Id).Count(&count)
+			assert.EqualValues(t, 1, count)
+			if tt.settle < 0 {
+				err = ReleaseQuotaReservation(ctx, reservation)
+			} else {
+				err = SettleQuotaReservation(ctx, reservation, tt.settle, 0)
+			}
+			require.NoError(t, err)
+			userQuota, tokenQuota := getTestQuotas(t, user.Id, token.Id)
+			assert.Equal(t, tt.userQuota, userQuota)
+			assert.Equal(t, tt.tokenQuota, tokenQuota)
+			// the reservation can't be settled twice
+			require.NoError(t, ReleaseQuotaReservation(ctx, reservation))
+			userQuota, _ = getTestQuotas(t, user.Id, token.Id)
+			assert.Equal(t, tt.userQuota, userQuota)
+		})
+	}
+
+	_, err := ReserveQuota(ctx, user.Id, token.Id, 300)
+	assert.ErrorIs(t, err, ErrInsufficientTokenQuota)
+	_, err = ReserveQuota(ctx, user.Id, token.Id, 800)
+	assert.ErrorIs(t, err, ErrInsufficientUserQuota)
+	userQuota, tokenQuota := getTestQuotas(t, user.Id, token.Id)
+	assert.EqualValues(t, 750, userQuota)
+	assert.EqualValues(t, 250, tokenQuota)
+
+	inconsistencies, err := CheckQuotaTransactions(user.Id)
+	require.NoError(t, err)
+	assert.Empty(t, inconsistencies)
+}
+
+func TestBatchUpdateKeepsQuotaTransactions(t *testing.T) {
+	setupTestDB(t)
+	config.BatchUpdateEnabled = true
+	defer func() {
+		config.BatchUpdateEnabled = false
+	}()
+	ctx := context.Background()
+	user, token := createTestUserAndToken(t, 1000, 500)
+
+	first, err := ReserveQuota(ctx, user.Id, token.Id, 100)
+	require.NoError(t, err)
+	second, err := ReserveQuota(ctx, user.Id, token.Id, 200)
+	require.NoError(t, err)
+	require.NoError(t, SettleQuotaReservation(ctx, first, 50, 7))
+	require.NoError(t, ReleaseQuotaReservation(ctx, second))
+	// the reservations are checked against database, settlements wait for the batch update
+	userQuota, tokenQuota := getTestQuotas(t, user.Id, token.Id)
+	assert.EqualValues(t, 700, userQuota)
+	assert.EqualValues(t, 200, tokenQuota)
+
+	batchUpdate()
+	userQuota, tokenQuota = getTestQuotas(t, user.Id, token.Id)
+	assert.EqualValues(t, 950, userQuota)
+	assert.EqualValues(t, 450, tokenQuota)
+
+	transactions, err := GetUserQuotaTransactions(user.Id, QuotaTransactionTypeUnknown, 0, 10)
+	require.NoError(t, err)
+	// top up, token opening, two reserves, settle and refund
+	require.Len(t, transactions, 6)
+	settle := transactions[1]
+	assert.Equal(t, QuotaTransactionTypeSettle, settle.Type)
+	assert.Equal(t, 7, settle.LogId)
+	assert.Equal(t, first.Id, settle.ReservationId)
+	assert.EqualValues(t, 50, settle.Amount)
+	assert.EqualValues(t, 700, settle.BalanceBefore)
+	assert.EqualValues(t, 750, settle.BalanceAfter)
+	assert.EqualValues(t, 200, settle.TokenBalanceBefore)
+	assert.EqualValues(t, 250, settle.TokenBalanceAfter)
+	assert.Equal(t, QuotaTransactionTypeRefund, transactions[0].Type)
+	assert.EqualValues(t, 950, transactions[0].BalanceAfter)
+
+	inconsistencies, err := CheckQuotaTransactions(user.Id)
+	require.NoError(t, err)
+	assert.Empty(t, inconsistencies)
+}
+
+func TestTokenUpdateRecordsQuotaTransaction(t *testing.T) {
+	setupTestDB(t)
+	user, token := createTestUserAndToken(t, 1000, 500)
+	token.RemainQuota = 800
+	require.NoError(t, token.Update())
+
+	transactions, err := GetUserQuotaTransactions(user.Id, QuotaTransactionTypeAdjust, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, token.Id, transactions[0].TokenId)
+	assert.Equal(t, user.Id, transactions[0].ActorId)
+	assert.EqualValues(t, 0, transactions[0].Amount)
+	assert.EqualValues(t, 300, transactions[0].TokenAmount)
+	assert.EqualValues(t, 800, transactions[0].TokenBalanceAfter)
+
+	// the token is changed without the ledger
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Update("remain_quota", 900).Error)
+	inconsistencies, err := CheckQuotaTransactions(user.Id)
+	require.NoError(t, err)
+	require.Len(t, inconsistencies, 1)
+	assert.Equal(t, token.Id, inconsistencies[0].TokenId)
+	assert.EqualValues(t, 100, inconsistencies[0].Difference)
+}
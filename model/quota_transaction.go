@@ -0,0 +1,437 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+// QuotaTransaction is an append-only ledger entry of user, token and organization quota changes,
+// the sum of Amount of a user should always equal to the quota of the user,
+// the sum of TokenAmount of a token should always equal to the remain quota of the token,
+// and the sum of OrganizationAmount of an organization should always equal to the quota pool of the organization.
+// The top-ups of organizations are not made by users, their UserId is 0.
+type QuotaTransaction struct {
+	Id                        int    `json:"id"`
+	UserId                    int    `json:"user_id" gorm:"index"`
+	TokenId                   int    `json:"token_id" gorm:"default:0;index"`
+	OrganizationId            int    `json:"organization_id" gorm:"default:0;index"`
+	Type                      int    `json:"type" gorm:"index"`
+	Amount                    int64  `json:"amount" gorm:"bigint"`
+	BalanceBefore             int64  `json:"balance_before" gorm:"bigint"`
+	BalanceAfter              int64  `json:"balance_after" gorm:"bigint"`
+	TokenAmount               int64  `json:"token_amount" gorm:"bigint;default:0"` // change of the remain quota of the token
+	TokenBalanceBefore        int64  `json:"token_balance_before" gorm:"bigint;default:0"`
+	TokenBalanceAfter         int64  `json:"token_balance_after" gorm:"bigint;default:0"`
+	OrganizationAmount        int64  `json:"organization_amount" gorm:"bigint;default:0"` // change of the quota pool of the organization
+	OrganizationBalanceBefore int64  `json:"organization_balance_before" gorm:"bigint;default:0"`
+	OrganizationBalanceAfter  int64  `json:"organization_balance_after" gorm:"bigint;default:0"`
+	ActorId                   int    `json:"actor_id" gorm:"default:0"` // 0 means system
+	Reason                    string `json:"reason" gorm:"default:''"`
+	LogId                     int    `json:"log_id" gorm:"default:0"`
+	RedemptionId              int    `json:"redemption_id" gorm:"default:0"`
+	ReservationId             int    `json:"reservation_id" gorm:"default:0"`
+	CreatedTime               int64  `json:"created_time" gorm:"bigint;index"`
+	cached                    bool   // applied to the quota cache before written into database
+}
+
+const (
+	QuotaTransactionTypeUnknown = iota
+	QuotaTransactionTypeOpening // balance before the ledger was introduced
+	QuotaTransactionTypeRegister
+	QuotaTransactionTypeInvite
+	QuotaTransactionTypeRedeem
+	QuotaTransactionTypeTopUp
+	QuotaTransactionTypeAdjust
+	QuotaTransactionTypeReserve
+	QuotaTransactionTypeSettle
+	QuotaTransactionTypeRefund
+	QuotaTransactionTypeBatch // merged by the batch updater, only in old records
+)
+
+// QuotaInconsistency is reported when the ledger doesn't match the user quota, the remain quota if TokenId is not 0,
+// or the quota pool if OrganizationId is not 0
+type QuotaInconsistency struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	TokenId          int    `json:"token_id,omitempty"`
+	TokenName        string `json:"token_name,omitempty"`
+	OrganizationId   int    `json:"organization_id,omitempty"`
+	OrganizationName string `json:"organization_name,omitempty"`
+	Quota            int64  `json:"quota"`
+	LedgerQuota      int64  `json:"ledger_quota"`
+	Difference       int64  `json:"difference"`
+}
+
+// batchable transactions are queued by the batch updater if it's enabled
+func (transaction *QuotaTransaction) batchable() bool {
+	switch transaction.Type {
+	case QuotaTransactionTypeReserve, QuotaTransactionTypeSettle, QuotaTransactionTypeRefund:
+		return true
+	}
+	return false
+}
+
+// recordQuotaTransaction must be called in the same db transaction right after the quota is changed,
+// amount is the change of the user quota, transaction.TokenAmount and transaction.OrganizationAmount
+// are the changes of the token remain quota and the organization quota pool
+func recordQuotaTransaction(tx *gorm.DB, userId int, amount int64, transaction QuotaTransaction) (*QuotaTransaction, error) {
+	transaction.UserId = userId
+	transaction.Amount = amount
+	transactions := []*QuotaTransaction{&transaction}
+	err := fillQuotaTransactionBalances(tx, transactions)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Create(&transaction).Error
+	return &transaction, err
+}
+
+// fillQuotaTransactionBalances computes the balances of the transactions of one user in order,
+// the quota changes must have been applied already
+func fillQuotaTransactionBalances(tx *gorm.DB, transactions []*QuotaTransaction) error {
+	userId := transactions[0].UserId
+	var balance int64
+	err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&balance).Error
+	if err != nil {
+		return err
+	}
+	tokenBalances := make(map[int]int64)
+	organizationBalances := make(map[int]int64)
+	for _, transaction := range transactions {
+		balance -= transaction.Amount
+		if transaction.TokenId != 0 && transaction.TokenAmount != 0 {
+			if _, ok := tokenBalances[transaction.TokenId]; !ok {
+				var remainQuota int64
+				err = tx.Model(&Token{}).Where("id = ?", transaction.TokenId).Select("remain_quota").Find(&remainQuota).Error
+				if err != nil {
+					return err
+				}
+				tokenBalances[transaction.TokenId] = remainQuota
+			}
+			tokenBalances[transaction.TokenId] -= transaction.TokenAmount
+		}
+		if transaction.OrganizationId != 0 && transaction.OrganizationAmount != 0 {
+			if _, ok := organizationBalances[transaction.OrganizationId]; !ok {
+				var quota int64
+				err = tx.Model(&Organization{}).Where("id = ?", transaction.OrganizationId).Select("quota").Find(&quota).Error
+				if err != nil {
+					return err
+				}
+				organizationBalances[transaction.OrganizationId] = quota
+			}
+			organizationBalances[transaction.OrganizationId] -= transaction.OrganizationAmount
+		}
+	}
+	now := helper.GetTimestamp()
+	for _, transaction := range transactions {
+		transaction.Id = 0
+		transaction.UserId = userId
+		transaction.BalanceBefore = balance
+		balance += transaction.Amount
+		transaction.BalanceAfter = balance
+		if transaction.TokenId != 0 && transaction.TokenAmount != 0 {
+			transaction.TokenBalanceBefore = tokenBalances[transaction.TokenId]
+			tokenBalances[transaction.TokenId] += transaction.TokenAmount
+			transaction.TokenBalanceAfter = tokenBalances[transaction.TokenId]
+		}
+		if transaction.OrganizationId != 0 && transaction.OrganizationAmount != 0 {
+			transaction.OrganizationBalanceBefore = organizationBalances[transaction.OrganizationId]
+			organizationBalances[transaction.OrganizationId] += transaction.OrganizationAmount
+			transaction.OrganizationBalanceAfter = organizationBalances[transaction.OrganizationId]
+		}
+		if transaction.CreatedTime == 0 {
+			transaction.CreatedTime = now
+		}
+	}
+	return nil
+}
+
+// applyQuotaTransactions changes the quota of one user, the remain quota of the tokens and the quota pool of the organizations,
+// and records the transactions in the ledger, it must be called in a db transaction.
+// The changes of the remain quota and the quota pool are counted as consumption of the tokens and the organization members.
+func applyQuotaTransactions(tx *gorm.DB, transactions []*QuotaTransaction) error {
+	var amount int64
+	tokenAmounts := make(map[int]int64)
+	organizationAmounts := make(map[int]int64)
+	for _, transaction := range transactions {
+		amount += transaction.Amount
+		if transaction.TokenId != 0 && transaction.TokenAmount != 0 {
+			tokenAmounts[transaction.TokenId] += transaction.TokenAmount
+		}
+		if transaction.OrganizationId != 0 && transaction.OrganizationAmount != 0 {
+			organizationAmounts[transaction.OrganizationId] += transaction.OrganizationAmount
+		}
+	}
+	if amount != 0 {
+		result := tx.Model(&User{}).Where("id = ?", transactions[0].UserId).Update("quota", gorm.Expr("quota + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户不存在")
+		}
+	}
+	for tokenId, tokenAmount := range tokenAmounts {
+		err := tx.Model(&Token{}).Where("id = ?", tokenId).Updates(
+			map[string]interface{}{
+				"remain_quota":  gorm.Expr("remain_quota + ?", tokenAmount),
+				"used_quota":    gorm.Expr("used_quota - ?", tokenAmount),
+				"accessed_time": helper.GetTimestamp(),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	for organizationId, organizationAmount := range organizationAmounts {
+		err := tx.Model(&OrganizationMember{}).Where("organization_id = ? and user_id = ?", organizationId, transactions[0].UserId).
+			Update("used_quota", gorm.Expr("used_quota - ?", organizationAmount)).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Organization{}).Where("id = ?", organizationId).Updates(
+			map[string]interface{}{
+				"quota":      gorm.Expr("quota + ?", organizationAmount),
+				"used_quota": gorm.Expr("used_quota - ?", organizationAmount),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	err := fillQuotaTransactionBalances(tx, transactions)
+	if err != nil {
+		return err
+	}
+	return tx.CreateInBatches(transactions, 100).Error
+}
+
+// changeQuota changes the user quota by transaction.Amount, the remain quota of transaction.TokenId
+// by transaction.TokenAmount and the quota pool of transaction.OrganizationId by transaction.OrganizationAmount,
+// batchable transactions are queued if the batch updater is enabled
+func changeQuota(transaction *QuotaTransaction) error {
+	if transaction.Amount == 0 && transaction.TokenAmount == 0 && transaction.OrganizationAmount == 0 {
+		return nil
+	}
+	if config.BatchUpdateEnabled && transaction.batchable() {
+		addQuotaTransaction(transaction)
+		return nil
+	}
+	return writeQuotaTransactions([]*QuotaTransaction{transaction})
+}
+
+// writeQuotaTransactions applies the transactions of one user in a db transaction and syncs the quota cache,
+// the pending amounts of the cached transactions are released even if it fails, as they won't be retried
+func writeQuotaTransactions(transactions []*QuotaTransaction) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return applyQuotaTransactions(tx, transactions)
+	})
+	if err == nil {
+		syncQuotaCache(transactions)
+		return nil
+	}
+	var cached []*QuotaTransaction
+	for _, transaction := range transactions {
+		if transaction.cached {
+			cached = append(cached, transaction)
+		}
+	}
+	syncQuotaCache(cached)
+	return err
+}
+
+// ChangeUserQuota changes the user quota by amount immediately and records it in the ledger
+func ChangeUserQuota(userId int, amount int64, transaction QuotaTransaction) error {
+	if amount == 0 {
+		return nil
+	}
+	transaction.UserId = userId
+	transaction.Amount = amount
+	transaction.TokenAmount = 0
+	return writeQuotaTransactions([]*QuotaTransaction{&transaction})
+}
+
+// SetUserQuota sets the user quota by the administrator, the difference with the current quota is recorded in the ledger,
+// the conditional update is retried if the quota is changed meanwhile, nil is returned if the quota is not changed
+func SetUserQuota(userId int, quota int64, actorId int) (*QuotaTransaction, error) {
+	var transaction *QuotaTransaction
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < 3; i++ {
+			var before int64
+			err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&before).Error
+			if err != nil {
+				return err
+			}
+			if before == quota {
+				return nil
+			}
+			result := tx.Model(&User{}).Where("id = ? and quota = ?", userId, before).Update("quota", quota)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			transaction, err = recordQuotaTransaction(tx, userId, quota-before, QuotaTransaction{
+				Type:    QuotaTransactionTypeAdjust,
+				ActorId: actorId,
+				Reason:  fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(before), common.LogQuota(quota)),
+			})
+			return err
+		}
+		return errors.New("用户额度正在变动，请稍后重试")
+	})
+	if err != nil || transaction == nil {
+		return nil, err
+	}
+	syncQuotaCache([]*QuotaTransaction{transaction})
+	return transaction, nil
+}
+
+func GetUserQuotaTransactions(userId int, transactionType int, startIdx int, num int) (transactions []*QuotaTransaction, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if transactionType != QuotaTransactionTypeUnknown {
+		tx = tx.Where("type = ?", transactionType)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&transactions).Error
+	return transactions, err
+}
+
+// CheckQuotaTransactions recomputes the balances of users, tokens and organizations from the ledger and returns those that don't match,
+// userId 0 means all users and organizations. Quota changes still waiting in the batch updater are not counted.
+func CheckQuotaTransactions(userId int) ([]*QuotaInconsistency, error) {
+	var inconsistencies []*QuotaInconsistency
+	tx := DB.Table("users").
+		Select("users.id as user_id, users.username as username, users.quota as quota, coalesce(sum(quota_transactions.amount), 0) as ledger_quota").
+		Joins("left join quota_transactions on quota_transactions.user_id = users.id").
+		Group("users.id, users.username, users.quota")
+	if userId != 0 {
+		tx = tx.Where("users.id = ?", userId)
+	}
+	err := tx.Having("users.quota <> coalesce(sum(quota_transactions.amount), 0)").Scan(&inconsistencies).Error
+	if err != nil {
+		return nil, err
+	}
+	var tokenInconsistencies []*QuotaInconsistency
+	tx = DB.Table("tokens").
+		Select("tokens.user_id as user_id, tokens.id as token_id, tokens.name as token_name, tokens.remain_quota as quota, coalesce(sum(quota_transactions.token_amount), 0) as ledger_quota").
+		Joins("left join quota_transactions on quota_transactions.token_id = tokens.id").
+		Group("tokens.id, tokens.user_id, tokens.name, tokens.remain_quota")
+	if userId != 0 {
+		tx = tx.Where("tokens.user_id = ?", userId)
+	}
+	err = tx.Having("tokens.remain_quota <> coalesce(sum(quota_transactions.token_amount), 0)").Scan(&tokenInconsistencies).Error
+	if err != nil {
+		return nil, err
+	}
+	inconsistencies = append(inconsistencies, tokenInconsistencies...)
+	if userId == 0 {
+		var organizationInconsistencies []*QuotaInconsistency
+		err = DB.Table("organizations").
+			Select("organizations.id as organization_id, organizations.name as organization_name, organizations.quota as quota, coalesce(sum(quota_transactions.organization_amount), 0) as ledger_quota").
+			Joins("left join quota_transactions on quota_transactions.organization_id = organizations.id").
+			Group("organizations.id, organizations.name, organizations.quota").
+			Having("organizations.quota <> coalesce(sum(quota_transactions.organization_amount), 0)").
+			Scan(&organizationInconsistencies).Error
+		if err != nil {
+			return nil, err
+		}
+		inconsistencies = append(inconsistencies, organizationInconsistencies...)
+	}
+	for _, inconsistency := range inconsistencies {
+		inconsistency.Difference = inconsistency.Quota - inconsistency.LedgerQuota
+	}
+	return inconsistencies, nil
+}
+
+// migrateQuotaTransactions records the opening balances of the users who have no ledger entries yet
+func migrateQuotaTransactions() error {
+	var userIds []int
+	err := DB.Model(&User{}).Where("id not in (?)", DB.Model(&QuotaTransaction{}).Distinct("user_id")).Pluck("id", &userIds).Error
+	if err != nil || len(userIds) == 0 {
+		return err
+	}
+	logger.SysLog(fmt.Sprintf("recording opening balances of %d users in quota ledger", len(userIds)))
+	for _, userId := range userIds {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			var quota int64
+			err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&quota).Error
+			if err != nil {
+				return err
+			}
+			_, err = recordQuotaTransaction(tx, userId, quota, QuotaTransaction{
+				Type:   QuotaTransactionTypeOpening,
+				Reason: "期初余额",
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTokenQuotaTransactions records the opening remain quota of the tokens which have no opening entries yet
+func migrateTokenQuotaTransactions() error {
+	var tokens []*Token
+	err := DB.Select("id", "user_id", "remain_quota").
+		Where("id not in (?)", DB.Model(&QuotaTransaction{}).Where("type = ? and token_id <> 0", QuotaTransactionTypeOpening).Distinct("token_id")).
+		Find(&tokens).Error
+	if err != nil || len(tokens) == 0 {
+		return err
+	}
+	logger.SysLog(fmt.Sprintf("recording opening remain quota of %d tokens in quota ledger", len(tokens)))
+	for _, token := range tokens {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			return recordTokenOpening(tx, token, "期初余额")
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateOrganizationQuotaTransactions records the opening quota pool of the organizations which have no ledger entries yet
+func migrateOrganizationQuotaTransactions() error {
+	var organizations []*Organization
+	err := DB.Select("id", "quota").
+		Where("quota <> 0 and id not in (?)", DB.Model(&QuotaTransaction{}).Where("organization_id <> 0").Distinct("organization_id")).
+		Find(&organizations).Error
+	if err != nil || len(organizations) == 0 {
+		return err
+	}
+	logger.SysLog(fmt.Sprintf("recording opening quota pool of %d organizations in quota ledger", len(organizations)))
+	for _, organization := range organizations {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			_, err := recordQuotaTransaction(tx, 0, 0, QuotaTransaction{
+				Type:               QuotaTransactionTypeOpening,
+				OrganizationId:     organization.Id,
+				OrganizationAmount: organization.Quota,
+				Reason:             "期初余额",
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordTokenOpening(tx *gorm.DB, token *Token, reason string) error {
+	_, err := recordQuotaTransaction(tx, token.UserId, 0, QuotaTransaction{
+		Type:        QuotaTransactionTypeOpening,
+		TokenId:     token.Id,
+		TokenAmount: token.RemainQuota,
+		Reason:      reason,
+	})
+	return err
+}
@@ -56,6 +56,7 @@ func Redeem(key string, userId int) (quota int64, err error) {
 		return 0, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
+	var transaction *QuotaTransaction
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
@@ -74,6 +75,15 @@ func Redeem(key string, userId int) (quota int64, err error) {
 		if err != nil {
 			return err
 		}
+		transaction, err = recordQuotaTransaction(tx, userId, redemption.Quota, QuotaTransaction{
+			Type:         QuotaTransactionTypeRedeem,
+			ActorId:      userId,
+			Reason:       "通过兑换码充值",
+			RedemptionId: redemption.Id,
+		})
+		if err != nil {
+			return err
+		}
 		redemption.RedeemedTime = helper.GetTimestamp()
 		redemption.Status = RedemptionCodeStatusUsed
 		err = tx.Save(redemption).Error
@@ -82,6 +92,7 @@ func Redeem(key string, userId int) (quota int64, err error) {
 	if err != nil {
 		return 0, errors.New("兑换失败，" + err.Error())
 	}
+	syncQuotaCache([]*QuotaTransaction{transaction})
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(redemption.Quota)))
 	return redemption.Quota, nil
 }
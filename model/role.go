@@ -0,0 +1,307 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// permissions guard the management APIs, a user has the permissions of the built-in role (User.Role)
+// and the permissions of the custom role assigned to the user (User.RoleId)
+const (
+	PermissionChannelRead        = "channel.read"
+	PermissionChannelWrite       = "channel.write"
+	PermissionChannelExport      = "channel.export" // export and import channels with keys
+	PermissionUserRead           = "user.read"
+	PermissionUserWrite          = "user.write"
+	PermissionTopUp              = "topup"
+	PermissionOptionRead         = "option.read"
+	PermissionOptionWrite        = "option.write"
+	PermissionRedemptionRead     = "redemption.read"
+	PermissionRedemptionWrite    = "redemption.write"
+	PermissionLogRead            = "log.read"
+	PermissionLogDelete          = "log.delete"
+	PermissionTransactionRead    = "transaction.read"
+	PermissionTransactionCheck   = "transaction.check"
+	PermissionPriceRead          = "price.read"
+	PermissionPriceWrite         = "price.write"
+	PermissionGroupRead          = "group.read"
+	PermissionAuditRead          = "audit.read"
+	PermissionRoleManage         = "role.manage"
+	PermissionOrganizationManage = "organization.manage" // manage all organizations, members are managed by the organization admins too
+)
+
+var AllPermissions = []string{
+	PermissionChannelRead, PermissionChannelWrite, PermissionChannelExport,
+	PermissionUserRead, PermissionUserWrite, PermissionTopUp,
+	PermissionOptionRead, PermissionOptionWrite,
+	PermissionRedemptionRead, PermissionRedemptionWrite,
+	PermissionLogRead, PermissionLogDelete,
+	PermissionTransactionRead, PermissionTransactionCheck,
+	PermissionPriceRead, PermissionPriceWrite,
+	PermissionGroupRead, PermissionAuditRead, PermissionRoleManage,
+	PermissionOrganizationManage,
+}
+
+var adminPermissions = []string{
+	PermissionChannelRead, PermissionChannelWrite,
+	PermissionUserRead, PermissionUserWrite, PermissionTopUp,
+	PermissionRedemptionRead, PermissionRedemptionWrite,
+	PermissionLogRead, PermissionLogDelete,
+	PermissionTransactionRead, PermissionGroupRead, PermissionOrganizationManage,
+}
+
+// BuiltInRole maps the fixed roles to permissions, so that they keep working as before
+type BuiltInRole struct {
+	Name        string   `json:"name"`
+	Role        int      `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+var BuiltInRoles = []BuiltInRole{
+	{Name: "common", Role: RoleCommonUser, Permissions: []string{}},
+	{Name: "admin", Role: RoleAdminUser, Permissions: adminPermissions},
+	{Name: "root", Role: RoleRootUser, Permissions: AllPermissions},
+}
+
+// Role is a custom role, Permissions are separated by comma
+type Role struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(32);uniqueIndex"`
+	Description string `json:"description" gorm:"default:''"`
+	Permissions string `json:"permissions" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+var roleId2permissions map[int]map[string]bool
+var roleId2permissionsLock sync.RWMutex
+
+func InitRoles() {
+	var roles []*Role
+	err := DB.Find(&roles).Error
+	if err != nil {
+		logger.SysError("failed to load roles: " + err.Error())
+		return
+	}
+	newRoleId2permissions := make(map[int]map[string]bool, len(roles))
+	for _, role := range roles {
+		newRoleId2permissions[role.Id] = role.permissionSet()
+	}
+	roleId2permissionsLock.Lock()
+	roleId2permissions = newRoleId2permissions
+	roleId2permissionsLock.Unlock()
+}
+
+func (role *Role) permissionSet() map[string]bool {
+	permissions := make(map[string]bool)
+	for _, permission := range strings.Split(role.Permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission != "" {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
+
+// normalize validates the permissions and sorts them
+func (role *Role) normalize() error {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return errors.New("角色名称不能为空")
+	}
+	for _, builtInRole := range BuiltInRoles {
+		if role.Name == builtInRole.Name {
+			return fmt.Errorf("角色名称 %s 已被内置角色使用", role.Name)
+		}
+	}
+	valid := make(map[string]bool, len(AllPermissions))
+	for _, permission := range AllPermissions {
+		valid[permission] = true
+	}
+	var permissions []string
+	for permission := range role.permissionSet() {
+		if !valid[permission] {
+			return fmt.Errorf("未知的权限：%s", permission)
+		}
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	role.Permissions = strings.Join(permissions, ",")
+	return nil
+}
+
+func GetAllRoles() (roles []*Role, err error) {
+	err = DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetRoleById(id int) (*Role, error) {
+	role := Role{}
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+func (role *Role) Insert() error {
+	err := role.normalize()
+	if err != nil {
+		return err
+	}
+	role.CreatedTime = helper.GetTimestamp()
+	err = DB.Create(role).Error
+	if err == nil {
+		publishCacheEvent(cacheEvent{Type: cacheEventRole, Id: role.Id})
+	}
+	return err
+}
+
+func (role *Role) Update() error {
+	err := role.normalize()
+	if err != nil {
+		return err
+	}
+	err = DB.Model(role).Select("name", "description", "permissions").Updates(role).Error
+	if err == nil {
+		publishCacheEvent(cacheEvent{Type: cacheEventRole, Id: role.Id})
+	}
+	return err
+}
+
+// Delete removes the role and unassigns it from the users
+func (role *Role) Delete() error {
+	var userIds []int
+	err := DB.Model(&User{}).Where("role_id = ?", role.Id).Pluck("id", &userIds).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&User{}).Where("role_id = ?", role.Id).Update("role_id", 0).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Delete(role).Error
+	if err != nil {
+		return err
+	}
+	publishCacheEvent(cacheEvent{Type: cacheEventRole, Id: role.Id})
+	for _, userId := range userIds {
+		publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: userId})
+	}
+	return nil
+}
+
+// AssignUserRole assigns the custom role to the user, roleId 0 means no custom role
+func AssignUserRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetRoleById(roleId); err != nil {
+			return errors.New("角色不存在")
+		}
+	}
+	result := DB.Model(&User{}).Where("id = ?", userId).Update("role_id", roleId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户不存在")
+	}
+	publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: userId})
+	return nil
+}
+
+func GetUserRoleId(id int) (roleId int, err error) {
+	err = DB.Model(&User{}).Where("id = ?", id).Select("role_id").Find(&roleId).Error
+	return roleId, err
+}
+
+func CacheGetUserRoleId(id int) (roleId int, err error) {
+	if !common.RedisEnabled {
+		return GetUserRoleId(id)
+	}
+	roleIdString, err := common.RedisGet(fmt.Sprintf("user_role_id:%d", id))
+	if err != nil {
+		roleId, err = GetUserRoleId(id)
+		if err != nil {
+			return 0, err
+		}
+		err = common.RedisSet(fmt.Sprintf("user_role_id:%d", id), strconv.Itoa(roleId), time.Duration(UserId2GroupCacheSeconds)*time.Second)
+		if err != nil {
+			logger.SysError("Redis set user role id error: " + err.Error())
+		}
+		return roleId, nil
+	}
+	return strconv.Atoi(roleIdString)
+}
+
+func builtInRoleHasPermission(role int, permission string) bool {
+	// the built-in roles are ordered by level, take the highest one the user reaches
+	var permissions []string
+	for _, builtInRole := range BuiltInRoles {
+		if role >= builtInRole.Role {
+			permissions = builtInRole.Permissions
+		}
+	}
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks the built-in role first, then the custom role of the user
+func HasPermission(userId int, role int, permission string) bool {
+	if builtInRoleHasPermission(role, permission) {
+		return true
+	}
+	roleId, err := CacheGetUserRoleId(userId)
+	if err != nil || roleId == 0 {
+		return false
+	}
+	roleId2permissionsLock.RLock()
+	defer roleId2permissionsLock.RUnlock()
+	return roleId2permissions[roleId][permission]
+}
+
+// GetUserPermissions returns all the permissions of the user, it's used by the frontend to render menus
+func GetUserPermissions(userId int, role int) []string {
+	roleId, _ := CacheGetUserRoleId(userId)
+	roleId2permissionsLock.RLock()
+	customPermissions := roleId2permissions[roleId]
+	roleId2permissionsLock.RUnlock()
+	permissions := make([]string, 0)
+	for _, permission := range AllPermissions {
+		if builtInRoleHasPermission(role, permission) || customPermissions[permission] {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// CanManageUser tells whether the operator can manage the target user with the given built-in role,
+// the permissions of the target must be a strict subset of the operator's, so that nobody can take over
+// the users with the same permissions or the permissions they don't have, the root user can manage everyone
+func CanManageUser(operatorId int, operatorRole int, targetId int, targetRole int) bool {
+	if operatorRole == RoleRootUser {
+		return true
+	}
+	operatorPermissions := make(map[string]bool)
+	for _, permission := range GetUserPermissions(operatorId, operatorRole) {
+		operatorPermissions[permission] = true
+	}
+	targetPermissions := GetUserPermissions(targetId, targetRole)
+	if len(targetPermissions) >= len(operatorPermissions) {
+		return false
+	}
+	for _, permission := range targetPermissions {
+		if !operatorPermissions[permission] {
+			return false
+		}
+	}
+	return true
+}
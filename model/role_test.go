@@ -0,0 +1,120 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleNormalize(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        Role
+		permissions string
+		wantErr     bool
+	}{
+		{"sorted and deduplicated", Role{Name: " ops ", Permissions: "log.read, channel.read,log.read,"}, "channel.read,log.read", false},
+		{"empty permissions", Role{Name: "viewer"}, "", false},
+		{"empty name", Role{Name: " ", Permissions: "log.read"}, "", true},
+		{"built-in name", Role{Name: "admin", Permissions: "log.read"}, "", true},
+		{"unknown permission", Role{Name: "ops", Permissions: "log.read,log.write"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.role.normalize()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.permissions, tt.role.Permissions)
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	setupTestDB(t)
+	role := &Role{Name: "ops", Permissions: "channel.read,audit.read"}
+	require.NoError(t, role.Insert())
+	user, _ := createTestUserAndToken(t, 0, 0)
+	require.NoError(t, AssignUserRole(user.Id, role.Id))
+
+	tests := []struct {
+		name       string
+		userId     int
+		role       int
+		permission string
+		want       bool
+	}{
+		{"common user", 0, RoleCommonUser, PermissionChannelRead, false},
+		{"admin", 0, RoleAdminUser, PermissionChannelWrite, true},
+		{"admin without root permission", 0, RoleAdminUser, PermissionOptionWrite, false},
+		{"root", 0, RoleRootUser, PermissionOptionWrite, true},
+		{"custom role", user.Id, RoleCommonUser, PermissionAuditRead, true},
+		{"custom role without permission", user.Id, RoleCommonUser, PermissionChannelWrite, false},
+		{"custom role adds to built-in role", user.Id, RoleAdminUser, PermissionAuditRead, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HasPermission(tt.userId, tt.role, tt.permission))
+		})
+	}
+	assert.Equal(t, []string{PermissionChannelRead, PermissionAuditRead}, GetUserPermissions(user.Id, RoleCommonUser))
+
+	// the permissions follow the role changes
+	role.Permissions = "channel.write"
+	require.NoError(t, role.Update())
+	assert.False(t, HasPermission(user.Id, RoleCommonUser, PermissionChannelRead))
+	assert.True(t, HasPermission(user.Id, RoleCommonUser, PermissionChannelWrite))
+
+	require.NoError(t, role.Delete())
+	assert.False(t, HasPermission(user.Id, RoleCommonUser, PermissionChannelWrite))
+	roleId, err := GetUserRoleId(user.Id)
+	require.NoError(t, err)
+	assert.Zero(t, roleId)
+	assert.Error(t, AssignUserRole(user.Id, role.Id))
+}
+
+func TestCanManageUser(t *testing.T) {
+	setupTestDB(t)
+	withConfig := &Role{Name: "config", Permissions: "option.write"}
+	require.NoError(t, withConfig.Insert())
+	withAudit := &Role{Name: "auditor", Permissions: "audit.read"}
+	require.NoError(t, withAudit.Insert())
+	newUser := func(username string, roleId int) int {
+		user := &User{Username: username, Password: "12345678", Status: UserStatusEnabled, AccessToken: username, AffCode: username}
+		require.NoError(t, DB.Create(user).Error)
+		if roleId != 0 {
+			require.NoError(t, AssignUserRole(user.Id, roleId))
+		}
+		return user.Id
+	}
+	plain := newUser("plain", 0)
+	config := newUser("config", withConfig.Id)
+	auditor := newUser("auditor", withAudit.Id)
+
+	tests := []struct {
+		name         string
+		operatorId   int
+		operatorRole int
+		targetId     int
+		targetRole   int
+		want         bool
+	}{
+		{"root manages root", 0, RoleRootUser, 0, RoleRootUser, true},
+		{"admin manages common user", 0, RoleAdminUser, plain, RoleCommonUser, true},
+		{"admin can't manage admin", 0, RoleAdminUser, plain, RoleAdminUser, false},
+		{"admin can't manage root", 0, RoleAdminUser, plain, RoleRootUser, false},
+		{"admin can't manage the permissions it doesn't have", 0, RoleAdminUser, config, RoleCommonUser, false},
+		{"admin with more permissions manages admin", auditor, RoleAdminUser, plain, RoleAdminUser, true},
+		{"admin can't manage admin with other permissions", auditor, RoleAdminUser, config, RoleAdminUser, false},
+		{"custom role manages common user", auditor, RoleCommonUser, plain, RoleCommonUser, true},
+		{"common user can't manage common user", plain, RoleCommonUser, plain, RoleCommonUser, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CanManageUser(tt.operatorId, tt.operatorRole, tt.targetId, tt.targetRole))
+		})
+	}
+}
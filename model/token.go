@@ -1,16 +1,20 @@
 package model
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
+
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/message"
 	"gorm.io/gorm"
 )
 
+const tokenKeyPrefixLength = 6
+
 const (
 	TokenStatusEnabled   = 1 // don't use 0, 0 is the default value!
 	TokenStatusDisabled  = 2 // also don't use 0
@@ -21,7 +25,9 @@ const (
 type Token struct {
 	Id             int     `json:"id"`
 	UserId         int     `json:"user_id"`
-	Key            string  `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key            string  `json:"key,omitempty" gorm:"-:all"` // the plaintext key, only available right after the token is created
+	KeyHash        string  `json:"-" gorm:"column:key;type:varchar(64);uniqueIndex"`
+	KeyPrefix      string  `json:"key_prefix" gorm:"type:varchar(8);default:''"` // visible prefix of the key, empty if the token is not hashed yet
 	Status         int     `json:"status" gorm:"default:1"`
 	Name           string  `json:"name" gorm:"index" `
 	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
@@ -29,9 +35,10 @@ type Token struct {
 	ExpiredTime    int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
 	RemainQuota    int64   `json:"remain_quota" gorm:"bigint;default:0"`
 	UnlimitedQuota bool    `json:"unlimited_quota" gorm:"default:false"`
-	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
-	Models         *string `json:"models" gorm:"type:text"`            // allowed models
-	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"`     // used quota
+	Models         *string `json:"models" gorm:"type:text"`                // allowed models
+	Subnet         *string `json:"subnet" gorm:"default:''"`               // allowed subnet
+	OrganizationId int     `json:"organization_id" gorm:"default:0;index"` // the token draws from the organization quota pool if not 0
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -121,30 +128,133 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// HashTokenKey returns the SHA-256 hash of the key stored in database, it's base64 encoded to fit the key column
+func HashTokenKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func getTokenKeyPrefix(key string) string {
+	// don't reveal too much of short keys, such as INITIAL_ROOT_TOKEN
+	length := len(key) / 2
+	if length > tokenKeyPrefixLength {
+		length = tokenKeyPrefixLength
+	}
+	if length == 0 {
+		length = len(key)
+	}
+	return key[:length]
+}
+
+// Insert stores the hash of t.Key, t.Key is kept so that it can be shown to the user once
 func (t *Token) Insert() error {
-	var err error
-	err = DB.Create(t).Error
-	return err
+	if t.Key == "" {
+		return errors.New("令牌为空！")
+	}
+	t.KeyHash = HashTokenKey(t.Key)
+	t.KeyPrefix = getTokenKeyPrefix(t.Key)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(t).Error
+		if err != nil {
+			return err
+		}
+		return recordTokenOpening(tx, t, "创建令牌")
+	})
 }
 
-// Update Make sure your token's fields is completed, because this will update non-zero values
+// Update Make sure your token's fields is completed, because this will update non-zero values.
+// The change of remain quota is recorded in the ledger with the owner as the actor.
 func (t *Token) Update() error {
-	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var remainQuota int64
+		err := tx.Model(&Token{}).Where("id = ?", t.Id).Select("remain_quota").Find(&remainQuota).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "organization_id").Updates(t).Error
+		if err != nil || t.RemainQuota == remainQuota {
+			return err
+		}
+		_, err = recordQuotaTransaction(tx, t.UserId, 0, QuotaTransaction{
+			Type:        QuotaTransactionTypeAdjust,
+			TokenId:     t.Id,
+			TokenAmount: t.RemainQuota - remainQuota,
+			ActorId:     t.UserId,
+			Reason:      "修改令牌剩余额度",
+		})
+		return err
+	})
+	if err == nil {
+		// remain quota may be changed, the reserved quota cache is invalid now
+		t.publishCacheEvent()
+	}
 	return err
 }
 
 func (t *Token) SelectUpdate() error {
 	// This can update zero values
-	return DB.Model(t).Select("accessed_time", "status").Updates(t).Error
+	err := DB.Model(t).Select("accessed_time", "status").Updates(t).Error
+	if err == nil {
+		t.publishCacheEvent()
+	}
+	return err
 }
 
 func (t *Token) Delete() error {
 	var err error
 	err = DB.Delete(t).Error
+	if err == nil {
+		t.publishCacheEvent()
+	}
 	return err
 }
 
+// DisableUserTokens disables all the enabled tokens of the user, it's used when the user is deprovisioned
+func DisableUserTokens(userId int) error {
+	var tokens []*Token
+	err := DB.Where("user_id = ? and status = ?", userId, TokenStatusEnabled).Find(&tokens).Error
+	if err != nil || len(tokens) == 0 {
+		return err
+	}
+	err = DB.Model(&Token{}).Where("user_id = ? and status = ?", userId, TokenStatusEnabled).Update("status", TokenStatusDisabled).Error
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		token.publishCacheEvent()
+	}
+	return nil
+}
+
+// publishCacheEvent removes the cached token on all the nodes
+func (t *Token) publishCacheEvent() {
+	publishCacheEvent(cacheEvent{Type: cacheEventToken, Id: t.Id, Key: t.KeyHash})
+}
+
+// migrateTokenKeys replaces the plaintext keys of old tokens with their hashes, the keys in use keep working,
+// the tokens without key are skipped, they can't be used and their key prefix stays empty
+func migrateTokenKeys() error {
+	var tokens []struct {
+		Id  int
+		Key string
+	}
+	err := DB.Model(&Token{}).Select("id", "key").Where("key_prefix = ?", "").Not(map[string]any{"key": ""}).Find(&tokens).Error
+	if err != nil || len(tokens) == 0 {
+		return err
+	}
+	logger.SysLog(fmt.Sprintf("hashing keys of %d tokens", len(tokens)))
+	for _, token := range tokens {
+		err = DB.Model(&Token{}).Where("id = ?", token.Id).Updates(map[string]any{
+			"key":        HashTokenKey(token.Key),
+			"key_prefix": getTokenKeyPrefix(token.Key),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (t *Token) GetModels() string {
 	if t == nil {
 		return ""
@@ -168,119 +278,29 @@ func DeleteTokenById(id int, userId int) (err error) {
 	return token.Delete()
 }
 
-func IncreaseTokenQuota(id int, quota int64) (err error) {
-	if quota < 0 {
-		return errors.New("quota 不能为负数！")
-	}
-	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
-		return nil
-	}
-	return increaseTokenQuota(id, quota)
-}
-
-func increaseTokenQuota(id int, quota int64) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
-			"used_quota":    gorm.Expr("used_quota - ?", quota),
-			"accessed_time": helper.GetTimestamp(),
-		},
-	).Error
-	return err
-}
-
-func DecreaseTokenQuota(id int, quota int64) (err error) {
-	if quota < 0 {
-		return errors.New("quota 不能为负数！")
-	}
-	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
-		return nil
-	}
-	return decreaseTokenQuota(id, quota)
-}
-
-func decreaseTokenQuota(id int, quota int64) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
-			"used_quota":    gorm.Expr("used_quota + ?", quota),
-			"accessed_time": helper.GetTimestamp(),
-		},
-	).Error
-	return err
+// PostConsumeTokenQuota charges (quota > 0) or refunds (quota < 0) the user and the token in one ledger entry
+func PostConsumeTokenQuota(tokenId int, quota int64, transaction QuotaTransaction) (err error) {
+	return postConsumeTokenQuota(context.Background(), tokenId, quota, transaction)
 }
 
-func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
-	if quota < 0 {
-		return errors.New("quota 不能为负数！")
-	}
+// postConsumeTokenQuota applies the change to the cached quota first, so that the cache stays in step with the
+// reservations while the change is queued by the batch updater
+func postConsumeTokenQuota(ctx context.Context, tokenId int, quota int64, transaction QuotaTransaction) (err error) {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
 		return err
 	}
-	if !token.UnlimitedQuota && token.RemainQuota < quota {
-		return errors.New("令牌额度不足")
-	}
-	userQuota, err := GetUserQuota(token.UserId)
-	if err != nil {
-		return err
-	}
-	if userQuota < quota {
-		return errors.New("用户额度不足")
-	}
-	quotaTooLow := userQuota >= config.QuotaRemindThreshold && userQuota-quota < config.QuotaRemindThreshold
-	noMoreQuota := userQuota-quota <= 0
-	if quotaTooLow || noMoreQuota {
-		go func() {
-			email, err := GetUserEmail(token.UserId)
-			if err != nil {
-				logger.SysError("failed to fetch user email: " + err.Error())
-			}
-			prompt := "您的额度即将用尽"
-			if noMoreQuota {
-				prompt = "您的额度已用尽"
-			}
-			if email != "" {
-				topUpLink := fmt.Sprintf("%s/topup", config.ServerAddress)
-				err = message.SendEmail(prompt, email,
-					fmt.Sprintf("%s，当前剩余额度为 %d，为了不影响您的使用，请及时充值。<br/>充值链接：<a href='%s'>%s</a>", prompt, userQuota, topUpLink, topUpLink))
-				if err != nil {
-					logger.SysError("failed to send email" + err.Error())
-				}
-			}
-		}()
-	}
+	transaction.UserId = token.UserId
+	transaction.TokenId = tokenId
+	transaction.Amount = -quota
+	transaction.TokenAmount = 0
 	if !token.UnlimitedQuota {
-		err = DecreaseTokenQuota(tokenId, quota)
-		if err != nil {
-			return err
-		}
+		transaction.TokenAmount = -quota
 	}
-	err = DecreaseUserQuota(token.UserId, quota)
-	return err
-}
-
-func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
-	token, err := GetTokenById(tokenId)
+	cacheApplyQuotaTransaction(ctx, &transaction)
+	err = changeQuota(&transaction)
 	if err != nil {
-		return err
-	}
-	if quota > 0 {
-		err = DecreaseUserQuota(token.UserId, quota)
-	} else {
-		err = IncreaseUserQuota(token.UserId, -quota)
-	}
-	if !token.UnlimitedQuota {
-		if quota > 0 {
-			err = DecreaseTokenQuota(tokenId, quota)
-		} else {
-			err = IncreaseTokenQuota(tokenId, -quota)
-		}
-		if err != nil {
-			return err
-		}
+		cacheRevertQuotaTransaction(ctx, &transaction)
 	}
-	return nil
+	return err
 }
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashTokenKey(t *testing.T) {
+	hash := HashTokenKey("sk-test")
+	assert.Len(t, hash, 43)
+	assert.Equal(t, hash, HashTokenKey("sk-test"))
+	assert.NotEqual(t, hash, HashTokenKey("sk-test2"))
+
+	tests := []struct {
+		key    string
+		prefix string
+	}{
+		{"a", "a"},
+		{"abcd", "ab"},
+		{"abcdefghijklmnop", "abcdef"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.prefix, getTokenKeyPrefix(tt.key), tt.key)
+	}
+}
+
+func TestMigrateTokenKeys(t *testing.T) {
+	setupTestDB(t)
+	user, _ := createTestUserAndToken(t, 1000, 0)
+	// tokens created before the keys were hashed
+	require.NoError(t, DB.Exec("INSERT INTO tokens (user_id, `key`, key_prefix, status, name, expired_time, remain_quota) VALUES (?, ?, '', ?, ?, -1, 100)",
+		user.Id, "plaintextkeyplaintextkey", TokenStatusEnabled, "legacy").Error)
+	require.NoError(t, DB.Exec("INSERT INTO tokens (user_id, `key`, key_prefix, status, name, expired_time, remain_quota) VALUES (?, '', '', ?, ?, -1, 100)",
+		user.Id, TokenStatusEnabled, "empty").Error)
+	require.NoError(t, migrateTokenKeys())
+
+	var token Token
+	require.NoError(t, DB.Where("name = ?", "legacy").First(&token).Error)
+	assert.Equal(t, HashTokenKey("plaintextkeyplaintextkey"), token.KeyHash)
+	assert.Equal(t, "plaint", token.KeyPrefix)
+
+	validated, err := ValidateUserToken("plaintextkeyplaintextkey")
+	require.NoError(t, err)
+	assert.Equal(t, token.Id, validated.Id)
+	_, err = ValidateUserToken(HashTokenKey("plaintextkeyplaintextkey"))
+	assert.Error(t, err)
+
+	// the migration is idempotent
+	require.NoError(t, migrateTokenKeys())
+	require.NoError(t, DB.Where("name = ?", "legacy").First(&token).Error)
+	assert.Equal(t, HashTokenKey("plaintextkeyplaintextkey"), token.KeyHash)
+
+	// the token without key is not hashed, not even repeatedly
+	var empty Token
+	require.NoError(t, DB.Where("name = ?", "empty").First(&empty).Error)
+	assert.Empty(t, empty.KeyHash)
+	assert.Empty(t, empty.KeyPrefix)
+}
@@ -0,0 +1,197 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/totp"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var ErrInvalidTwoFactorCode = errors.New("两步验证码错误")
+
+// TwoFactor is the TOTP second factor of a user, it's not enabled until the first code is verified
+type TwoFactor struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"uniqueIndex"`
+	Secret        string `json:"-" gorm:"type:varchar(64)"`
+	Enabled       bool   `json:"enabled" gorm:"default:false"`
+	RecoveryCodes string `json:"-" gorm:"type:text"` // SHA-256 hashes of the unused recovery codes, separated by comma
+	LastUsedStep  int64  `json:"-" gorm:"bigint;default:0"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+// IsTwoFactorRequired tells whether the users of the role must enable the second factor
+func IsTwoFactorRequired(role int) bool {
+	return config.AdminTwoFactorEnabled && role >= RoleAdminUser
+}
+
+// GetTwoFactor returns nil if the user has never set up the second factor
+func GetTwoFactor(userId int) (*TwoFactor, error) {
+	twoFactor := TwoFactor{}
+	err := DB.First(&twoFactor, "user_id = ?", userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+func IsTwoFactorEnabled(userId int) bool {
+	twoFactor, err := GetTwoFactor(userId)
+	return err == nil && twoFactor != nil && twoFactor.Enabled
+}
+
+// SetupTwoFactor generates a new secret for the user, it returns the secret and the otpauth URI
+func SetupTwoFactor(userId int, username string) (secret string, uri string, err error) {
+	twoFactor, err := GetTwoFactor(userId)
+	if err != nil {
+		return "", "", err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		return "", "", errors.New("两步验证已启用")
+	}
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if twoFactor == nil {
+		twoFactor = &TwoFactor{UserId: userId}
+	}
+	twoFactor.Secret = secret
+	twoFactor.CreatedTime = helper.GetTimestamp()
+	err = DB.Save(twoFactor).Error
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(config.SystemName, username, secret), nil
+}
+
+// EnableTwoFactor verifies the first code of the secret generated by SetupTwoFactor, it returns the recovery codes
+func EnableTwoFactor(userId int, code string) ([]string, error) {
+	twoFactor, err := GetTwoFactor(userId)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil || twoFactor.Secret == "" {
+		return nil, errors.New("请先生成两步验证密钥")
+	}
+	if twoFactor.Enabled {
+		return nil, errors.New("两步验证已启用")
+	}
+	if !twoFactor.verifyTOTP(code) {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(twoFactor).Updates(map[string]interface{}{
+		"enabled":        true,
+		"recovery_codes": hashes,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactor checks the TOTP code or a recovery code, a recovery code can only be used once
+func VerifyTwoFactor(userId int, code string) error {
+	twoFactor, err := GetTwoFactor(userId)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return errors.New("两步验证未启用")
+	}
+	if twoFactor.verifyTOTP(code) || twoFactor.useRecoveryCode(code) {
+		return nil
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// RegenerateRecoveryCodes replaces all the recovery codes
+func RegenerateRecoveryCodes(userId int) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	result := DB.Model(&TwoFactor{}).Where("user_id = ? and enabled = ?", userId, true).Update("recovery_codes", hashes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("两步验证未启用")
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor removes the second factor of the user, it's also used by administrators to reset it
+func DisableTwoFactor(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&TwoFactor{}).Error
+}
+
+// verifyTOTP accepts each time step only once, so that a code can't be replayed
+func (twoFactor *TwoFactor) verifyTOTP(code string) bool {
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok || step <= twoFactor.LastUsedStep {
+		return false
+	}
+	result := DB.Model(&TwoFactor{}).Where("id = ? and last_used_step < ?", twoFactor.Id, step).Update("last_used_step", step)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (twoFactor *TwoFactor) useRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(code)
+	if twoFactor.RecoveryCodes == "" || hash == "" {
+		return false
+	}
+	hashes := strings.Split(twoFactor.RecoveryCodes, ",")
+	for i, h := range hashes {
+		if h != hash {
+			continue
+		}
+		remaining := strings.Join(append(hashes[:i:i], hashes[i+1:]...), ",")
+		// the condition makes sure the code is not used by a concurrent request
+		result := DB.Model(&TwoFactor{}).Where("id = ? and recovery_codes = ?", twoFactor.Id, twoFactor.RecoveryCodes).Update("recovery_codes", remaining)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	return false
+}
+
+func generateRecoveryCodes() (codes []string, hashes string, err error) {
+	var hashList []string
+	buf := make([]byte, 5)
+	for i := 0; i < recoveryCodeCount; i++ {
+		_, err = rand.Read(buf)
+		if err != nil {
+			return nil, "", err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashList = append(hashList, hashRecoveryCode(code))
+	}
+	return codes, strings.Join(hashList, ","), nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if code == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
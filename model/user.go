@@ -40,6 +40,7 @@ type User struct {
 	WeChatId         string `json:"wechat_id" gorm:"column:wechat_id;index"`
 	LarkId           string `json:"lark_id" gorm:"column:lark_id;index"`
 	OidcId           string `json:"oidc_id" gorm:"column:oidc_id;index"`
+	LdapId           string `json:"ldap_id" gorm:"column:ldap_id;index"`
 	VerificationCode string `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
 	AccessToken      string `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
 	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
@@ -48,6 +49,7 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	RoleId           int    `json:"role_id" gorm:"type:int;default:0;index"` // custom role, see AssignUserRole
 }
 
 func GetMaxUserId() int {
@@ -83,6 +85,29 @@ func SearchUsers(keyword string) (users []*User, err error) {
 	return users, err
 }
 
+// QueryUsers returns a page of the users whose username or email equals the keyword, all the users if it's empty
+func QueryUsers(keyword string, startIdx int, num int) (users []*User, total int64, err error) {
+	query := DB.Model(&User{}).Where("status != ?", UserStatusDeleted)
+	if keyword != "" {
+		query = query.Where("username = ? or email = ?", keyword, keyword)
+	}
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Omit("password").Order("id asc").Limit(num).Offset(startIdx).Find(&users).Error
+	return users, total, err
+}
+
+func GetGroupUsers(group string) (users []*User, err error) {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	err = DB.Select("id", "username").Where(groupCol+" = ? and status != ?", group, UserStatusDeleted).Order("id asc").Find(&users).Error
+	return users, err
+}
+
 func GetUserById(id int, selectAll bool) (*User, error) {
 	if id == 0 {
 		return nil, errors.New("id 为空！")
@@ -122,24 +147,43 @@ func (user *User) Insert(inviterId int) error {
 			return err
 		}
 	}
-	user.Quota = config.QuotaForNewUser
+	// the quota for new user is granted after the user is created, so that it's recorded in the ledger
+	user.Quota = 0
 	user.AccessToken = random.GetUUID()
 	user.AffCode = random.GetRandomString(4)
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Create(user).Error
+	if err != nil {
+		return err
 	}
+	var logId int
 	if config.QuotaForNewUser > 0 {
-		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(config.QuotaForNewUser)))
+		logId = RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(config.QuotaForNewUser)))
+		err = ChangeUserQuota(user.Id, config.QuotaForNewUser, QuotaTransaction{
+			Type:   QuotaTransactionTypeRegister,
+			Reason: "新用户注册赠送",
+			LogId:  logId,
+		})
+		if err != nil {
+			logger.SysError(fmt.Sprintf("grant quota for new user %d failed: %s", user.Id, err.Error()))
+		}
+		user.Quota = config.QuotaForNewUser
 	}
 	if inviterId != 0 {
 		if config.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, config.QuotaForInvitee)
-			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(config.QuotaForInvitee)))
+			logId = RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(config.QuotaForInvitee)))
+			_ = ChangeUserQuota(user.Id, config.QuotaForInvitee, QuotaTransaction{
+				Type:   QuotaTransactionTypeInvite,
+				Reason: "使用邀请码赠送",
+				LogId:  logId,
+			})
 		}
 		if config.QuotaForInviter > 0 {
-			_ = IncreaseUserQuota(inviterId, config.QuotaForInviter)
-			RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户赠送 %s", common.LogQuota(config.QuotaForInviter)))
+			logId = RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户赠送 %s", common.LogQuota(config.QuotaForInviter)))
+			_ = ChangeUserQuota(inviterId, config.QuotaForInviter, QuotaTransaction{
+				Type:   QuotaTransactionTypeInvite,
+				Reason: "邀请用户赠送",
+				LogId:  logId,
+			})
 		}
 	}
 	// create default token
@@ -153,10 +197,10 @@ func (user *User) Insert(inviterId int) error {
 		RemainQuota:    -1,
 		UnlimitedQuota: true,
 	}
-	result.Error = cleanToken.Insert()
-	if result.Error != nil {
+	err = cleanToken.Insert()
+	if err != nil {
 		// do not block
-		logger.SysError(fmt.Sprintf("create default token for user %d failed: %s", user.Id, result.Error.Error()))
+		logger.SysError(fmt.Sprintf("create default token for user %d failed: %s", user.Id, err.Error()))
 	}
 	return nil
 }
@@ -174,7 +218,12 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
-	err = DB.Model(user).Updates(user).Error
+	// quota can only be changed by ChangeUserQuota, so that it's recorded in the ledger,
+	// and the custom role can only be changed by AssignUserRole
+	err = DB.Model(user).Omit("quota", "role_id").Updates(user).Error
+	if err == nil {
+		publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: user.Id})
+	}
 	return err
 }
 
@@ -186,6 +235,9 @@ func (user *User) Delete() error {
 	user.Username = fmt.Sprintf("deleted_%s", random.GetUUID())
 	user.Status = UserStatusDeleted
 	err := DB.Model(user).Updates(user).Error
+	if err == nil {
+		publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: user.Id})
+	}
 	return err
 }
 
@@ -254,6 +306,14 @@ func (user *User) FillUserByOidcId() error {
 	return nil
 }
 
+func (user *User) FillUserByLdapId() error {
+	if user.LdapId == "" {
+		return errors.New("ldap id 为空！")
+	}
+	DB.Where(User{LdapId: user.LdapId}).First(user)
+	return nil
+}
+
 func (user *User) FillUserByWeChatId() error {
 	if user.WeChatId == "" {
 		return errors.New("WeChat id 为空！")
@@ -290,6 +350,10 @@ func IsOidcIdAlreadyTaken(oidcId string) bool {
 	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
 }
 
+func IsLdapIdAlreadyTaken(ldapId string) bool {
+	return DB.Where("ldap_id = ?", ldapId).Find(&User{}).RowsAffected == 1
+}
+
 func IsUsernameAlreadyTaken(username string) bool {
 	return DB.Where("username = ?", username).Find(&User{}).RowsAffected == 1
 }
@@ -368,36 +432,40 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
-func IncreaseUserQuota(id int, quota int64) (err error) {
-	if quota < 0 {
-		return errors.New("quota 不能为负数！")
-	}
-	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
-		return nil
+// UpdateUserGroup changes the group only, it's used to sync the group from the identity provider on login
+func UpdateUserGroup(id int, group string) error {
+	err := DB.Model(&User{}).Where("id = ?", id).Update("group", group).Error
+	if err == nil {
+		publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: id})
 	}
-	return increaseUserQuota(id, quota)
+	return err
 }
 
-func increaseUserQuota(id int, quota int64) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+// UpdateUserRole changes the built-in role only, it's used to sync the role from the identity provider on login
+func UpdateUserRole(id int, role int) error {
+	err := DB.Model(&User{}).Where("id = ?", id).Update("role", role).Error
+	if err == nil {
+		publishCacheEvent(cacheEvent{Type: cacheEventUser, Id: id})
+	}
 	return err
 }
 
-func DecreaseUserQuota(id int, quota int64) (err error) {
+func IncreaseUserQuota(id int, quota int64, transaction QuotaTransaction) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
-		return nil
-	}
-	return decreaseUserQuota(id, quota)
+	transaction.UserId = id
+	transaction.Amount = quota
+	return changeQuota(&transaction)
 }
 
-func decreaseUserQuota(id int, quota int64) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	return err
+func DecreaseUserQuota(id int, quota int64, transaction QuotaTransaction) (err error) {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	transaction.UserId = id
+	transaction.Amount = -quota
+	return changeQuota(&transaction)
 }
 
 func GetRootUserEmail() (email string) {
@@ -1,16 +1,16 @@
 package model
 
 import (
+	"fmt"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"sync"
 	"time"
 )
 
 const (
-	BatchUpdateTypeUserQuota = iota
-	BatchUpdateTypeTokenQuota
-	BatchUpdateTypeUsedQuota
+	BatchUpdateTypeUsedQuota = iota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
@@ -19,6 +19,11 @@ const (
 var batchUpdateStores []map[int]int64
 var batchUpdateLocks []sync.Mutex
 
+// pendingQuotaTransactions are the queued quota changes of each user, they keep their own ledger entries,
+// but the quota of a user is updated only once per batch
+var pendingQuotaTransactions = make(map[int][]*QuotaTransaction)
+var pendingQuotaTransactionsLock sync.Mutex
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int64))
@@ -35,6 +40,13 @@ func InitBatchUpdater() {
 	}()
 }
 
+// FlushBatchUpdates writes the pending records into database, it should be called before exiting
+func FlushBatchUpdates() {
+	if config.BatchUpdateEnabled {
+		batchUpdate()
+	}
+}
+
 func addNewRecord(type_ int, id int, value int64) {
 	batchUpdateLocks[type_].Lock()
 	defer batchUpdateLocks[type_].Unlock()
@@ -45,8 +57,29 @@ func addNewRecord(type_ int, id int, value int64) {
 	}
 }
 
+func addQuotaTransaction(transaction *QuotaTransaction) {
+	pendingQuotaTransactionsLock.Lock()
+	defer pendingQuotaTransactionsLock.Unlock()
+	transaction.CreatedTime = helper.GetTimestamp()
+	pendingQuotaTransactions[transaction.UserId] = append(pendingQuotaTransactions[transaction.UserId], transaction)
+}
+
+func batchUpdateQuotaTransactions() {
+	pendingQuotaTransactionsLock.Lock()
+	store := pendingQuotaTransactions
+	pendingQuotaTransactions = make(map[int][]*QuotaTransaction)
+	pendingQuotaTransactionsLock.Unlock()
+	for userId, transactions := range store {
+		err := writeQuotaTransactions(transactions)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to batch update quota of user %d: %s", userId, err.Error()))
+		}
+	}
+}
+
 func batchUpdate() {
 	logger.SysLog("batch update started")
+	batchUpdateQuotaTransactions()
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
@@ -55,16 +88,6 @@ func batchUpdate() {
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
-			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
-				if err != nil {
-					logger.SysError("failed to batch update user quota: " + err.Error())
-				}
-			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
-				if err != nil {
-					logger.SysError("failed to batch update token quota: " + err.Error())
-				}
 			case BatchUpdateTypeUsedQuota:
 				updateUserUsedQuota(key, value)
 			case BatchUpdateTypeRequestCount:
@@ -52,3 +52,19 @@ func EnableChannel(channelId int, channelName string) {
 	content := fmt.Sprintf("渠道「%s」（#%d）已被启用", channelName, channelId)
 	notifyRootUser(subject, content)
 }
+
+// LowBalanceChannel notifies that the balance of the channel fell below the threshold
+func LowBalanceChannel(channelId int, channelName string, balance float64, threshold float64, action string) {
+	logger.SysLog(fmt.Sprintf("channel #%d has low balance: %.2f < %.2f", channelId, balance, threshold))
+	subject := fmt.Sprintf("渠道「%s」（#%d）余额不足", channelName, channelId)
+	content := fmt.Sprintf("渠道「%s」（#%d）的余额为 %.2f，低于阈值 %.2f%s", channelName, channelId, balance, threshold, action)
+	notifyRootUser(subject, content)
+}
+
+// BalanceRecoveredChannel notifies that the balance of the channel is above the threshold again
+func BalanceRecoveredChannel(channelId int, channelName string, balance float64) {
+	logger.SysLog(fmt.Sprintf("channel #%d has sufficient balance again: %.2f", channelId, balance))
+	subject := fmt.Sprintf("渠道「%s」（#%d）余额已恢复", channelName, channelId)
+	content := fmt.Sprintf("渠道「%s」（#%d）的余额已恢复为 %.2f", channelName, channelId, balance)
+	notifyRootUser(subject, content)
+}
@@ -18,6 +18,14 @@ func SetupCommonRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta
 	}
 }
 
+// SetupCustomRequestHeader sets the headers configured on the channel, it is called after the adaptor sets its
+// headers so that the configured ones take precedence
+func SetupCustomRequestHeader(req *http.Request, meta *meta.Meta) {
+	for key, value := range meta.Config.Headers {
+		req.Header.Set(key, value)
+	}
+}
+
 func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(meta)
 	if err != nil {
@@ -31,15 +39,21 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
-	resp, err := DoRequest(c, req)
+	SetupCustomRequestHeader(req, meta)
+	resp, err := DoRequest(c, req, meta)
 	if err != nil {
 		return nil, fmt.Errorf("do request failed: %w", err)
 	}
 	return resp, nil
 }
 
-func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
-	resp, err := client.HTTPClient.Do(req)
+// DoRequest sends the request with the HTTP client of the channel
+func DoRequest(c *gin.Context, req *http.Request, meta *meta.Meta) (*http.Response, error) {
+	httpClient, err := client.GetHTTPClient(meta.Config.ClientOptions())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
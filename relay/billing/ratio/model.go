@@ -398,6 +398,9 @@ func GetModelRatio(name string, channelType int) float64 {
 	if strings.HasPrefix(name, "command-") && strings.HasSuffix(name, "-internet") {
 		name = strings.TrimSuffix(name, "-internet")
 	}
+	if price, ok := getModelPrice(name, channelType); ok && (price.Input > 0 || price.Image > 0) {
+		return Price2ModelRatio(price)
+	}
 	model := fmt.Sprintf("%s(%d)", name, channelType)
 	if ratio, ok := ModelRatio[model]; ok {
 		return ratio
@@ -432,6 +435,9 @@ func GetCompletionRatio(name string, channelType int) float64 {
 	if strings.HasPrefix(name, "qwen-") && strings.HasSuffix(name, "-internet") {
 		name = strings.TrimSuffix(name, "-internet")
 	}
+	if price, ok := getModelPrice(name, channelType); ok && price.Input > 0 {
+		return Price2CompletionRatio(price)
+	}
 	model := fmt.Sprintf("%s(%d)", name, channelType)
 	if ratio, ok := CompletionRatio[model]; ok {
 		return ratio
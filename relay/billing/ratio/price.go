@@ -0,0 +1,97 @@
+package ratio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Price is the absolute price of a model, all token prices are in USD per 1M tokens
+type Price struct {
+	Input       float64 // USD / 1M input tokens
+	Output      float64 // USD / 1M output tokens
+	CachedInput float64 // USD / 1M cached input tokens
+	Image       float64 // USD / image
+	Second      float64 // USD / second of audio
+}
+
+// modelPrices is loaded from the model_prices table, it takes precedence over ModelRatio and CompletionRatio
+var modelPrices = map[string]Price{}
+var modelPricesLock sync.RWMutex
+
+func UpdateModelPrices(prices map[string]Price) {
+	modelPricesLock.Lock()
+	defer modelPricesLock.Unlock()
+	modelPrices = prices
+}
+
+// Price2ModelRatio converts an absolute price to model ratio, 1 === $0.002 / 1K tokens
+func Price2ModelRatio(price Price) float64 {
+	if price.Image > 0 {
+		// image quota is ratio * 1000 per image
+		return price.Image * USD
+	}
+	return price.Input * USD / 1000
+}
+
+func Price2CompletionRatio(price Price) float64 {
+	if price.Input == 0 {
+		return 1
+	}
+	return price.Output / price.Input
+}
+
+// Ratio2Price is the reverse of Price2ModelRatio & Price2CompletionRatio, used for migrating old ratios
+func Ratio2Price(modelRatio float64, completionRatio float64) Price {
+	input := modelRatio * 1000 / USD
+	return Price{
+		Input:  input,
+		Output: input * completionRatio,
+	}
+}
+
+// SplitModelKey splits keys like "llama3-8b-8192(33)" into model name and channel type,
+// channel type is -1 if the key is not channel specific
+func SplitModelKey(key string) (string, int) {
+	if !strings.HasSuffix(key, ")") {
+		return key, -1
+	}
+	idx := strings.LastIndex(key, "(")
+	if idx <= 0 {
+		return key, -1
+	}
+	channelType, err := strconv.Atoi(key[idx+1 : len(key)-1])
+	if err != nil {
+		return key, -1
+	}
+	return key[:idx], channelType
+}
+
+func getModelPrice(name string, channelType int) (Price, bool) {
+	modelPricesLock.RLock()
+	defer modelPricesLock.RUnlock()
+	if price, ok := modelPrices[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return price, true
+	}
+	price, ok := modelPrices[name]
+	return price, ok
+}
+
+// GetCachedInputRatio returns the ratio of cached input price to input price, 1 means no discount
+func GetCachedInputRatio(name string, channelType int) float64 {
+	price, ok := getModelPrice(name, channelType)
+	if !ok || price.Input == 0 || price.CachedInput == 0 {
+		return 1
+	}
+	return price.CachedInput / price.Input
+}
+
+// GetSecondPrice returns USD per second, 0 means the model is not billed by duration
+func GetSecondPrice(name string, channelType int) float64 {
+	price, ok := getModelPrice(name, channelType)
+	if !ok {
+		return 0
+	}
+	return price.Second
+}
@@ -0,0 +1,45 @@
+package ratio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceRatioConversion(t *testing.T) {
+	// gpt-4o-mini: $0.15 / 1M input tokens, $0.6 / 1M output tokens
+	price := Price{Input: 0.15, Output: 0.6}
+	assert.InDelta(t, 0.075, Price2ModelRatio(price), 1e-9)
+	assert.InDelta(t, 4, Price2CompletionRatio(price), 1e-9)
+
+	converted := Ratio2Price(0.075, 4)
+	assert.InDelta(t, 0.15, converted.Input, 1e-9)
+	assert.InDelta(t, 0.6, converted.Output, 1e-9)
+
+	// dall-e-3: $0.04 / image
+	assert.InDelta(t, 20, Price2ModelRatio(Price{Image: 0.04}), 1e-9)
+}
+
+func TestSplitModelKey(t *testing.T) {
+	name, channelType := SplitModelKey("llama3-8b-8192(33)")
+	assert.Equal(t, "llama3-8b-8192", name)
+	assert.Equal(t, 33, channelType)
+
+	name, channelType = SplitModelKey("gpt-4o")
+	assert.Equal(t, "gpt-4o", name)
+	assert.Equal(t, -1, channelType)
+}
+
+func TestModelPricePrecedence(t *testing.T) {
+	defer UpdateModelPrices(map[string]Price{})
+	UpdateModelPrices(map[string]Price{
+		"gpt-4o-mini":     {Input: 0.3, Output: 0.6},
+		"gpt-4o-mini(33)": {Input: 0.15, Output: 0.6},
+	})
+	assert.InDelta(t, 0.15, GetModelRatio("gpt-4o-mini", 1), 1e-9)
+	assert.InDelta(t, 2, GetCompletionRatio("gpt-4o-mini", 1), 1e-9)
+	assert.InDelta(t, 0.075, GetModelRatio("gpt-4o-mini", 33), 1e-9)
+	assert.InDelta(t, 4, GetCompletionRatio("gpt-4o-mini", 33), 1e-9)
+	// models without a price fall back to the ratios
+	assert.Equal(t, DefaultModelRatio["gpt-4o"], GetModelRatio("gpt-4o", 1))
+}
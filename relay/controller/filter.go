@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/filter"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func addContentFilterHits(meta *meta.Meta, hits []string) {
+	for _, hit := range hits {
+		if !helper.StringSliceContains(meta.ContentFilterHits, hit) {
+			meta.ContentFilterHits = append(meta.ContentFilterHits, hit)
+		}
+	}
+}
+
+// filterAny filters the string, or the strings in the list, the filtered value and the blocking rule are returned
+func filterAny(rules []*filter.Rule, meta *meta.Meta, value any) (any, *filter.Rule) {
+	switch v := value.(type) {
+	case string:
+		text, blockedBy, hits := filter.Apply(rules, v)
+		addContentFilterHits(meta, hits)
+		if text != v {
+			meta.ContentRedacted = true
+		}
+		return text, blockedBy
+	case []any:
+		for i, item := range v {
+			filtered, blockedBy := filterAny(rules, meta, item)
+			if blockedBy != nil {
+				return v, blockedBy
+			}
+			v[i] = filtered
+		}
+	case map[string]any:
+		// the text part of the multimodal content
+		if v["type"] == relaymodel.ContentTypeText {
+			filtered, blockedBy := filterAny(rules, meta, v["text"])
+			if blockedBy != nil {
+				return v, blockedBy
+			}
+			v["text"] = filtered
+		}
+	}
+	return value, nil
+}
+
+// filterTextRequest applies the content filter rules to the prompt, the matched rules are recorded in the meta
+func filterTextRequest(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest) *relaymodel.ErrorWithStatusCode {
+	rules := filter.GetRules(meta.Group, meta.TokenId)
+	if len(rules) == 0 {
+		return nil
+	}
+	var blockedBy *filter.Rule
+	for i := range textRequest.Messages {
+		textRequest.Messages[i].Content, blockedBy = filterAny(rules, meta, textRequest.Messages[i].Content)
+		if blockedBy != nil {
+			break
+		}
+	}
+	if blockedBy == nil {
+		textRequest.Prompt, blockedBy = filterAny(rules, meta, textRequest.Prompt)
+	}
+	if blockedBy == nil {
+		textRequest.Input, blockedBy = filterAny(rules, meta, textRequest.Input)
+	}
+	if blockedBy != nil {
+		logger.Warnf(c.Request.Context(), "request of user %d is blocked by content filter rule %s", meta.UserId, blockedBy.Name)
+		return openai.ErrorWrapper(fmt.Errorf("request content is blocked by content filter rule %s", blockedBy.Name), "content_filtered", http.StatusBadRequest)
+	}
+	if len(meta.ContentFilterHits) != 0 {
+		logger.Warnf(c.Request.Context(), "request of user %d matched content filter rules: %s", meta.UserId, strings.Join(meta.ContentFilterHits, ", "))
+	}
+	return nil
+}
+
+// outputFilterWindow is the length of the tail of the streamed text scanned together with the new chunk, so that
+// the text split into several chunks can be matched
+const outputFilterWindow = 1024
+
+// outputFilter scans the content of the streamed chunks, a blocking rule ends the stream with the content_filter
+// finish reason, the redaction is applied to each chunk alone
+type outputFilter struct {
+	ctx   context.Context
+	rules []*filter.Rule
+	meta  *meta.Meta
+	tail  string
+	// streamed is the content sent to the client, which is billed instead of the upstream usage once blocked
+	streamed strings.Builder
+	blocked  bool
+}
+
+func newOutputFilter(c *gin.Context, meta *meta.Meta) *outputFilter {
+	var rules []*filter.Rule
+	for _, rule := range filter.GetRules(meta.Group, meta.TokenId) {
+		if rule.ScanOutput {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &outputFilter{
+		ctx:   c.Request.Context(),
+		rules: rules,
+		meta:  meta,
+	}
+}
+
+func (f *outputFilter) filterLine(line []byte) ([]byte, bool) {
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if !bytes.HasPrefix(line, []byte("data:")) || !bytes.HasPrefix(data, []byte("{")) {
+		return line, false
+	}
+	chunk := make(map[string]any)
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return line, false
+	}
+	choices, _ := chunk["choices"].([]any)
+	modified := false
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		delta, _ := choiceMap["delta"].(map[string]any)
+		content, ok := delta["content"].(string)
+		if !ok || content == "" {
+			continue
+		}
+		text := f.tail + content
+		filtered := content
+		for _, rule := range f.rules {
+			if !rule.Match(text) {
+				continue
+			}
+			addContentFilterHits(f.meta, []string{rule.Name})
+			switch rule.Action {
+			case filter.ActionBlock:
+				logger.Warnf(f.ctx, "response to user %d is blocked by content filter rule %s", f.meta.UserId, rule.Name)
+				f.blocked = true
+				return f.blockedChunk(chunk), true
+			case filter.ActionRedact:
+				filtered = rule.Redact(filtered)
+			}
+		}
+		if filtered != content {
+			delta["content"] = filtered
+			modified = true
+		}
+		f.streamed.WriteString(filtered)
+		f.tail = text
+		if len(f.tail) > outputFilterWindow {
+			f.tail = f.tail[len(f.tail)-outputFilterWindow:]
+		}
+	}
+	if !modified {
+		return line, false
+	}
+	jsonData, err := json.Marshal(chunk)
+	if err != nil {
+		return line, false
+	}
+	return []byte("data: " + string(jsonData) + "\n"), false
+}
+
+// streamedUsage returns the usage of the content sent to the client before the stream is blocked
+func (f *outputFilter) streamedUsage(usage *relaymodel.Usage) *relaymodel.Usage {
+	promptTokens := f.meta.PromptTokens
+	if usage != nil && usage.PromptTokens != 0 {
+		promptTokens = usage.PromptTokens
+	}
+	return openai.ResponseText2Usage(f.streamed.String(), f.meta.ActualModelName, promptTokens)
+}
+
+func (f *outputFilter) blockedChunk(chunk map[string]any) []byte {
+	jsonData, _ := json.Marshal(map[string]any{
+		"id":      chunk["id"],
+		"object":  chunk["object"],
+		"created": chunk["created"],
+		"model":   chunk["model"],
+		"choices": []any{map[string]any{
+			"index":         0,
+			"delta":         map[string]any{},
+			"finish_reason": "content_filter",
+		}},
+	})
+	return []byte("data: " + string(jsonData) + "\n\ndata: [DONE]\n\n")
+}
@@ -62,45 +62,50 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 	return int64(float64(preConsumedTokens) * ratio)
 }
 
-func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
+func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (*model.QuotaReservation, *relaymodel.ErrorWithStatusCode) {
 	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
+	return reserveQuota(ctx, meta.UserId, meta.TokenId, preConsumedQuota)
+}
 
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+func reserveQuota(ctx context.Context, userId int, tokenId int, quota int64) (*model.QuotaReservation, *relaymodel.ErrorWithStatusCode) {
+	reservation, err := model.ReserveQuota(ctx, userId, tokenId, quota)
 	if err != nil {
-		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota-preConsumedQuota < 0 {
-		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
-	}
-	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
-	if err != nil {
-		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota > 100*preConsumedQuota {
-		// in this case, we do not pre-consume quota
-		// because the user has enough quota
-		preConsumedQuota = 0
-		logger.Info(ctx, fmt.Sprintf("user %d has enough quota %d, trusted and no need to pre-consume", meta.UserId, userQuota))
-	}
-	if preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(meta.TokenId, preConsumedQuota)
-		if err != nil {
-			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		switch {
+		case errors.Is(err, model.ErrInsufficientUserQuota):
+			return nil, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+		case errors.Is(err, model.ErrInsufficientTokenQuota):
+			return nil, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		case errors.Is(err, model.ErrInsufficientOrganizationQuota):
+			return nil, openai.ErrorWrapper(errors.New("organization quota is not enough"), "insufficient_organization_quota", http.StatusForbidden)
+		case errors.Is(err, model.ErrOrganizationMemberQuotaLimit):
+			return nil, openai.ErrorWrapper(errors.New("organization member quota limit reached"), "organization_member_quota_limit", http.StatusForbidden)
+		case errors.Is(err, model.ErrNotOrganizationMember):
+			return nil, openai.ErrorWrapper(errors.New("user is not a member of the organization"), "not_organization_member", http.StatusForbidden)
 		}
+		return nil, openai.ErrorWrapper(err, "pre_consume_quota_failed", http.StatusInternalServerError)
 	}
-	return preConsumedQuota, nil
+	logger.Debugf(ctx, "reserved quota %d for user %d", quota, userId)
+	return reservation, nil
 }
 
-func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, systemPromptReset bool) {
+func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, reservation *model.QuotaReservation, modelRatio float64, groupRatio float64, systemPromptReset bool) {
 	if usage == nil {
 		logger.Error(ctx, "usage is nil, which is unexpected")
+		// the reservation must be released, otherwise it is locked until the sweeper returns it
+		err := model.ReleaseQuotaReservation(ctx, reservation)
+		if err != nil {
+			logger.Error(ctx, "error return pre-consumed quota: "+err.Error())
+		}
 		return
 	}
 	var quota int64
 	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
+	cachedInputRatio := billingratio.GetCachedInputRatio(textRequest.Model, meta.ChannelType)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	cachedTokens := usage.GetCachedTokens()
+	billedPromptTokens := float64(promptTokens-cachedTokens) + float64(cachedTokens)*cachedInputRatio
+	quota = int64(math.Ceil((billedPromptTokens + float64(completionTokens)*completionRatio) * ratio))
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -110,21 +115,22 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
 	}
-	quotaDelta := quota - preConsumedQuota
-	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
-	if err != nil {
-		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
-	}
-	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
-	if err != nil {
-		logger.Error(ctx, "error update user quota cache: "+err.Error())
-	}
 	var extraLog string
 	if systemPromptReset {
 		extraLog = " （注意系统提示词已被重置）"
 	}
+	if cachedTokens > 0 {
+		extraLog = fmt.Sprintf("，缓存 tokens %d，缓存倍率 %.2f", cachedTokens, cachedInputRatio) + extraLog
+	}
+	if len(meta.ContentFilterHits) != 0 {
+		extraLog += fmt.Sprintf("，命中内容过滤规则 %s", strings.Join(meta.ContentFilterHits, "、"))
+	}
 	logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，补全倍率 %.2f%s", modelRatio, groupRatio, completionRatio, extraLog)
-	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, promptTokens, completionTokens, textRequest.Model, meta.TokenName, quota, logContent)
+	logId := model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, promptTokens, completionTokens, textRequest.Model, meta.TokenName, quota, logContent)
+	err := model.SettleQuotaReservation(ctx, reservation, quota, logId)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
 }
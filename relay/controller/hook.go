@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/relay/hook"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func newHookEvent(meta *meta.Meta, stage hook.Stage) *hook.Event {
+	return &hook.Event{
+		Stage:     stage,
+		Group:     meta.Group,
+		UserId:    meta.UserId,
+		TokenId:   meta.TokenId,
+		ChannelId: meta.ChannelId,
+		Model:     meta.ActualModelName,
+	}
+}
+
+// runConvertedHooks runs the hooks on the request converted for the upstream, the rewritten body is returned
+func runConvertedHooks(c *gin.Context, meta *meta.Meta, jsonData []byte) ([]byte, error) {
+	if !hook.Enabled(meta.Group, hook.StageConverted) {
+		return jsonData, nil
+	}
+	event := newHookEvent(meta, hook.StageConverted)
+	event.Body = jsonData
+	result, err := hook.Run(c.Request.Context(), event)
+	if err != nil {
+		return nil, err
+	}
+	if result.Body != nil {
+		return result.Body, nil
+	}
+	return jsonData, nil
+}
+
+// newChunkHookHandler runs the hooks on the data of each chunk, a rejection ends the stream
+func newChunkHookHandler(c *gin.Context, meta *meta.Meta) streamLineHandler {
+	ctx := c.Request.Context()
+	return func(line []byte) ([]byte, bool) {
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if !bytes.HasPrefix(line, []byte("data:")) || !bytes.HasPrefix(data, []byte("{")) {
+			return line, false
+		}
+		event := newHookEvent(meta, hook.StageChunk)
+		event.Body = data
+		result, err := hook.Run(ctx, event)
+		if err != nil {
+			return []byte("data: [DONE]\n\n"), true
+		}
+		if result.Body != nil {
+			return []byte("data: " + string(result.Body) + "\n"), false
+		}
+		return line, false
+	}
+}
+
+// runCompletedHooks notifies the hooks of the completed request in the background
+func runCompletedHooks(c *gin.Context, meta *meta.Meta, usage *relaymodel.Usage) {
+	if !hook.Enabled(meta.Group, hook.StageCompleted) {
+		return
+	}
+	event := newHookEvent(meta, hook.StageCompleted)
+	event.Usage = usage
+	graceful.GoCritical(c.Request.Context(), "runCompletedHooks", func(ctx context.Context) {
+		_, _ = hook.Run(ctx, event)
+	})
+}
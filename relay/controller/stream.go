@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamLineHandler returns the line to send instead, the stream ends after the line if done is true
+type streamLineHandler func(line []byte) (out []byte, done bool)
+
+// streamLineWriter passes each line written by the adaptor through the handler, the upstream is closed once the
+// stream ends so that the adaptor stops reading it, the data written after that is discarded
+type streamLineWriter struct {
+	gin.ResponseWriter
+	handler  streamLineHandler
+	upstream io.Closer
+	buffer   []byte
+	done     bool
+}
+
+// wrapStreamWriter wraps the writer of the context, the returned function restores it
+func wrapStreamWriter(c *gin.Context, upstream io.Closer, handler streamLineHandler) func() {
+	writer := &streamLineWriter{
+		ResponseWriter: c.Writer,
+		handler:        handler,
+		upstream:       upstream,
+	}
+	c.Writer = writer
+	return func() {
+		c.Writer = writer.ResponseWriter
+	}
+}
+
+func (w *streamLineWriter) Write(data []byte) (int, error) {
+	if w.done {
+		return len(data), nil
+	}
+	w.buffer = append(w.buffer, data...)
+	for !w.done {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			break
+		}
+		var line []byte
+		line, w.done = w.handler(w.buffer[:i+1])
+		w.buffer = w.buffer[i+1:]
+		if _, err := w.ResponseWriter.Write(line); err != nil {
+			return 0, err
+		}
+	}
+	if w.done {
+		w.buffer = nil
+		_ = w.upstream.Close()
+	}
+	return len(data), nil
+}
+
+func (w *streamLineWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/filter"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upstreamBody counts the lines read by the adaptor
+type upstreamBody struct {
+	lines  []string
+	read   int
+	closed bool
+}
+
+func (b *upstreamBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if b.read == len(b.lines) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.lines[b.read])
+	b.read++
+	return n, nil
+}
+
+func (b *upstreamBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func chunkLine(content string) string {
+	return `data: {"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"` + content + `"}}]}` + "\n\n"
+}
+
+func TestOutputFilterBlocksStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, filter.UpdateRulesByJSONString(`[
+		{"name":"phone","patterns":["1\\d{10}"],"action":"redact","scan_output":true},
+		{"name":"banned","keywords":["forbidden"],"action":"block","scan_output":true}
+	]`))
+	defer func() {
+		require.NoError(t, filter.UpdateRulesByJSONString(""))
+	}()
+	approximateTokenEnabled := config.ApproximateTokenEnabled
+	config.ApproximateTokenEnabled = true
+	defer func() {
+		config.ApproximateTokenEnabled = approximateTokenEnabled
+	}()
+
+	body := &upstreamBody{lines: []string{
+		chunkLine("hello "),
+		chunkLine("13800138000 "),
+		chunkLine("forbid"),
+		chunkLine("den words"),
+		chunkLine("never sent"),
+		"data: [DONE]\n\n",
+	}}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	m := &meta.Meta{Group: "default", UserId: 1, ActualModelName: "gpt-4o", PromptTokens: 10}
+
+	streamFilter := newOutputFilter(c, m)
+	require.NotNil(t, streamFilter)
+	restore := wrapStreamWriter(c, body, streamFilter.filterLine)
+	respErr, responseText, _ := openai.StreamHandler(c, &http.Response{Body: body}, relaymode.ChatCompletions)
+	restore()
+	require.Nil(t, respErr)
+
+	// the upstream isn't read after the block
+	assert.True(t, body.closed)
+	assert.Equal(t, 4, body.read)
+	assert.True(t, streamFilter.blocked)
+	assert.Equal(t, []string{"phone", "banned"}, m.ContentFilterHits)
+
+	output := recorder.Body.String()
+	assert.Contains(t, output, `"content":"hello "`)
+	assert.Contains(t, output, `"content":"*** "`)
+	assert.NotContains(t, output, "13800138000")
+	assert.NotContains(t, output, "den words")
+	assert.NotContains(t, output, "never sent")
+	assert.Contains(t, output, `"finish_reason":"content_filter"`)
+	assert.Equal(t, 1, strings.Count(output, "[DONE]"))
+
+	// only the content sent to the client is billed
+	assert.Contains(t, responseText, "den words")
+	usage := streamFilter.streamedUsage(nil)
+	assert.Equal(t, 10, usage.PromptTokens)
+	assert.Equal(t, openai.CountTokenText("hello *** forbid", "gpt-4o"), usage.CompletionTokens)
+	assert.Equal(t, usage.PromptTokens+usage.CompletionTokens, usage.TotalTokens)
+}
@@ -2,13 +2,17 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/songquanpeng/one-api/common/config"
 	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/graceful"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor"
@@ -17,6 +21,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/hook"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
@@ -34,8 +39,12 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 
 	// map model name
 	meta.OriginModelName = textRequest.Model
-	textRequest.Model, _ = getMappedModelName(textRequest.Model, meta.ModelMapping)
+	textRequest.Model, _ = meta.ModelMapping.Map(textRequest.Model)
 	meta.ActualModelName = textRequest.Model
+	// apply the content filter before the system prompt set by the admin is added
+	if bizErr := filterTextRequest(c, meta, textRequest); bizErr != nil {
+		return bizErr
+	}
 	// set system prompt if not empty
 	systemPromptReset := setSystemPrompt(ctx, textRequest, meta.SystemPrompt)
 	// get model ratio & group ratio
@@ -45,7 +54,7 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	// pre-consume quota
 	promptTokens := getPromptTokens(textRequest, meta.Mode)
 	meta.PromptTokens = promptTokens
-	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	reservation, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
 	if bizErr != nil {
 		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
 		return bizErr
@@ -53,6 +62,7 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
+		billing.ReturnPreConsumedQuota(ctx, reservation)
 		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(meta)
@@ -60,6 +70,11 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	// get request body
 	requestBody, err := getRequestBody(c, meta, textRequest, adaptor)
 	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, reservation)
+		var rejectErr *hook.RejectError
+		if errors.As(err, &rejectErr) {
+			return openai.ErrorWrapper(err, "rejected_by_hook", http.StatusBadRequest)
+		}
 		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
@@ -67,44 +82,75 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		billing.ReturnPreConsumedQuota(ctx, reservation)
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 	if isErrorHappened(meta, resp) {
-		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnPreConsumedQuota(ctx, reservation)
 		return RelayErrorHandler(resp)
 	}
 
 	// do response
+	var streamFilter *outputFilter
+	if meta.IsStream {
+		// the hooks see the chunks before the output filter
+		if streamFilter = newOutputFilter(c, meta); streamFilter != nil {
+			defer wrapStreamWriter(c, resp.Body, streamFilter.filterLine)()
+		}
+		if hook.Enabled(meta.Group, hook.StageChunk) {
+			defer wrapStreamWriter(c, resp.Body, newChunkHookHandler(c, meta))()
+		}
+	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
-		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnPreConsumedQuota(ctx, reservation)
 		return respErr
 	}
+	if streamFilter != nil && streamFilter.blocked {
+		usage = streamFilter.streamedUsage(usage)
+	}
+	runCompletedHooks(c, meta, usage)
 	// post-consume quota
-	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	graceful.GoCritical(ctx, "postConsumeQuota", func(ctx context.Context) {
+		postConsumeQuota(ctx, usage, meta, textRequest, ratio, reservation, modelRatio, groupRatio, systemPromptReset)
+	})
 	return nil
 }
 
 func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
-	if !config.EnforceIncludeUsage && meta.APIType == apitype.OpenAI && meta.OriginModelName == meta.ActualModelName && meta.ChannelType != channeltype.Baichuan {
+	var jsonData []byte
+	var err error
+	if !config.EnforceIncludeUsage && meta.APIType == apitype.OpenAI && meta.OriginModelName == meta.ActualModelName && meta.ChannelType != channeltype.Baichuan && !meta.ContentRedacted {
 		// no need to convert request for openai
-		return c.Request.Body, nil
+		if meta.Config.ParamOverride.IsEmpty() && !hook.Enabled(meta.Group, hook.StageConverted) {
+			return c.Request.Body, nil
+		}
+		jsonData, err = common.GetRequestBody(c)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
+		if err != nil {
+			logger.Debugf(c.Request.Context(), "converted request failed: %s\n", err.Error())
+			return nil, err
+		}
+		jsonData, err = json.Marshal(convertedRequest)
+		if err != nil {
+			logger.Debugf(c.Request.Context(), "converted request json_marshal_failed: %s\n", err.Error())
+			return nil, err
+		}
 	}
-
-	// get request body
-	var requestBody io.Reader
-	convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
+	jsonData, err = meta.Config.ParamOverride.Apply(jsonData)
 	if err != nil {
-		logger.Debugf(c.Request.Context(), "converted request failed: %s\n", err.Error())
+		logger.Debugf(c.Request.Context(), "apply param override failed: %s\n", err.Error())
 		return nil, err
 	}
-	jsonData, err := json.Marshal(convertedRequest)
+	jsonData, err = runConvertedHooks(c, meta, jsonData)
 	if err != nil {
-		logger.Debugf(c.Request.Context(), "converted request json_marshal_failed: %s\n", err.Error())
 		return nil, err
 	}
 	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
-	requestBody = bytes.NewBuffer(jsonData)
-	return requestBody, nil
+	return bytes.NewBuffer(jsonData), nil
 }
@@ -0,0 +1,176 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	// ActionBlock rejects the request, or ends the stream when scanning the output
+	ActionBlock = "block"
+	// ActionRedact replaces the matched text with the replacement
+	ActionRedact = "redact"
+	// ActionFlag only records the rule in the log
+	ActionFlag = "flag"
+)
+
+const defaultReplacement = "***"
+
+// Rule matches the text by the keywords, which are case-insensitive, and the regular expressions, a rule without
+// groups or token ids applies to all the requests
+type Rule struct {
+	Name        string   `json:"name"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Patterns    []string `json:"patterns,omitempty"`
+	Action      string   `json:"action"`
+	Replacement string   `json:"replacement,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	TokenIds    []int    `json:"token_ids,omitempty"`
+	// ScanOutput also applies the rule to the streamed completion
+	ScanOutput bool `json:"scan_output,omitempty"`
+	matchers   []*regexp.Regexp
+}
+
+var rules []*Rule
+var rulesLock sync.RWMutex
+
+func (rule *Rule) compile() error {
+	switch rule.Action {
+	case ActionBlock, ActionRedact, ActionFlag:
+	default:
+		return fmt.Errorf("规则 %s 的动作无效：%s", rule.Name, rule.Action)
+	}
+	rule.matchers = nil
+	var keywords []string
+	for _, keyword := range rule.Keywords {
+		if keyword != "" {
+			keywords = append(keywords, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(keywords) != 0 {
+		rule.matchers = append(rule.matchers, regexp.MustCompile("(?i)"+strings.Join(keywords, "|")))
+	}
+	for _, pattern := range rule.Patterns {
+		matcher, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("规则 %s 的正则表达式 %s 无效：%s", rule.Name, pattern, err.Error())
+		}
+		rule.matchers = append(rule.matchers, matcher)
+	}
+	if len(rule.matchers) == 0 {
+		return fmt.Errorf("规则 %s 没有关键词或正则表达式", rule.Name)
+	}
+	if rule.Replacement == "" {
+		rule.Replacement = defaultReplacement
+	}
+	return nil
+}
+
+func Rules2JSONString() string {
+	rulesLock.RLock()
+	defer rulesLock.RUnlock()
+	if len(rules) == 0 {
+		return "[]"
+	}
+	jsonBytes, err := json.Marshal(rules)
+	if err != nil {
+		logger.SysError("error marshalling content filter rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// ParseRules parses and compiles the rules of the JSON array
+func ParseRules(jsonStr string) ([]*Rule, error) {
+	var newRules []*Rule
+	if strings.TrimSpace(jsonStr) != "" {
+		err := json.Unmarshal([]byte(jsonStr), &newRules)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range newRules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return newRules, nil
+}
+
+// UpdateRulesByJSONString keeps the current rules if the new ones are invalid
+func UpdateRulesByJSONString(jsonStr string) error {
+	newRules, err := ParseRules(jsonStr)
+	if err != nil {
+		return err
+	}
+	rulesLock.Lock()
+	rules = newRules
+	rulesLock.Unlock()
+	return nil
+}
+
+// GetRules returns the rules applying to the group and the token
+func GetRules(group string, tokenId int) []*Rule {
+	rulesLock.RLock()
+	defer rulesLock.RUnlock()
+	var result []*Rule
+	for _, rule := range rules {
+		if len(rule.Groups) != 0 && !helper.StringSliceContains(rule.Groups, group) {
+			continue
+		}
+		if len(rule.TokenIds) != 0 && !containsInt(rule.TokenIds, tokenId) {
+			continue
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+func containsInt(list []int, target int) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *Rule) Match(text string) bool {
+	for _, matcher := range rule.matchers {
+		if matcher.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *Rule) Redact(text string) string {
+	for _, matcher := range rule.matchers {
+		text = matcher.ReplaceAllLiteralString(text, rule.Replacement)
+	}
+	return text
+}
+
+// Apply applies the rules to the text in order, it returns the filtered text, the rule blocking the text if any,
+// and the names of the matched rules
+func Apply(appliedRules []*Rule, text string) (string, *Rule, []string) {
+	var hits []string
+	for _, rule := range appliedRules {
+		if !rule.Match(text) {
+			continue
+		}
+		hits = append(hits, rule.Name)
+		switch rule.Action {
+		case ActionBlock:
+			return text, rule, hits
+		case ActionRedact:
+			text = rule.Redact(text)
+		}
+	}
+	return text, nil, hits
+}
@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		count   int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"empty array", "[]", 0, false},
+		{"keywords", `[{"name":"a","keywords":["foo"],"action":"block"}]`, 1, false},
+		{"patterns", `[{"name":"a","patterns":["\\d{11}"],"action":"redact"},{"name":"b","keywords":["bar"],"action":"flag"}]`, 2, false},
+		{"invalid json", `{"name":"a"}`, 0, true},
+		{"invalid action", `[{"name":"a","keywords":["foo"],"action":"drop"}]`, 0, true},
+		{"invalid pattern", `[{"name":"a","patterns":["("],"action":"block"}]`, 0, true},
+		{"no matcher", `[{"name":"a","keywords":[""],"action":"block"}]`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.json)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, rules, tt.count)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	rules, err := ParseRules(`[
+		{"name":"phone","patterns":["1\\d{10}"],"action":"redact","replacement":"[phone]"},
+		{"name":"secret","keywords":["Secret"],"action":"redact"},
+		{"name":"watch","keywords":["watch"],"action":"flag"},
+		{"name":"banned","keywords":["banned"],"action":"block"}
+	]`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		blockedBy string
+		hits      []string
+	}{
+		{"no match", "hello", "hello", "", nil},
+		{"redact pattern", "call 13800138000", "call [phone]", "", []string{"phone"}},
+		{"redact keyword case-insensitively", "the SECRET is", "the *** is", "", []string{"secret"}},
+		{"flag keeps the text", "watch it", "watch it", "", []string{"watch"}},
+		{"block", "a banned word", "a banned word", "banned", []string{"banned"}},
+		{"rules in order", "secret 13800138000 banned", "*** [phone] banned", "banned", []string{"phone", "secret", "banned"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, blockedBy, hits := Apply(rules, tt.text)
+			assert.Equal(t, tt.want, text)
+			assert.Equal(t, tt.hits, hits)
+			if tt.blockedBy == "" {
+				assert.Nil(t, blockedBy)
+			} else {
+				require.NotNil(t, blockedBy)
+				assert.Equal(t, tt.blockedBy, blockedBy.Name)
+			}
+		})
+	}
+}
+
+func TestGetRules(t *testing.T) {
+	defer func() {
+		require.NoError(t, UpdateRulesByJSONString(""))
+	}()
+	require.NoError(t, UpdateRulesByJSONString(`[
+		{"name":"all","keywords":["a"],"action":"flag"},
+		{"name":"vip","keywords":["b"],"action":"flag","groups":["vip"]},
+		{"name":"token","keywords":["c"],"action":"flag","token_ids":[7]}
+	]`))
+	names := func(rules []*Rule) []string {
+		var result []string
+		for _, rule := range rules {
+			result = append(result, rule.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"all"}, names(GetRules("default", 1)))
+	assert.Equal(t, []string{"all", "vip"}, names(GetRules("vip", 1)))
+	assert.Equal(t, []string{"all", "token"}, names(GetRules("default", 7)))
+
+	// the invalid rules don't replace the current ones
+	assert.Error(t, UpdateRulesByJSONString(`[{"name":"bad","action":"block"}]`))
+	assert.Len(t, GetRules("vip", 7), 3)
+}
@@ -0,0 +1,297 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+type Stage string
+
+const (
+	// StageRequest runs after the request is parsed, the body is the request from the client
+	StageRequest Stage = "request"
+	// StageChannel runs before a channel is chosen, a hook can route the request to a channel
+	StageChannel Stage = "channel"
+	// StageConverted runs after the request is converted for the upstream, the body is the converted request
+	StageConverted Stage = "converted"
+	// StageChunk runs on each chunk of a stream, the body is the data of the chunk
+	StageChunk Stage = "chunk"
+	// StageCompleted runs after the response is sent, the result is ignored
+	StageCompleted Stage = "completed"
+)
+
+var stages = []Stage{StageRequest, StageChannel, StageConverted, StageChunk, StageCompleted}
+
+type Event struct {
+	Stage     Stage             `json:"stage"`
+	Group     string            `json:"group"`
+	UserId    int               `json:"user_id"`
+	TokenId   int               `json:"token_id"`
+	ChannelId int               `json:"channel_id,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Body      json.RawMessage   `json:"body,omitempty"`
+	Usage     *relaymodel.Usage `json:"usage,omitempty"`
+}
+
+// Result is nil or empty if the hook changes nothing
+type Result struct {
+	// Reject rejects the request with the message, or ends the stream at StageChunk
+	Reject  bool   `json:"reject,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Body replaces the body of the event
+	Body json.RawMessage `json:"body,omitempty"`
+	// ChannelId routes the request to the channel at StageChannel
+	ChannelId int `json:"channel_id,omitempty"`
+}
+
+type Hook interface {
+	Handle(ctx context.Context, event *Event) (*Result, error)
+}
+
+// HookFunc adapts a function to a Hook
+type HookFunc func(ctx context.Context, event *Event) (*Result, error)
+
+func (f HookFunc) Handle(ctx context.Context, event *Event) (*Result, error) {
+	return f(ctx, event)
+}
+
+type RejectError struct {
+	Hook    string
+	Message string
+}
+
+func (e *RejectError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("request is rejected by hook %s", e.Hook)
+	}
+	return e.Message
+}
+
+var registeredHooks = make(map[string]Hook)
+var registeredHooksLock sync.RWMutex
+
+// Register registers an in-process hook, it is enabled by a config with the same name and without url, so it
+// should be called in init() before the options are loaded
+func Register(name string, hook Hook) {
+	registeredHooksLock.Lock()
+	defer registeredHooksLock.Unlock()
+	registeredHooks[name] = hook
+}
+
+func getRegisteredHook(name string) Hook {
+	registeredHooksLock.RLock()
+	defer registeredHooksLock.RUnlock()
+	return registeredHooks[name]
+}
+
+// Config enables a hook for the stages and the groups, in the order of the configs
+type Config struct {
+	Name string `json:"name"`
+	// URL makes the hook a webhook, otherwise the hook registered with the name is used, the secret of the
+	// webhook is kept in the HookSecret option so that it isn't exported with the configs
+	URL string `json:"url,omitempty"`
+	// Timeout is in seconds
+	Timeout int      `json:"timeout,omitempty"`
+	Stages  []Stage  `json:"stages"`
+	Groups  []string `json:"groups,omitempty"`
+	// FailClosed rejects the request if the hook fails, otherwise the failure is logged and ignored
+	FailClosed bool `json:"fail_closed,omitempty"`
+	hook       Hook
+}
+
+const defaultTimeout = 3
+
+var configs []*Config
+var configsLock sync.RWMutex
+
+// secrets maps the names of the webhooks to the secrets signing the events
+var secrets = make(map[string]string)
+var secretsLock sync.RWMutex
+
+func (cfg *Config) compile() error {
+	if cfg.Name == "" {
+		return errors.New("钩子名称不能为空")
+	}
+	if len(cfg.Stages) == 0 {
+		return fmt.Errorf("钩子 %s 没有设置阶段", cfg.Name)
+	}
+	for _, stage := range cfg.Stages {
+		if !containsStage(stages, stage) {
+			return fmt.Errorf("钩子 %s 的阶段无效：%s", cfg.Name, stage)
+		}
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("钩子 %s 的超时时间不能为负数", cfg.Name)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.URL != "" {
+		if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+			return fmt.Errorf("钩子 %s 的地址无效：%s", cfg.Name, cfg.URL)
+		}
+		cfg.hook = &webhook{name: cfg.Name, url: cfg.URL}
+		return nil
+	}
+	cfg.hook = getRegisteredHook(cfg.Name)
+	if cfg.hook == nil {
+		return fmt.Errorf("钩子 %s 未注册", cfg.Name)
+	}
+	return nil
+}
+
+func containsStage(list []Stage, stage Stage) bool {
+	for _, item := range list {
+		if item == stage {
+			return true
+		}
+	}
+	return false
+}
+
+func Configs2JSONString() string {
+	configsLock.RLock()
+	defer configsLock.RUnlock()
+	if len(configs) == 0 {
+		return "[]"
+	}
+	jsonBytes, err := json.Marshal(configs)
+	if err != nil {
+		logger.SysError("error marshalling hook configs: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// ParseConfigs parses the JSON array of the configs and resolves the hooks, the secrets are refused so that they
+// don't end up in the exported configs
+func ParseConfigs(jsonStr string) ([]*Config, error) {
+	var newConfigs []*Config
+	if strings.TrimSpace(jsonStr) != "" {
+		var rawConfigs []map[string]json.RawMessage
+		err := json.Unmarshal([]byte(jsonStr), &rawConfigs)
+		if err != nil {
+			return nil, err
+		}
+		for _, rawConfig := range rawConfigs {
+			if _, ok := rawConfig["secret"]; ok {
+				return nil, errors.New("钩子密钥请在 HookSecret 中设置")
+			}
+		}
+		err = json.Unmarshal([]byte(jsonStr), &newConfigs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range newConfigs {
+		if err := cfg.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return newConfigs, nil
+}
+
+// UpdateConfigsByJSONString keeps the current configs if the new ones are invalid
+func UpdateConfigsByJSONString(jsonStr string) error {
+	newConfigs, err := ParseConfigs(jsonStr)
+	if err != nil {
+		return err
+	}
+	configsLock.Lock()
+	configs = newConfigs
+	configsLock.Unlock()
+	return nil
+}
+
+// ParseSecrets parses the JSON object mapping the names of the webhooks to the secrets
+func ParseSecrets(jsonStr string) (map[string]string, error) {
+	newSecrets := make(map[string]string)
+	if strings.TrimSpace(jsonStr) != "" {
+		err := json.Unmarshal([]byte(jsonStr), &newSecrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newSecrets, nil
+}
+
+// UpdateSecretsByJSONString keeps the current secrets if the new ones are invalid
+func UpdateSecretsByJSONString(jsonStr string) error {
+	newSecrets, err := ParseSecrets(jsonStr)
+	if err != nil {
+		return err
+	}
+	secretsLock.Lock()
+	secrets = newSecrets
+	secretsLock.Unlock()
+	return nil
+}
+
+func getSecret(name string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	return secrets[name]
+}
+
+func getConfigs(group string, stage Stage) []*Config {
+	configsLock.RLock()
+	defer configsLock.RUnlock()
+	var result []*Config
+	for _, cfg := range configs {
+		if !containsStage(cfg.Stages, stage) {
+			continue
+		}
+		if len(cfg.Groups) != 0 && !helper.StringSliceContains(cfg.Groups, group) {
+			continue
+		}
+		result = append(result, cfg)
+	}
+	return result
+}
+
+// Enabled reports whether any hook runs at the stage for the group, so that the event is built only if needed
+func Enabled(group string, stage Stage) bool {
+	return len(getConfigs(group, stage)) != 0
+}
+
+// Run runs the hooks of the stage in order, each hook sees the body changed by the previous ones, the returned
+// result holds the final body and channel id, a *RejectError is returned if a hook rejects the request
+func Run(ctx context.Context, event *Event) (*Result, error) {
+	final := &Result{}
+	for _, cfg := range getConfigs(event.Group, event.Stage) {
+		hookCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+		result, err := cfg.hook.Handle(hookCtx, event)
+		cancel()
+		if err != nil {
+			if cfg.FailClosed {
+				logger.Errorf(ctx, "hook %s failed at stage %s: %s", cfg.Name, event.Stage, err.Error())
+				return nil, &RejectError{Hook: cfg.Name, Message: fmt.Sprintf("hook %s failed", cfg.Name)}
+			}
+			logger.Warnf(ctx, "hook %s failed at stage %s, ignored: %s", cfg.Name, event.Stage, err.Error())
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		if result.Reject {
+			logger.Warnf(ctx, "request of user %d is rejected by hook %s at stage %s", event.UserId, cfg.Name, event.Stage)
+			return nil, &RejectError{Hook: cfg.Name, Message: result.Message}
+		}
+		if len(result.Body) != 0 {
+			event.Body = result.Body
+			final.Body = result.Body
+		}
+		if result.ChannelId != 0 {
+			final.ChannelId = result.ChannelId
+		}
+	}
+	return final, nil
+}
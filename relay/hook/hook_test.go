@@ -0,0 +1,196 @@
+package hook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordHook appends its name to the calls and returns the result
+func recordHook(name string, calls *[]string, result *Result, err error) Hook {
+	return HookFunc(func(ctx context.Context, event *Event) (*Result, error) {
+		*calls = append(*calls, name+":"+string(event.Body))
+		return result, err
+	})
+}
+
+func setConfigs(t *testing.T, jsonStr string) {
+	require.NoError(t, UpdateConfigsByJSONString(jsonStr))
+	t.Cleanup(func() {
+		require.NoError(t, UpdateConfigsByJSONString(""))
+	})
+}
+
+func TestRun(t *testing.T) {
+	var calls []string
+	Register("test-first", recordHook("first", &calls, &Result{Body: json.RawMessage(`"first"`), ChannelId: 1}, nil))
+	Register("test-second", recordHook("second", &calls, &Result{Body: json.RawMessage(`"second"`)}, nil))
+	Register("test-vip", recordHook("vip", &calls, &Result{ChannelId: 2}, nil))
+	Register("test-failed", recordHook("failed", &calls, nil, errors.New("failed")))
+	Register("test-reject", recordHook("reject", &calls, &Result{Reject: true, Message: "rejected"}, nil))
+	Register("test-nil", recordHook("nil", &calls, nil, nil))
+
+	tests := []struct {
+		name      string
+		configs   string
+		group     string
+		wantCalls []string
+		wantBody  string
+		wantId    int
+		rejectBy  string
+		message   string
+	}{
+		{
+			name: "hooks run in order on the rewritten body",
+			configs: `[{"name":"test-first","stages":["request"]},{"name":"test-nil","stages":["request"]},
+				{"name":"test-second","stages":["request"]}]`,
+			group:     "default",
+			wantCalls: []string{"first:\"origin\"", "nil:\"first\"", "second:\"first\""},
+			wantBody:  `"second"`,
+			wantId:    1,
+		},
+		{
+			name:      "hooks of other stages and groups are skipped",
+			configs:   `[{"name":"test-second","stages":["chunk"]},{"name":"test-vip","stages":["request"],"groups":["vip"]}]`,
+			group:     "default",
+			wantCalls: nil,
+		},
+		{
+			name:      "the later channel id wins",
+			configs:   `[{"name":"test-first","stages":["request"]},{"name":"test-vip","stages":["request"],"groups":["vip"]}]`,
+			group:     "vip",
+			wantCalls: []string{"first:\"origin\"", "vip:\"first\""},
+			wantBody:  `"first"`,
+			wantId:    2,
+		},
+		{
+			name:      "a rejection stops the later hooks",
+			configs:   `[{"name":"test-reject","stages":["request"]},{"name":"test-second","stages":["request"]}]`,
+			group:     "default",
+			wantCalls: []string{"reject:\"origin\""},
+			rejectBy:  "test-reject",
+			message:   "rejected",
+		},
+		{
+			name:      "failures are ignored by default",
+			configs:   `[{"name":"test-failed","stages":["request"]},{"name":"test-second","stages":["request"]}]`,
+			group:     "default",
+			wantCalls: []string{"failed:\"origin\"", "second:\"origin\""},
+			wantBody:  `"second"`,
+		},
+		{
+			name:      "failures reject the request when failing closed",
+			configs:   `[{"name":"test-failed","stages":["request"],"fail_closed":true},{"name":"test-second","stages":["request"]}]`,
+			group:     "default",
+			wantCalls: []string{"failed:\"origin\""},
+			rejectBy:  "test-failed",
+			message:   "hook test-failed failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			setConfigs(t, tt.configs)
+			result, err := Run(context.Background(), &Event{
+				Stage: StageRequest,
+				Group: tt.group,
+				Body:  json.RawMessage(`"origin"`),
+			})
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.rejectBy != "" {
+				var rejectErr *RejectError
+				require.ErrorAs(t, err, &rejectErr)
+				assert.Equal(t, tt.rejectBy, rejectErr.Hook)
+				assert.Equal(t, tt.message, rejectErr.Error())
+				assert.Nil(t, result)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(result.Body))
+			assert.Equal(t, tt.wantId, result.ChannelId)
+		})
+	}
+}
+
+func TestParseConfigs(t *testing.T) {
+	Register("test-registered", HookFunc(func(ctx context.Context, event *Event) (*Result, error) {
+		return nil, nil
+	}))
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"registered", `[{"name":"test-registered","stages":["request"]}]`, false},
+		{"webhook", `[{"name":"remote","url":"https://example.com/hook","stages":["completed"]}]`, false},
+		{"unregistered", `[{"name":"test-missing","stages":["request"]}]`, true},
+		{"no stages", `[{"name":"test-registered","stages":[]}]`, true},
+		{"invalid stage", `[{"name":"test-registered","stages":["response"]}]`, true},
+		{"invalid url", `[{"name":"remote","url":"ftp://example.com","stages":["request"]}]`, true},
+		{"negative timeout", `[{"name":"test-registered","stages":["request"],"timeout":-1}]`, true},
+		{"secret", `[{"name":"remote","url":"https://example.com/hook","secret":"s","stages":["request"]}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigs(tt.json)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var signature string
+	var event Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if signature != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.Unmarshal(body, &event)
+		_, _ = w.Write([]byte(`{"body":{"model":"gpt-4o-mini"}}`))
+	}))
+	defer server.Close()
+
+	setConfigs(t, `[{"name":"remote","url":"`+server.URL+`","stages":["converted"],"fail_closed":true}]`)
+	// the configs are exported without the secret
+	assert.NotContains(t, Configs2JSONString(), "secret")
+
+	// the unsigned event is refused by the webhook
+	_, err := Run(context.Background(), &Event{Stage: StageConverted, Group: "default", Body: json.RawMessage(`{}`)})
+	assert.Error(t, err)
+	assert.Empty(t, signature)
+
+	require.NoError(t, UpdateSecretsByJSONString(`{"remote":"secret"}`))
+	defer func() {
+		require.NoError(t, UpdateSecretsByJSONString(""))
+	}()
+	result, err := Run(context.Background(), &Event{Stage: StageConverted, Group: "default", UserId: 1, Body: json.RawMessage(`{"model":"gpt-4o"}`)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, signature)
+	assert.Equal(t, 1, event.UserId)
+	assert.JSONEq(t, `{"model":"gpt-4o"}`, string(event.Body))
+	assert.JSONEq(t, `{"model":"gpt-4o-mini"}`, string(result.Body))
+
+	// the invalid secrets don't replace the current ones
+	assert.Error(t, UpdateSecretsByJSONString(`["secret"]`))
+	assert.Equal(t, "secret", getSecret("remote"))
+}
@@ -0,0 +1,62 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body signed by the secret of the webhook
+const SignatureHeader = "X-One-API-Signature"
+
+var webhookHTTPClient = &http.Client{}
+
+// webhook posts the event to the url, the response is a Result, an empty response changes nothing
+type webhook struct {
+	name string
+	url  string
+}
+
+func (w *webhook) Handle(ctx context.Context, event *Event) (*Result, error) {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := getSecret(w.name); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(jsonData)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	result := &Result{}
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
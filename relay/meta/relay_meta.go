@@ -17,7 +17,7 @@ type Meta struct {
 	TokenName    string
 	UserId       int
 	Group        string
-	ModelMapping map[string]string
+	ModelMapping model.ModelMapping
 	// BaseURL is the proxy url set in the channel config
 	BaseURL  string
 	APIKey   string
@@ -31,6 +31,10 @@ type Meta struct {
 	RequestURLPath  string
 	PromptTokens    int // only for DoResponse
 	SystemPrompt    string
+	// ContentRedacted forces the request to be rebuilt from the redacted prompt
+	ContentRedacted bool
+	// ContentFilterHits are the names of the content filter rules matched by the request or the response
+	ContentFilterHits []string
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -42,13 +46,16 @@ func GetByContext(c *gin.Context) *Meta {
 		TokenName:       c.GetString(ctxkey.TokenName),
 		UserId:          c.GetInt(ctxkey.Id),
 		Group:           c.GetString(ctxkey.Group),
-		ModelMapping:    c.GetStringMapString(ctxkey.ModelMapping),
 		OriginModelName: c.GetString(ctxkey.RequestModel),
 		BaseURL:         c.GetString(ctxkey.BaseURL),
 		APIKey:          strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
 		RequestURLPath:  c.Request.URL.String(),
 		SystemPrompt:    c.GetString(ctxkey.SystemPrompt),
 	}
+	modelMapping, ok := c.Get(ctxkey.ModelMapping)
+	if ok {
+		meta.ModelMapping, _ = modelMapping.(model.ModelMapping)
+	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
 		meta.Config = cfg.(model.ChannelConfig)
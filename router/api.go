@@ -4,6 +4,7 @@ import (
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/controller/auth"
 	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -29,12 +30,14 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), auth.WeChatAuth)
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
-		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
+		apiRouter.POST("/topup", middleware.RequirePermission(model.PermissionTopUp), middleware.Audit(model.AuditTargetUser), controller.AdminTopUp)
 
 		userRoute := apiRouter.Group("/user")
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), controller.Login)
+			userRoute.POST("/login/ldap", middleware.CriticalRateLimit(), auth.LdapLogin)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFactor)
 			userRoute.GET("/logout", controller.Logout)
 
 			selfRoute := userRoute.Group("/")
@@ -44,45 +47,63 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/self", controller.GetSelf)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
-				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/token", middleware.CriticalRateLimit(), controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
+				selfRoute.GET("/permissions", controller.GetSelfPermissions)
+				selfRoute.GET("/2fa", controller.GetTwoFactorStatus)
+				selfRoute.POST("/2fa/setup", controller.SetupTwoFactor)
+				selfRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), controller.EnableTwoFactor)
+				selfRoute.POST("/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFactor)
+				selfRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateRecoveryCodes)
 			}
 
+			userRead := middleware.RequirePermission(model.PermissionUserRead)
+			userWrite := middleware.RequirePermission(model.PermissionUserWrite)
+			userAudit := middleware.Audit(model.AuditTargetUser)
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
+				adminRoute.GET("/", userRead, controller.GetAllUsers)
+				adminRoute.GET("/search", userRead, controller.SearchUsers)
+				adminRoute.GET("/:id", userRead, controller.GetUser)
+				adminRoute.POST("/", userWrite, userAudit, controller.CreateUser)
+				adminRoute.POST("/manage", userWrite, userAudit, controller.ManageUser)
+				adminRoute.PUT("/", userWrite, userAudit, controller.UpdateUser)
+				adminRoute.DELETE("/:id", userWrite, userAudit, controller.DeleteUser)
+				adminRoute.DELETE("/:id/2fa", userWrite, userAudit, controller.ResetTwoFactor)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.GET("/", middleware.RequirePermission(model.PermissionOptionRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.RequirePermission(model.PermissionOptionWrite), middleware.Audit(model.AuditTargetOption), controller.UpdateOption)
 		}
+		channelRead := middleware.RequirePermission(model.PermissionChannelRead)
+		channelWrite := middleware.RequirePermission(model.PermissionChannelWrite)
+		channelExport := middleware.RequirePermission(model.PermissionChannelExport)
+		channelAudit := middleware.Audit(model.AuditTargetChannel)
+		channelActionAudit := middleware.AuditAction(model.AuditTargetChannel)
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ListAllModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
+			channelRoute.GET("/", channelRead, controller.GetAllChannels)
+			channelRoute.GET("/search", channelRead, controller.SearchChannels)
+			channelRoute.GET("/models", channelRead, controller.ListAllModels)
+			channelRoute.GET("/fetch_models", channelWrite, controller.FetchChannelModels)
+			channelRoute.POST("/fetch_models", channelWrite, channelAudit, controller.FetchChannelModels)
+			channelRoute.GET("/export", channelExport, controller.ExportChannels)
+			channelRoute.POST("/import", channelExport, channelAudit, controller.ImportChannels)
+			channelRoute.GET("/:id", channelRead, controller.GetChannel)
+			channelRoute.GET("/test", channelWrite, channelActionAudit, controller.TestChannels)
+			channelRoute.GET("/test/:id", channelWrite, controller.TestChannel)
+			channelRoute.GET("/test/:id/models", channelRead, controller.GetChannelModelTestResults)
+			channelRoute.POST("/test/:id/models", channelWrite, channelAudit, controller.TestChannelModels)
+			channelRoute.GET("/update_balance", channelWrite, channelActionAudit, controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", channelWrite, controller.UpdateChannelBalance)
+			channelRoute.POST("/", channelWrite, channelAudit, controller.AddChannel)
+			channelRoute.PUT("/", channelWrite, channelAudit, controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", channelWrite, channelAudit, controller.DeleteDisabledChannel)
+			channelRoute.DELETE("/:id", channelWrite, channelAudit, controller.DeleteChannel)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -94,26 +115,76 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		redemptionRead := middleware.RequirePermission(model.PermissionRedemptionRead)
+		redemptionWrite := middleware.RequirePermission(model.PermissionRedemptionWrite)
+		redemptionAudit := middleware.Audit(model.AuditTargetRedemption)
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/", redemptionRead, controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", redemptionRead, controller.SearchRedemptions)
+			redemptionRoute.GET("/:id", redemptionRead, controller.GetRedemption)
+			redemptionRoute.POST("/", redemptionWrite, redemptionAudit, controller.AddRedemption)
+			redemptionRoute.PUT("/", redemptionWrite, redemptionAudit, controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", redemptionWrite, redemptionAudit, controller.DeleteRedemption)
 		}
+		logRead := middleware.RequirePermission(model.PermissionLogRead)
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", logRead, controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.RequirePermission(model.PermissionLogDelete), middleware.Audit(model.AuditTargetLog), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", logRead, controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", logRead, controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		transactionRoute := apiRouter.Group("/transaction")
+		transactionRoute.GET("/", middleware.RequirePermission(model.PermissionTransactionRead), controller.GetQuotaTransactions)
+		transactionRoute.GET("/check", middleware.RequirePermission(model.PermissionTransactionCheck), controller.CheckQuotaTransactions)
+		transactionRoute.GET("/self", middleware.UserAuth(), controller.GetSelfQuotaTransactions)
+		priceRead := middleware.RequirePermission(model.PermissionPriceRead)
+		priceWrite := middleware.RequirePermission(model.PermissionPriceWrite)
+		priceAudit := middleware.Audit(model.AuditTargetPrice)
+		priceRoute := apiRouter.Group("/price")
+		{
+			priceRoute.GET("/", priceRead, controller.GetAllModelPrices)
+			priceRoute.GET("/search", priceRead, controller.SearchModelPrices)
+			priceRoute.GET("/:id", priceRead, controller.GetModelPrice)
+			priceRoute.POST("/", priceWrite, priceAudit, controller.AddModelPrice)
+			priceRoute.PUT("/", priceWrite, priceAudit, controller.UpdateModelPrice)
+			priceRoute.DELETE("/:id", priceWrite, priceAudit, controller.DeleteModelPrice)
+		}
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.GET("/", middleware.RequirePermission(model.PermissionAuditRead), controller.GetAuditLogs)
+		roleAudit := middleware.Audit(model.AuditTargetRole)
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.RequirePermission(model.PermissionRoleManage))
+		{
+			roleRoute.GET("/", controller.GetAllRoles)
+			roleRoute.POST("/", roleAudit, controller.AddRole)
+			roleRoute.PUT("/", roleAudit, controller.UpdateRole)
+			roleRoute.DELETE("/:id", roleAudit, controller.DeleteRole)
+			roleRoute.POST("/assign", middleware.Audit(model.AuditTargetUser), controller.AssignRole)
+		}
+		organizationManage := middleware.RequirePermission(model.PermissionOrganizationManage)
+		organizationAudit := middleware.Audit(model.AuditTargetOrganization)
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationRoute.GET("/", organizationManage, controller.GetAllOrganizations)
+			organizationRoute.GET("/search", organizationManage, controller.SearchOrganizations)
+			organizationRoute.POST("/", organizationManage, organizationAudit, controller.AddOrganization)
+			organizationRoute.PUT("/", organizationManage, organizationAudit, controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", organizationManage, organizationAudit, controller.DeleteOrganization)
+			organizationRoute.POST("/:id/topup", organizationManage, organizationAudit, controller.TopUpOrganization)
+			// the following routes are also available to the organization members and admins
+			organizationRoute.GET("/self", middleware.UserAuth(), controller.GetSelfOrganizations)
+			organizationRoute.GET("/:id", middleware.UserAuth(), controller.GetOrganization)
+			organizationRoute.GET("/:id/member", middleware.UserAuth(), controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/member", middleware.UserAuth(), organizationAudit, controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/member", middleware.UserAuth(), organizationAudit, controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/member/:user_id", middleware.UserAuth(), organizationAudit, controller.DeleteOrganizationMember)
+			organizationRoute.GET("/:id/usage", middleware.UserAuth(), controller.GetOrganizationUsage)
+		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.RequirePermission(model.PermissionGroupRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/middleware"
+)
+
+func SetScimRouter(router *gin.Engine) {
+	scimRouter := router.Group("/scim/v2")
+	scimRouter.Use(middleware.GlobalAPIRateLimit())
+	scimRouter.Use(middleware.ScimAuth())
+	{
+		scimRouter.GET("/ServiceProviderConfig", controller.GetScimServiceProviderConfig)
+		userRoute := scimRouter.Group("/Users")
+		{
+			userRoute.GET("", controller.GetScimUsers)
+			userRoute.GET("/:id", controller.GetScimUser)
+			userRoute.POST("", controller.CreateScimUser)
+			userRoute.PUT("/:id", controller.ReplaceScimUser)
+			userRoute.PATCH("/:id", controller.PatchScimUser)
+			userRoute.DELETE("/:id", controller.DeleteScimUser)
+		}
+		groupRoute := scimRouter.Group("/Groups")
+		{
+			groupRoute.GET("", controller.GetScimGroups)
+			groupRoute.GET("/:id", controller.GetScimGroup)
+			groupRoute.POST("", controller.CreateScimGroup)
+			groupRoute.PUT("/:id", controller.ReplaceScimGroup)
+			groupRoute.PATCH("/:id", controller.PatchScimGroup)
+			groupRoute.DELETE("/:id", controller.DeleteScimGroup)
+		}
+	}
+}
@@ -139,7 +139,7 @@ const TokensTable = () => {
         <div>
           <Popover
             content={
-              'sk-' + record.key
+              `sk-${record.key_prefix}...`
             }
             style={{ padding: 20 }}
             position="top"
@@ -148,12 +148,13 @@ const TokensTable = () => {
           </Popover>
           <Button theme="light" type="secondary" style={{ marginRight: 1 }}
                   onClick={async (text) => {
-                    await copyText('sk-' + record.key);
+                    const key = askForKey(record);
+                    if (key) await copyText('sk-' + key);
                   }}
           >复制</Button>
           <SplitButtonGroup style={{ marginRight: 1 }} aria-label="项目操作按钮组">
             <Button theme="light" style={{ color: 'rgba(var(--semi-teal-7), 1)' }} onClick={() => {
-              onOpenLink('next', record.key);
+              onOpenLink('next', askForKey(record));
             }}>聊天</Button>
             <Dropdown trigger="click" position="bottomRight" menu={
               [
@@ -163,7 +164,7 @@ const TokensTable = () => {
                   disabled: !localStorage.getItem('chat_link'),
                   name: 'ChatGPT Next Web',
                   onClick: () => {
-                    onOpenLink('next', record.key);
+                    onOpenLink('next', askForKey(record));
                   }
                 },
                 {
@@ -172,22 +173,22 @@ const TokensTable = () => {
                   disabled: !localStorage.getItem('chat_link2'),
                   name: 'ChatGPT Web & Midjourney',
                   onClick: () => {
-                    onOpenLink('next-mj', record.key);
+                    onOpenLink('next-mj', askForKey(record));
                   }
                 },
                 {
                   node: 'item', key: 'ama', name: 'AMA 问天（BotGem）', onClick: () => {
-                    onOpenLink('ama', record.key);
+                    onOpenLink('ama', askForKey(record));
                   }
                 },
                 {
                   node: 'item', key: 'opencat', name: 'OpenCat', onClick: () => {
-                    onOpenLink('opencat', record.key);
+                    onOpenLink('opencat', askForKey(record));
                   }
                 },
                 {
                   node: 'item', key: 'lobechat', name: 'LobeChat', onClick: () => {
-                    onOpenLink('lobechat');
+                    onOpenLink('lobechat', askForKey(record));
                   }
                 }
               ]
@@ -205,7 +206,7 @@ const TokensTable = () => {
             onConfirm={() => {
               manageToken(record.id, 'delete', record).then(
                 () => {
-                  removeRecord(record.key);
+                  removeRecord(record.id);
                 }
               );
             }}
@@ -247,7 +248,6 @@ const TokensTable = () => {
   const [pageSize, setPageSize] = useState(ITEMS_PER_PAGE);
   const [showEdit, setShowEdit] = useState(false);
   const [tokens, setTokens] = useState([]);
-  const [selectedKeys, setSelectedKeys] = useState([]);
   const [tokenCount, setTokenCount] = useState(pageSize);
   const [loading, setLoading] = useState(true);
   const [activePage, setActivePage] = useState(1);
@@ -356,6 +356,13 @@ const TokensTable = () => {
     // }
   };
 
+  // only the hash of the key is stored, so the user needs to provide the key
+  const askForKey = (token) => {
+    let key = window.prompt(`令牌只在创建时显示，请输入完整的令牌 sk-${token.key_prefix}...`);
+    if (!key) return '';
+    return key.trim().replace(/^sk-/, '');
+  };
+
   const copyText = async (text) => {
     if (await copy(text)) {
       showSuccess('已复制到剪贴板！');
@@ -366,6 +373,7 @@ const TokensTable = () => {
   };
 
   const onOpenLink = async (type, key) => {
+    if (!key) return;
     let status = localStorage.getItem('status');
     let serverAddress = '';
     if (status) {
@@ -416,10 +424,10 @@ const TokensTable = () => {
       });
   }, [pageSize, orderBy]);
 
-  const removeRecord = key => {
+  const removeRecord = id => {
     let newDataSource = [...tokens];
-    if (key != null) {
-      let idx = newDataSource.findIndex(data => data.key === key);
+    if (id != null) {
+      let idx = newDataSource.findIndex(data => data.id === id);
 
       if (idx > -1) {
         newDataSource.splice(idx, 1);
@@ -516,16 +524,6 @@ const TokensTable = () => {
     }
   };
 
-  const rowSelection = {
-    onSelect: (record, selected) => {
-    },
-    onSelectAll: (selected, selectedRows) => {
-    },
-    onChange: (selectedRowKeys, selectedRows) => {
-      setSelectedKeys(selectedRows);
-    }
-  };
-
   const handleRow = (record, index) => {
     if (record.status !== 1) {
       return {
@@ -591,7 +589,7 @@ const TokensTable = () => {
           setActivePage(1);
         },
         onPageChange: handlePageChange
-      }} loading={loading} rowSelection={rowSelection} onRow={handleRow}>
+      }} loading={loading} rowKey="id" onRow={handleRow}>
       </Table>
       <Button theme="light" type="primary" style={{ marginRight: 8 }} onClick={
         () => {
@@ -601,19 +599,6 @@ const TokensTable = () => {
           setShowEdit(true);
         }
       }>添加令牌</Button>
-      <Button label="复制所选令牌" type="warning" onClick={
-        async () => {
-          if (selectedKeys.length === 0) {
-            showError('请至少选择一个令牌！');
-            return;
-          }
-          let keys = '';
-          for (let i = 0; i < selectedKeys.length; i++) {
-            keys += selectedKeys[i].name + '    sk-' + selectedKeys[i].key + '\n';
-          }
-          await copyText(keys);
-        }
-      }>复制所选令牌到剪贴板</Button>
       <Dropdown
         trigger="click"
         position="bottomLeft"
@@ -40,6 +40,11 @@ const SystemSetting = () => {
     OidcAuthorizationEndpoint: '',
     OidcTokenEndpoint: '',
     OidcUserinfoEndpoint: '',
+    OidcGroupClaim: '',
+    OidcGroupMapping: '',
+    OidcRoleClaim: '',
+    OidcRoleMapping: '',
+    OidcPasswordLoginEnabled: '',
     Notice: '',
     SMTPServer: '',
     SMTPPort: '',
@@ -102,6 +107,7 @@ const SystemSetting = () => {
       case 'EmailDomainRestrictionEnabled':
       case 'RegisterEnabled':
       case 'OidcEnabled':
+      case 'OidcPasswordLoginEnabled':
         value = inputs[key] === 'true' ? 'false' : 'true';
         break;
       default:
@@ -156,7 +162,11 @@ const SystemSetting = () => {
       name === 'OidcWellKnown' ||
       name === 'OidcAuthorizationEndpoint' ||
       name === 'OidcTokenEndpoint' ||
-      name === 'OidcUserinfoEndpoint'
+      name === 'OidcUserinfoEndpoint' ||
+      name === 'OidcGroupClaim' ||
+      name === 'OidcGroupMapping' ||
+      name === 'OidcRoleClaim' ||
+      name === 'OidcRoleMapping'
     )
     {
       setInputs((inputs) => ({ ...inputs, [name]: value }));
@@ -275,6 +285,11 @@ const SystemSetting = () => {
     if (originInputs['OidcUserinfoEndpoint'] !== inputs.OidcUserinfoEndpoint) {
       await updateOption('OidcUserinfoEndpoint', inputs.OidcUserinfoEndpoint);
     }
+    for (const key of ['OidcGroupClaim', 'OidcGroupMapping', 'OidcRoleClaim', 'OidcRoleMapping']) {
+      if (originInputs[key] !== inputs[key]) {
+        await updateOption(key, inputs[key]);
+      }
+    }
   };
 
   return (
@@ -777,6 +792,68 @@ const SystemSetting = () => {
                 />
               </FormControl>
             </Grid>
+            <Grid xs={ 12 } md={ 6 }>
+              <FormControl fullWidth>
+                <InputLabel htmlFor="OidcGroupClaim">分组 Claim</InputLabel>
+                <OutlinedInput
+                  id="OidcGroupClaim"
+                  name="OidcGroupClaim"
+                  value={ inputs.OidcGroupClaim || '' }
+                  onChange={ handleInputChange }
+                  label="分组 Claim"
+                  placeholder="例如 groups，支持 realm_access.roles 这样的嵌套 Claim"
+                  disabled={ loading }
+                />
+              </FormControl>
+            </Grid>
+            <Grid xs={ 12 } md={ 6 }>
+              <FormControl fullWidth>
+                <InputLabel htmlFor="OidcRoleClaim">角色 Claim</InputLabel>
+                <OutlinedInput
+                  id="OidcRoleClaim"
+                  name="OidcRoleClaim"
+                  value={ inputs.OidcRoleClaim || '' }
+                  onChange={ handleInputChange }
+                  label="角色 Claim"
+                  placeholder="例如 roles"
+                  disabled={ loading }
+                />
+              </FormControl>
+            </Grid>
+            <Grid xs={ 12 } md={ 6 }>
+              <FormControl fullWidth>
+                <TextField
+                  multiline
+                  minRows={ 3 }
+                  name="OidcGroupMapping"
+                  value={ inputs.OidcGroupMapping || '' }
+                  onChange={ handleInputChange }
+                  label="分组映射"
+                  placeholder='JSON 对象，键为 Claim 的值，值为本系统的分组，例如 {"paid": "vip"}'
+                  disabled={ loading }
+                />
+              </FormControl>
+            </Grid>
+            <Grid xs={ 12 } md={ 6 }>
+              <FormControl fullWidth>
+                <TextField
+                  multiline
+                  minRows={ 3 }
+                  name="OidcRoleMapping"
+                  value={ inputs.OidcRoleMapping || '' }
+                  onChange={ handleInputChange }
+                  label="角色映射"
+                  placeholder='JSON 对象，键为 Claim 的值，值为 common 或 admin，例如 {"oneapi-admin": "admin"}'
+                  disabled={ loading }
+                />
+              </FormControl>
+            </Grid>
+            <Grid xs={ 12 }>
+              <FormControlLabel
+                label="允许已绑定 OIDC 的用户通过密码登录（root 用户不受限制）"
+                control={<Checkbox checked={inputs.OidcPasswordLoginEnabled === 'true'} onChange={handleInputChange} name="OidcPasswordLoginEnabled" />}
+              />
+            </Grid>
             <Grid xs={ 12 }>
               <Button variant="contained" onClick={ submitOidc }>
                 保存 OIDC 设置
@@ -70,12 +70,14 @@ const EditModal = ({ open, tokenId, onCancel, onOk }) => {
     } else {
       res = await API.post(`/api/token/`, { ...values, models: models });
     }
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
       if (values.is_edit) {
         showSuccess('令牌更新成功！');
       } else {
-        showSuccess('令牌创建成功，请在列表页面点击复制获取令牌！');
+        // the key is only returned once, it can't be viewed again
+        showSuccess('令牌创建成功！');
+        window.prompt('令牌仅显示这一次，请立即复制并妥善保存', `sk-${data.key}`);
       }
       setSubmitting(false);
       setStatus({ success: true });
@@ -8,6 +8,7 @@ const TokenTableHead = () => {
         <TableCell>状态</TableCell>
         <TableCell>已用额度</TableCell>
         <TableCell>剩余额度</TableCell>
+        <TableCell>令牌</TableCell>
         <TableCell>创建时间</TableCell>
         <TableCell>过期时间</TableCell>
         <TableCell>操作</TableCell>
@@ -40,6 +40,13 @@ function replacePlaceholders(text, key, serverAddress) {
   return text.replace('{key}', key).replace('{serverAddress}', serverAddress);
 }
 
+// only the hash of the key is stored, so the user needs to provide the key
+function askForKey(item) {
+  let key = window.prompt(`令牌只在创建时显示，请输入完整的令牌 sk-${item.key_prefix}...`);
+  if (!key) return '';
+  return key.trim().replace(/^sk-/, '');
+}
+
 function createMenu(menuItems) {
   return (
     <>
@@ -137,7 +144,11 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
       url = siteInfo.chat_link + `/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}`;
     }
 
-    const key = item.key;
+    const key = askForKey(item);
+    if (!key) {
+      handleCloseMenu();
+      return;
+    }
     const text = replacePlaceholders(url, key, serverAddress);
     if (type === 'link') {
       window.open(text);
@@ -201,6 +212,8 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
 
         <TableCell>{item.unlimited_quota ? '无限制' : renderQuota(item.remain_quota, 2)}</TableCell>
 
+        <TableCell>{`sk-${item.key_prefix}...`}</TableCell>
+
         <TableCell>{timestamp2string(item.created_time)}</TableCell>
 
         <TableCell>{item.expired_time === -1 ? '永不过期' : timestamp2string(item.expired_time)}</TableCell>
@@ -211,7 +224,8 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
               <Button
                 color="primary"
                 onClick={() => {
-                  copy(`sk-${item.key}`);
+                  const key = askForKey(item);
+                  if (key) copy(`sk-${key}`);
                 }}
               >
                 复制
@@ -1,5 +1,5 @@
 import React, { useEffect, useState } from 'react';
-import { Button, Dropdown, Form, Input, Label, Message, Pagination, Popup, Table } from 'semantic-ui-react';
+import { Button, Dropdown, Form, Input, Label, Message, Modal, Pagination, Popup, Table } from 'semantic-ui-react';
 import { Link } from 'react-router-dom';
 import {
   API,
@@ -52,6 +52,10 @@ function renderBalance(type, balance) {
       return <span>¥{balance.toFixed(2)}</span>;
     case 13: // AIGC2D
       return <span>{renderNumber(balance)}</span>;
+    case 20: // OpenRouter
+      return <span>${balance.toFixed(2)}</span>;
+    case 25: // Moonshot
+      return <span>¥{balance.toFixed(2)}</span>;
     case 36: // DeepSeek
       return <span>¥{balance.toFixed(2)}</span>;
     case 44: // SiliconFlow
@@ -76,6 +80,9 @@ const ChannelsTable = () => {
   const [updatingBalance, setUpdatingBalance] = useState(false);
   const [showPrompt, setShowPrompt] = useState(shouldShowPrompt(promptID));
   const [showDetail, setShowDetail] = useState(isShowDetail());
+  const [modelTestChannel, setModelTestChannel] = useState(null);
+  const [modelTestRunning, setModelTestRunning] = useState(false);
+  const [modelTestResults, setModelTestResults] = useState([]);
 
   const loadChannels = async (startIdx) => {
     const res = await API.get(`/api/channel/?p=${startIdx}`);
@@ -288,6 +295,48 @@ const ChannelsTable = () => {
     setChannels(newChannels);
   };
 
+  const loadModelTestResults = async (id) => {
+    const res = await API.get(`/api/channel/test/${id}/models`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setModelTestResults(data.results);
+      setModelTestRunning(data.running);
+    } else {
+      showError(message);
+    }
+  };
+
+  const openModelTest = async (channel) => {
+    setModelTestChannel(channel);
+    setModelTestResults([]);
+    await loadModelTestResults(channel.id);
+  };
+
+  const testChannelModels = async (id) => {
+    const res = await API.post(`/api/channel/test/${id}/models`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setModelTestRunning(true);
+      let info = `已开始测试，共 ${data.tests} 项。`;
+      if (data.skipped && data.skipped.length > 0) {
+        info += `跳过不支持测试的模型：${data.skipped.join(', ')}`;
+      }
+      showInfo(info);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    if (!modelTestChannel || !modelTestRunning) {
+      return;
+    }
+    const timer = setInterval(() => {
+      loadModelTestResults(modelTestChannel.id).then();
+    }, 2000);
+    return () => clearInterval(timer);
+  }, [modelTestChannel, modelTestRunning]);
+
   const testChannels = async (scope) => {
     const res = await API.get(`/api/channel/test?scope=${scope}`);
     const { success, message } = res.data;
@@ -533,6 +582,14 @@ const ChannelsTable = () => {
                       >
                         测试
                       </Button>
+                      <Button
+                        size={'small'}
+                        onClick={() => {
+                          openModelTest(channel).then();
+                        }}
+                      >
+                        全部模型
+                      </Button>
                       {/*<Button*/}
                       {/*  size={'small'}*/}
                       {/*  positive*/}
@@ -633,6 +690,57 @@ const ChannelsTable = () => {
           </Table.Row>
         </Table.Footer>
       </Table>
+      <Modal open={modelTestChannel !== null} onClose={() => setModelTestChannel(null)}>
+        <Modal.Header>测试渠道 {modelTestChannel?.name} 的全部模型</Modal.Header>
+        <Modal.Content scrolling>
+          <Message>
+            按模型名称测试对话、流式、Embedding 和工具调用，图片、语音等模型将被跳过，测试结果不会影响渠道的启用状态。
+          </Message>
+          <Table basic compact size='small'>
+            <Table.Header>
+              <Table.Row>
+                <Table.HeaderCell>模型</Table.HeaderCell>
+                <Table.HeaderCell>模式</Table.HeaderCell>
+                <Table.HeaderCell>结果</Table.HeaderCell>
+                <Table.HeaderCell>耗时</Table.HeaderCell>
+                <Table.HeaderCell>测试时间</Table.HeaderCell>
+                <Table.HeaderCell>错误</Table.HeaderCell>
+              </Table.Row>
+            </Table.Header>
+            <Table.Body>
+              {modelTestResults.map((result) => (
+                <Table.Row key={result.id}>
+                  <Table.Cell>{result.model}</Table.Cell>
+                  <Table.Cell>{result.mode}</Table.Cell>
+                  <Table.Cell>
+                    {result.success ? (
+                      <Label basic color='green'>通过</Label>
+                    ) : (
+                      <Label basic color='red'>失败</Label>
+                    )}
+                  </Table.Cell>
+                  <Table.Cell>{(result.latency / 1000).toFixed(2)} 秒</Table.Cell>
+                  <Table.Cell>{renderTimestamp(result.created_at)}</Table.Cell>
+                  <Table.Cell>{result.error}</Table.Cell>
+                </Table.Row>
+              ))}
+            </Table.Body>
+          </Table>
+        </Modal.Content>
+        <Modal.Actions>
+          <Button
+            positive
+            loading={modelTestRunning}
+            disabled={modelTestRunning}
+            onClick={() => {
+              testChannelModels(modelTestChannel.id).then();
+            }}
+          >
+            开始测试
+          </Button>
+          <Button onClick={() => setModelTestChannel(null)}>关闭</Button>
+        </Modal.Actions>
+      </Modal>
     </>
   );
 };
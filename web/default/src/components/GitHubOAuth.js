@@ -1,7 +1,7 @@
 import React, { useContext, useEffect, useState } from 'react';
 import { Dimmer, Loader, Segment } from 'semantic-ui-react';
 import { useNavigate, useSearchParams } from 'react-router-dom';
-import { API, showError, showSuccess } from '../helpers';
+import { API, showError, showInfo, showSuccess } from '../helpers';
 import { UserContext } from '../context/User';
 
 const GitHubOAuth = () => {
@@ -26,6 +26,9 @@ const GitHubOAuth = () => {
         showSuccess('登录成功！');
         navigate('/');
       }
+    } else if (data?.two_factor_required || data?.two_factor_setup_required) {
+      showInfo(message);
+      navigate('/login', { state: { twoFactor: data } });
     } else {
       showError(message);
       if (count === 0) {
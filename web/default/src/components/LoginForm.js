@@ -1,8 +1,8 @@
 import React, { useContext, useEffect, useState } from 'react';
 import { Button, Divider, Form, Grid, Header, Image, Message, Modal, Segment } from 'semantic-ui-react';
-import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { Link, useLocation, useNavigate, useSearchParams } from 'react-router-dom';
 import { UserContext } from '../context/User';
-import { API, getLogo, showError, showSuccess, showWarning } from '../helpers';
+import { API, getLogo, showError, showInfo, showSuccess, showWarning } from '../helpers';
 import { onGitHubOAuthClicked, onLarkOAuthClicked } from './utils';
 import larkIcon from '../images/lark.svg';
 
@@ -10,7 +10,8 @@ const LoginForm = () => {
   const [inputs, setInputs] = useState({
     username: '',
     password: '',
-    wechat_verification_code: ''
+    wechat_verification_code: '',
+    two_factor_code: ''
   });
   const [searchParams, setSearchParams] = useSearchParams();
   const [submitted, setSubmitted] = useState(false);
@@ -19,11 +20,19 @@ const LoginForm = () => {
   let navigate = useNavigate();
   const [status, setStatus] = useState({});
   const logo = getLogo();
+  const location = useLocation();
+  // set when the first factor is passed, see setupPendingTwoFactorLogin
+  const [twoFactor, setTwoFactor] = useState(null);
+  const [recoveryCodes, setRecoveryCodes] = useState([]);
+  const [ldapLogin, setLdapLogin] = useState(false);
 
   useEffect(() => {
     if (searchParams.get('expired')) {
       showError('未登录或登录已过期，请重新登录！');
     }
+    if (location.state?.twoFactor) {
+      setTwoFactor(location.state.twoFactor);
+    }
     let status = localStorage.getItem('status');
     if (status) {
       status = JSON.parse(status);
@@ -48,6 +57,51 @@ const LoginForm = () => {
       navigate('/');
       showSuccess('登录成功！');
       setShowWeChatLoginModal(false);
+    } else if (checkTwoFactor(message, data)) {
+      setShowWeChatLoginModal(false);
+    } else {
+      showError(message);
+    }
+  };
+
+  // returns true if the second factor is required
+  const checkTwoFactor = (message, data) => {
+    if (data?.two_factor_required || data?.two_factor_setup_required) {
+      setTwoFactor(data);
+      showInfo(message);
+      return true;
+    }
+    return false;
+  };
+
+  const onLoginSuccess = (data) => {
+    userDispatch({ type: 'login', payload: data });
+    localStorage.setItem('user', JSON.stringify(data));
+    if (username === 'root' && password === '123456') {
+      navigate('/user/edit');
+      showSuccess('登录成功！');
+      showWarning('请立刻修改默认密码！');
+    } else {
+      navigate('/token');
+      showSuccess('登录成功！');
+    }
+  };
+
+  const onSubmitTwoFactorCode = async () => {
+    if (!inputs.two_factor_code) return;
+    const res = await API.post(`/api/user/login/2fa`, {
+      code: inputs.two_factor_code
+    });
+    const { success, message, data, recovery_codes } = res.data;
+    if (success) {
+      if (recovery_codes) {
+        // two-factor authentication was just enabled, show the recovery codes before leaving
+        userDispatch({ type: 'login', payload: data });
+        localStorage.setItem('user', JSON.stringify(data));
+        setRecoveryCodes(recovery_codes);
+        return;
+      }
+      onLoginSuccess(data);
     } else {
       showError(message);
     }
@@ -61,23 +115,14 @@ const LoginForm = () => {
   async function handleSubmit(e) {
     setSubmitted(true);
     if (username && password) {
-      const res = await API.post(`/api/user/login`, {
+      const res = await API.post(ldapLogin ? `/api/user/login/ldap` : `/api/user/login`, {
         username,
         password
       });
       const { success, message, data } = res.data;
       if (success) {
-        userDispatch({ type: 'login', payload: data });
-        localStorage.setItem('user', JSON.stringify(data));
-        if (username === 'root' && password === '123456') {
-          navigate('/user/edit');
-          showSuccess('登录成功！');
-          showWarning('请立刻修改默认密码！');
-        } else {
-          navigate('/token');
-          showSuccess('登录成功！');
-        }
-      } else {
+        onLoginSuccess(data);
+      } else if (!checkTwoFactor(message, data)) {
         showError(message);
       }
     }
@@ -89,32 +134,86 @@ const LoginForm = () => {
         <Header as='h2' color='' textAlign='center'>
           <Image src={logo} /> 用户登录
         </Header>
-        <Form size='large'>
-          <Segment>
-            <Form.Input
-              fluid
-              icon='user'
-              iconPosition='left'
-              placeholder='用户名 / 邮箱地址'
-              name='username'
-              value={username}
-              onChange={handleChange}
-            />
-            <Form.Input
-              fluid
-              icon='lock'
-              iconPosition='left'
-              placeholder='密码'
-              name='password'
-              type='password'
-              value={password}
-              onChange={handleChange}
-            />
-            <Button color='green' fluid size='large' onClick={handleSubmit}>
-              登录
+        {twoFactor ? (
+          <Form size='large'>
+            <Segment>
+              {twoFactor.two_factor_setup_required && (
+                <>
+                  <Message>
+                    管理员要求启用两步验证，请在身份验证器中添加以下密钥，或使用 otpauth 链接生成二维码后扫描。
+                  </Message>
+                  <Form.Input fluid readOnly label='密钥' value={twoFactor.secret} />
+                  <Form.Input fluid readOnly label='otpauth 链接' value={twoFactor.uri} />
+                </>
+              )}
+              <Form.Input
+                fluid
+                icon='shield'
+                iconPosition='left'
+                placeholder={twoFactor.two_factor_setup_required ? '验证码' : '验证码或恢复码'}
+                name='two_factor_code'
+                value={inputs.two_factor_code}
+                onChange={handleChange}
+              />
+              <Button color='green' fluid size='large' onClick={onSubmitTwoFactorCode}>
+                验证
+              </Button>
+            </Segment>
+          </Form>
+        ) : (
+          <Form size='large'>
+            <Segment>
+              <Form.Input
+                fluid
+                icon='user'
+                iconPosition='left'
+                placeholder='用户名 / 邮箱地址'
+                name='username'
+                value={username}
+                onChange={handleChange}
+              />
+              <Form.Input
+                fluid
+                icon='lock'
+                iconPosition='left'
+                placeholder='密码'
+                name='password'
+                type='password'
+                value={password}
+                onChange={handleChange}
+              />
+              {status.ldap && (
+                <Form.Checkbox
+                  label='使用 LDAP 账户登录'
+                  checked={ldapLogin}
+                  onChange={() => setLdapLogin(!ldapLogin)}
+                />
+              )}
+              <Button color='green' fluid size='large' onClick={handleSubmit}>
+                登录
+              </Button>
+            </Segment>
+          </Form>
+        )}
+        <Modal open={recoveryCodes.length > 0} size={'tiny'}>
+          <Modal.Header>两步验证已启用</Modal.Header>
+          <Modal.Content>
+            <p>以下恢复码在丢失身份验证器时可用于登录，每个只能使用一次，请妥善保存，此处只显示一次：</p>
+            <p style={{ fontFamily: 'monospace' }}>{recoveryCodes.join(' ')}</p>
+          </Modal.Content>
+          <Modal.Actions>
+            <Button
+              color='green'
+              onClick={() => {
+                setRecoveryCodes([]);
+                navigate('/token');
+                showSuccess('登录成功！');
+              }}
+            >
+              我已保存
             </Button>
-          </Segment>
-        </Form>
+          </Modal.Actions>
+        </Modal>
         <Message>
           忘记密码？
           <Link to='/reset' className='btn btn-link'>
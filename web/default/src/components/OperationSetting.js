@@ -13,6 +13,9 @@ const OperationSetting = () => {
     ModelRatio: '',
     CompletionRatio: '',
     GroupRatio: '',
+    ContentFilterRules: '',
+    Hooks: '',
+    HookSecret: '',
     TopUpLink: '',
     ChatLink: '',
     QuotaPerUnit: 0,
@@ -35,10 +38,10 @@ const OperationSetting = () => {
     if (success) {
       let newInputs = {};
       data.forEach((item) => {
-        if (item.key === 'ModelRatio' || item.key === 'GroupRatio' || item.key === 'CompletionRatio') {
+        if (item.key === 'ModelRatio' || item.key === 'GroupRatio' || item.key === 'CompletionRatio' || item.key === 'ContentFilterRules' || item.key === 'Hooks') {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
-        if (item.value === '{}') {
+        if (item.value === '{}' || item.value === '[]') {
           item.value = '';
         }
         newInputs[item.key] = item.value;
@@ -113,6 +116,31 @@ const OperationSetting = () => {
           await updateOption('CompletionRatio', inputs.CompletionRatio);
         }
         break;
+      case 'filter':
+        if (originInputs['ContentFilterRules'] !== inputs.ContentFilterRules) {
+          if (inputs.ContentFilterRules !== '' && !verifyJSON(inputs.ContentFilterRules)) {
+            showError('内容过滤规则不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ContentFilterRules', inputs.ContentFilterRules);
+        }
+        break;
+      case 'hook':
+        if (originInputs['Hooks'] !== inputs.Hooks) {
+          if (inputs.Hooks !== '' && !verifyJSON(inputs.Hooks)) {
+            showError('钩子配置不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('Hooks', inputs.Hooks);
+        }
+        if (inputs.HookSecret) {
+          if (!verifyJSON(inputs.HookSecret)) {
+            showError('钩子密钥不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('HookSecret', inputs.HookSecret);
+        }
+        break;
       case 'quota':
         if (originInputs['QuotaForNewUser'] !== inputs.QuotaForNewUser) {
           await updateOption('QuotaForNewUser', inputs.QuotaForNewUser);
@@ -380,6 +408,53 @@ const OperationSetting = () => {
           <Form.Button onClick={() => {
             submitConfig('ratio').then();
           }}>保存倍率设置</Form.Button>
+          <Divider />
+          <Header as='h3'>
+            内容过滤
+          </Header>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='内容过滤规则'
+              name='ContentFilterRules'
+              onChange={handleInputChange}
+              style={{ minHeight: 250, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.ContentFilterRules}
+              placeholder={'为一个 JSON 数组，每条规则包含名称 name、关键词 keywords（不区分大小写）或正则表达式 patterns、动作 action（block 拒绝请求，redact 替换为 replacement，flag 仅在日志中记录），可选的 groups 与 token_ids 用于限定分组与令牌，scan_output 为 true 时同时检查流式输出，例如：\n' + JSON.stringify([{ name: 'api-key', patterns: ['sk-[A-Za-z0-9]{20,}'], action: 'redact' }, { name: 'banned', keywords: ['违禁词'], action: 'block', scan_output: true }], null, 2)}
+            />
+          </Form.Group>
+          <Form.Button onClick={() => {
+            submitConfig('filter').then();
+          }}>保存内容过滤设置</Form.Button>
+          <Divider />
+          <Header as='h3'>
+            钩子
+          </Header>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='钩子配置'
+              name='Hooks'
+              onChange={handleInputChange}
+              style={{ minHeight: 250, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.Hooks}
+              placeholder={'为一个 JSON 数组，按顺序执行，每个钩子包含名称 name、阶段 stages（request、channel、converted、chunk、completed）、可选的分组 groups、超时秒数 timeout（默认 3）以及 fail_closed（钩子失败时拒绝请求），设置 url 即为 Webhook，否则使用代码中以该名称注册的钩子，例如：\n' + JSON.stringify([{ name: 'guardrail', url: 'https://example.com/hook', stages: ['request'], groups: ['default'], timeout: 3 }], null, 2)}
+            />
+          </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='钩子密钥'
+              name='HookSecret'
+              onChange={handleInputChange}
+              style={{ minHeight: 100, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.HookSecret || ''}
+              placeholder={'敏感信息不会发送到前端显示，为一个 JSON 对象，键为 Webhook 的名称，值为签名请求体的密钥，保存时将替换所有密钥，例如：\n' + JSON.stringify({ guardrail: 'secret' }, null, 2)}
+            />
+          </Form.Group>
+          <Form.Button onClick={() => {
+            submitConfig('hook').then();
+          }}>保存钩子设置</Form.Button>
         </Form>
       </Grid.Column>
     </Grid>
@@ -14,7 +14,8 @@ const PersonalSetting = () => {
     wechat_verification_code: '',
     email_verification_code: '',
     email: '',
-    self_account_deletion_confirmation: ''
+    self_account_deletion_confirmation: '',
+    two_factor_code: ''
   });
   const [status, setStatus] = useState({});
   const [showWeChatBindModal, setShowWeChatBindModal] = useState(false);
@@ -28,6 +29,9 @@ const PersonalSetting = () => {
   const [countdown, setCountdown] = useState(30);
   const [affLink, setAffLink] = useState("");
   const [systemToken, setSystemToken] = useState("");
+  const [twoFactor, setTwoFactor] = useState({ enabled: false, required: false });
+  const [twoFactorSetup, setTwoFactorSetup] = useState(null);
+  const [recoveryCodes, setRecoveryCodes] = useState([]);
 
   useEffect(() => {
     let status = localStorage.getItem('status');
@@ -39,6 +43,7 @@ const PersonalSetting = () => {
         setTurnstileSiteKey(status.turnstile_site_key);
       }
     }
+    loadTwoFactorStatus().then();
   }, []);
 
   useEffect(() => {
@@ -58,8 +63,80 @@ const PersonalSetting = () => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
   };
 
+  const loadTwoFactorStatus = async () => {
+    const res = await API.get('/api/user/2fa');
+    const { success, data } = res.data;
+    if (success) {
+      setTwoFactor(data);
+    }
+  };
+
+  const askForTwoFactorCode = () => {
+    let code = window.prompt('请输入身份验证器中的两步验证码，或一个恢复码');
+    if (!code) return '';
+    return code.trim();
+  };
+
+  const setupTwoFactor = async () => {
+    const res = await API.post('/api/user/2fa/setup');
+    const { success, message, data } = res.data;
+    if (success) {
+      setTwoFactorSetup(data);
+      setRecoveryCodes([]);
+    } else {
+      showError(message);
+    }
+  };
+
+  const enableTwoFactor = async () => {
+    if (inputs.two_factor_code === '') return;
+    const res = await API.post('/api/user/2fa/enable', { code: inputs.two_factor_code });
+    const { success, message, data } = res.data;
+    if (success) {
+      setTwoFactorSetup(null);
+      setRecoveryCodes(data);
+      setInputs((inputs) => ({ ...inputs, two_factor_code: '' }));
+      showSuccess('两步验证已启用，请妥善保存恢复码！');
+      await loadTwoFactorStatus();
+    } else {
+      showError(message);
+    }
+  };
+
+  const disableTwoFactor = async () => {
+    const code = askForTwoFactorCode();
+    if (!code) return;
+    const res = await API.post('/api/user/2fa/disable', { code });
+    const { success, message } = res.data;
+    if (success) {
+      setRecoveryCodes([]);
+      showSuccess('两步验证已关闭');
+      await loadTwoFactorStatus();
+    } else {
+      showError(message);
+    }
+  };
+
+  const regenerateRecoveryCodes = async () => {
+    const code = askForTwoFactorCode();
+    if (!code) return;
+    const res = await API.post('/api/user/2fa/recovery_codes', { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      setRecoveryCodes(data);
+      showSuccess('恢复码已重新生成，旧的恢复码已失效');
+    } else {
+      showError(message);
+    }
+  };
+
   const generateAccessToken = async () => {
-    const res = await API.get('/api/user/token');
+    let code = '';
+    if (twoFactor.enabled) {
+      code = askForTwoFactorCode();
+      if (!code) return;
+    }
+    const res = await API.get(`/api/user/token?code=${encodeURIComponent(code)}`);
     const { success, message, data } = res.data;
     if (success) {
       setSystemToken(data);
@@ -201,6 +278,45 @@ const PersonalSetting = () => {
         />
       )}
       <Divider />
+      <Header as='h3'>两步验证</Header>
+      {twoFactor.required && !twoFactor.enabled && (
+        <Message warning>管理员要求启用两步验证</Message>
+      )}
+      {twoFactor.enabled ? (
+        <>
+          <Button onClick={regenerateRecoveryCodes}>重新生成恢复码</Button>
+          {!twoFactor.required && (
+            <Button onClick={disableTwoFactor}>关闭两步验证</Button>
+          )}
+        </>
+      ) : (
+        <Button onClick={setupTwoFactor}>启用两步验证</Button>
+      )}
+      {twoFactorSetup && (
+        <Form style={{ marginTop: '10px' }}>
+          <Message>
+            请在身份验证器中添加以下密钥，或使用 otpauth 链接生成二维码后扫描，然后输入身份验证器显示的验证码。
+          </Message>
+          <Form.Input fluid readOnly label='密钥' value={twoFactorSetup.secret} />
+          <Form.Input fluid readOnly label='otpauth 链接' value={twoFactorSetup.uri} />
+          <Form.Input
+            fluid
+            placeholder='验证码'
+            name='two_factor_code'
+            value={inputs.two_factor_code}
+            onChange={handleInputChange}
+            action={<Button onClick={enableTwoFactor}>确认启用</Button>}
+          />
+        </Form>
+      )}
+      {recoveryCodes.length > 0 && (
+        <Message>
+          <Message.Header>恢复码</Message.Header>
+          <p>每个恢复码只能使用一次，丢失身份验证器时可用于登录，请妥善保存，此处只显示一次：</p>
+          <p style={{ fontFamily: 'monospace' }}>{recoveryCodes.join(' ')}</p>
+        </Message>
+      )}
+      <Divider />
       <Header as='h3'>账号绑定</Header>
       {
         status.wechat_login && (
@@ -1,6 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { Button, Divider, Form, Grid, Header, Modal, Message } from 'semantic-ui-react';
-import { API, removeTrailingSlash, showError } from '../helpers';
+import { API, removeTrailingSlash, showError, showSuccess } from '../helpers';
 
 const SystemSetting = () => {
   let [inputs, setInputs] = useState({
@@ -10,8 +10,35 @@ const SystemSetting = () => {
     GitHubOAuthEnabled: '',
     GitHubClientId: '',
     GitHubClientSecret: '',
+    OidcEnabled: '',
+    OidcWellKnown: '',
+    OidcClientId: '',
+    OidcClientSecret: '',
+    OidcAuthorizationEndpoint: '',
+    OidcTokenEndpoint: '',
+    OidcUserinfoEndpoint: '',
+    OidcGroupClaim: '',
+    OidcGroupMapping: '',
+    OidcRoleClaim: '',
+    OidcRoleMapping: '',
+    OidcPasswordLoginEnabled: '',
     LarkClientId: '',
     LarkClientSecret: '',
+    LdapEnabled: '',
+    LdapServerURL: '',
+    LdapStartTLSEnabled: '',
+    LdapTLSSkipVerifyEnabled: '',
+    LdapTLSCACert: '',
+    LdapBindDN: '',
+    LdapBindSecret: '',
+    LdapBaseDN: '',
+    LdapUserFilter: '',
+    LdapUsernameAttribute: '',
+    LdapEmailAttribute: '',
+    LdapDisplayNameAttribute: '',
+    LdapGroupAttribute: '',
+    LdapGroupMapping: '',
+    ScimSecret: '',
     Notice: '',
     SMTPServer: '',
     SMTPPort: '',
@@ -27,6 +54,7 @@ const SystemSetting = () => {
     MessagePusherAddress: '',
     MessagePusherToken: '',
     TurnstileCheckEnabled: '',
+    AdminTwoFactorEnabled: '',
     TurnstileSiteKey: '',
     TurnstileSecretKey: '',
     RegisterEnabled: '',
@@ -72,8 +100,14 @@ const SystemSetting = () => {
       case 'PasswordRegisterEnabled':
       case 'EmailVerificationEnabled':
       case 'GitHubOAuthEnabled':
+      case 'OidcEnabled':
+      case 'OidcPasswordLoginEnabled':
+      case 'LdapEnabled':
+      case 'LdapStartTLSEnabled':
+      case 'LdapTLSSkipVerifyEnabled':
       case 'WeChatAuthEnabled':
       case 'TurnstileCheckEnabled':
+      case 'AdminTwoFactorEnabled':
       case 'EmailDomainRestrictionEnabled':
       case 'RegisterEnabled':
         value = inputs[key] === 'true' ? 'false' : 'true';
@@ -113,6 +147,8 @@ const SystemSetting = () => {
       name === 'GitHubClientSecret' ||
       name === 'LarkClientId' ||
       name === 'LarkClientSecret' ||
+      (name.startsWith('Oidc') && !name.endsWith('Enabled')) ||
+      (name.startsWith('Ldap') && !name.endsWith('Enabled')) ||
       name === 'WeChatServerAddress' ||
       name === 'WeChatServerToken' ||
       name === 'WeChatAccountQRCodeImageURL' ||
@@ -216,6 +252,47 @@ const SystemSetting = () => {
     }
   };
 
+  const submitOidc = async () => {
+    const oidcInputs = { ...inputs };
+    if (oidcInputs.OidcWellKnown !== '') {
+      if (!oidcInputs.OidcWellKnown.startsWith('http://') && !oidcInputs.OidcWellKnown.startsWith('https://')) {
+        showError('Well-Known URL 必须以 http:// 或 https:// 开头');
+        return;
+      }
+      try {
+        const res = await API.get(oidcInputs.OidcWellKnown);
+        oidcInputs.OidcAuthorizationEndpoint = res.data['authorization_endpoint'];
+        oidcInputs.OidcTokenEndpoint = res.data['token_endpoint'];
+        oidcInputs.OidcUserinfoEndpoint = res.data['userinfo_endpoint'];
+        showSuccess('获取 OIDC 配置成功！');
+      } catch (err) {
+        showError('获取 OIDC 配置失败，请检查网络状况和 Well-Known URL 是否正确');
+      }
+    }
+    const keys = [
+      'OidcWellKnown',
+      'OidcClientId',
+      'OidcAuthorizationEndpoint',
+      'OidcTokenEndpoint',
+      'OidcUserinfoEndpoint',
+      'OidcGroupClaim',
+      'OidcGroupMapping',
+      'OidcRoleClaim',
+      'OidcRoleMapping'
+    ];
+    for (const key of keys) {
+      if (originInputs[key] !== oidcInputs[key]) {
+        await updateOption(key, oidcInputs[key]);
+      }
+    }
+    if (
+      originInputs['OidcClientSecret'] !== oidcInputs.OidcClientSecret &&
+      oidcInputs.OidcClientSecret !== ''
+    ) {
+      await updateOption('OidcClientSecret', oidcInputs.OidcClientSecret);
+    }
+  };
+
    const submitLarkOAuth = async () => {
     if (originInputs['LarkClientId'] !== inputs.LarkClientId) {
       await updateOption('LarkClientId', inputs.LarkClientId);
@@ -228,6 +305,41 @@ const SystemSetting = () => {
     }
   };
 
+  const submitLdap = async () => {
+    const keys = [
+      'LdapServerURL',
+      'LdapBindDN',
+      'LdapBaseDN',
+      'LdapUserFilter',
+      'LdapUsernameAttribute',
+      'LdapEmailAttribute',
+      'LdapDisplayNameAttribute',
+      'LdapGroupAttribute',
+      'LdapGroupMapping',
+      'LdapTLSCACert'
+    ];
+    for (const key of keys) {
+      if (originInputs[key] !== inputs[key]) {
+        await updateOption(key, inputs[key]);
+      }
+    }
+    if (
+      originInputs['LdapBindSecret'] !== inputs.LdapBindSecret &&
+      inputs.LdapBindSecret !== ''
+    ) {
+      await updateOption('LdapBindSecret', inputs.LdapBindSecret);
+    }
+  };
+
+  const submitScim = async () => {
+    if (
+      originInputs['ScimSecret'] !== inputs.ScimSecret &&
+      inputs.ScimSecret !== ''
+    ) {
+      await updateOption('ScimSecret', inputs.ScimSecret);
+    }
+  };
+
   const submitTurnstile = async () => {
     if (originInputs['TurnstileSiteKey'] !== inputs.TurnstileSiteKey) {
       await updateOption('TurnstileSiteKey', inputs.TurnstileSiteKey);
@@ -326,6 +438,18 @@ const SystemSetting = () => {
               name='GitHubOAuthEnabled'
               onChange={handleInputChange}
             />
+            <Form.Checkbox
+              checked={inputs.OidcEnabled === 'true'}
+              label='允许通过 OIDC 登录 & 注册'
+              name='OidcEnabled'
+              onChange={handleInputChange}
+            />
+            <Form.Checkbox
+              checked={inputs.LdapEnabled === 'true'}
+              label='允许通过 LDAP 账户登录 & 注册'
+              name='LdapEnabled'
+              onChange={handleInputChange}
+            />
             <Form.Checkbox
               checked={inputs.WeChatAuthEnabled === 'true'}
               label='允许通过微信登录 & 注册'
@@ -346,6 +470,12 @@ const SystemSetting = () => {
               name='TurnstileCheckEnabled'
               onChange={handleInputChange}
             />
+            <Form.Checkbox
+              checked={inputs.AdminTwoFactorEnabled === 'true'}
+              label='要求管理员启用两步验证'
+              name='AdminTwoFactorEnabled'
+              onChange={handleInputChange}
+            />
           </Form.Group>
           <Divider />
           <Header as='h3'>
@@ -485,6 +615,250 @@ const SystemSetting = () => {
             保存 GitHub OAuth 设置
           </Form.Button>
           <Divider />
+          <Header as='h3'>
+            配置 OIDC
+            <Header.Subheader>
+              用以支持通过 OIDC 登录，例如 Okta、Auth0 等兼容 OIDC 协议的 IdP
+            </Header.Subheader>
+          </Header>
+          <Message>
+            主页链接填 <code>{inputs.ServerAddress}</code>
+            ，重定向 URL 填{' '}
+            <code>{`${inputs.ServerAddress}/oauth/oidc`}</code>
+            。若你的 OIDC Provider 支持 Discovery Endpoint，你可以仅填写 OIDC Well-Known URL，系统会自动获取 OIDC 配置
+          </Message>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='Client ID'
+              name='OidcClientId'
+              onChange={handleInputChange}
+              value={inputs.OidcClientId}
+              placeholder='输入 OIDC 的 Client ID'
+            />
+            <Form.Input
+              label='Client Secret'
+              name='OidcClientSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              value={inputs.OidcClientSecret}
+              placeholder='敏感信息不会发送到前端显示'
+            />
+            <Form.Input
+              label='Well-Known URL'
+              name='OidcWellKnown'
+              onChange={handleInputChange}
+              value={inputs.OidcWellKnown}
+              placeholder='请输入 OIDC 的 Well-Known URL'
+            />
+          </Form.Group>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='Authorization Endpoint'
+              name='OidcAuthorizationEndpoint'
+              onChange={handleInputChange}
+              value={inputs.OidcAuthorizationEndpoint}
+              placeholder='输入 OIDC 的 Authorization Endpoint'
+            />
+            <Form.Input
+              label='Token Endpoint'
+              name='OidcTokenEndpoint'
+              onChange={handleInputChange}
+              value={inputs.OidcTokenEndpoint}
+              placeholder='输入 OIDC 的 Token Endpoint'
+            />
+            <Form.Input
+              label='Userinfo Endpoint'
+              name='OidcUserinfoEndpoint'
+              onChange={handleInputChange}
+              value={inputs.OidcUserinfoEndpoint}
+              placeholder='输入 OIDC 的 Userinfo Endpoint'
+            />
+          </Form.Group>
+          <Form.Group widths={2}>
+            <Form.Input
+              label='分组 Claim'
+              name='OidcGroupClaim'
+              onChange={handleInputChange}
+              value={inputs.OidcGroupClaim}
+              placeholder='例如 groups，支持 realm_access.roles 这样的嵌套 Claim'
+            />
+            <Form.Input
+              label='角色 Claim'
+              name='OidcRoleClaim'
+              onChange={handleInputChange}
+              value={inputs.OidcRoleClaim}
+              placeholder='例如 roles'
+            />
+          </Form.Group>
+          <Form.Group widths={2}>
+            <Form.TextArea
+              label='分组映射'
+              name='OidcGroupMapping'
+              onChange={handleInputChange}
+              style={{ minHeight: 100, fontFamily: 'JetBrains Mono, Consolas' }}
+              value={inputs.OidcGroupMapping}
+              placeholder='JSON 对象，键为 Claim 的值，值为本系统的分组，例如 {"paid": "vip"}'
+            />
+            <Form.TextArea
+              label='角色映射'
+              name='OidcRoleMapping'
+              onChange={handleInputChange}
+              style={{ minHeight: 100, fontFamily: 'JetBrains Mono, Consolas' }}
+              value={inputs.OidcRoleMapping}
+              placeholder='JSON 对象，键为 Claim 的值，值为 common 或 admin，例如 {"oneapi-admin": "admin"}'
+            />
+          </Form.Group>
+          <Form.Group inline>
+            <Form.Checkbox
+              checked={inputs.OidcPasswordLoginEnabled === 'true'}
+              label='允许已绑定 OIDC 的用户通过密码登录（root 用户不受限制）'
+              name='OidcPasswordLoginEnabled'
+              onChange={handleInputChange}
+            />
+          </Form.Group>
+          <Form.Button onClick={submitOidc}>
+            保存 OIDC 设置
+          </Form.Button>
+          <Divider />
+          <Header as='h3'>
+            配置 LDAP
+            <Header.Subheader>
+              用以支持通过 LDAP / Active Directory 账户登录，用户首次登录时自动创建
+            </Header.Subheader>
+          </Header>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='服务器地址'
+              name='LdapServerURL'
+              onChange={handleInputChange}
+              value={inputs.LdapServerURL}
+              placeholder='例如：ldap://ldap.example.com:389 或 ldaps://ldap.example.com:636'
+            />
+            <Form.Input
+              label='Bind DN'
+              name='LdapBindDN'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.LdapBindDN}
+              placeholder='用于查询用户的服务账号，留空则匿名查询'
+            />
+            <Form.Input
+              label='Bind 密码'
+              name='LdapBindSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              value={inputs.LdapBindSecret}
+              placeholder='敏感信息不会发送到前端显示'
+            />
+          </Form.Group>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='Base DN'
+              name='LdapBaseDN'
+              onChange={handleInputChange}
+              value={inputs.LdapBaseDN}
+              placeholder='例如：dc=example,dc=org'
+            />
+            <Form.Input
+              label='用户过滤器'
+              name='LdapUserFilter'
+              onChange={handleInputChange}
+              value={inputs.LdapUserFilter}
+              placeholder='%s 为用户名，例如：(uid=%s)，AD 可使用 (sAMAccountName=%s)'
+            />
+            <Form.Input
+              label='分组属性'
+              name='LdapGroupAttribute'
+              onChange={handleInputChange}
+              value={inputs.LdapGroupAttribute}
+              placeholder='例如：memberOf'
+            />
+          </Form.Group>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='用户名属性'
+              name='LdapUsernameAttribute'
+              onChange={handleInputChange}
+              value={inputs.LdapUsernameAttribute}
+              placeholder='例如：uid，AD 可使用 sAMAccountName'
+            />
+            <Form.Input
+              label='邮箱属性'
+              name='LdapEmailAttribute'
+              onChange={handleInputChange}
+              value={inputs.LdapEmailAttribute}
+              placeholder='例如：mail'
+            />
+            <Form.Input
+              label='显示名称属性'
+              name='LdapDisplayNameAttribute'
+              onChange={handleInputChange}
+              value={inputs.LdapDisplayNameAttribute}
+              placeholder='例如：cn 或 displayName'
+            />
+          </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='分组映射'
+              name='LdapGroupMapping'
+              onChange={handleInputChange}
+              style={{ minHeight: 100, fontFamily: 'JetBrains Mono, Consolas' }}
+              value={inputs.LdapGroupMapping}
+              placeholder='为一个 JSON 对象，键为目录分组的 DN 或 CN，值为本系统的分组，例如：{"cn=vip,ou=groups,dc=example,dc=org": "vip"}'
+            />
+          </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='CA 证书'
+              name='LdapTLSCACert'
+              onChange={handleInputChange}
+              style={{ minHeight: 100, fontFamily: 'JetBrains Mono, Consolas' }}
+              value={inputs.LdapTLSCACert}
+              placeholder='PEM 格式，用于校验使用 ldaps 或 StartTLS 的服务器证书，留空则使用系统根证书'
+            />
+          </Form.Group>
+          <Form.Group inline>
+            <Form.Checkbox
+              checked={inputs.LdapStartTLSEnabled === 'true'}
+              label='使用 StartTLS'
+              name='LdapStartTLSEnabled'
+              onChange={handleInputChange}
+            />
+            <Form.Checkbox
+              checked={inputs.LdapTLSSkipVerifyEnabled === 'true'}
+              label='跳过服务器证书校验（不安全，仅用于测试）'
+              name='LdapTLSSkipVerifyEnabled'
+              onChange={handleInputChange}
+            />
+          </Form.Group>
+          <Form.Button onClick={submitLdap}>
+            保存 LDAP 设置
+          </Form.Button>
+          <Divider />
+          <Header as='h3'>
+            配置 SCIM
+            <Header.Subheader>
+              用以支持身份提供商（如 Okta、Azure AD）自动同步用户与分组，SCIM 地址填{' '}
+              <code>{`${inputs.ServerAddress}/scim/v2`}</code>，留空则不启用
+            </Header.Subheader>
+          </Header>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='SCIM Token'
+              name='ScimSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              value={inputs.ScimSecret}
+              placeholder='敏感信息不会发送到前端显示'
+            />
+          </Form.Group>
+          <Form.Button onClick={submitScim}>
+            保存 SCIM 设置
+          </Form.Button>
+          <Divider />
           <Header as='h3'>
             配置飞书授权登录
             <Header.Subheader>
@@ -85,7 +85,15 @@ const TokensTable = () => {
     await loadTokens(activePage - 1);
   };
 
+  // only the hash of the key is stored, so the user needs to provide the key
+  const askForKey = (token) => {
+    let key = window.prompt(`令牌只在创建时显示，请输入完整的令牌 sk-${token.key_prefix}...`);
+    if (!key) return '';
+    return key.trim().replace(/^sk-/, '');
+  };
+
   const onCopy = async (type, key) => {
+    if (!key) return;
     let status = localStorage.getItem('status');
     let serverAddress = '';
     if (status) {
@@ -131,6 +139,7 @@ const TokensTable = () => {
   };
 
   const onOpenLink = async (type, key) => {
+    if (!key) return;
     let status = localStorage.getItem('status');
     let serverAddress = '';
     if (status) {
@@ -309,6 +318,7 @@ const TokensTable = () => {
             >
               剩余额度
             </Table.HeaderCell>
+            <Table.HeaderCell>令牌</Table.HeaderCell>
             <Table.HeaderCell
               style={{ cursor: 'pointer' }}
               onClick={() => {
@@ -343,6 +353,7 @@ const TokensTable = () => {
                   <Table.Cell>{renderStatus(token.status)}</Table.Cell>
                   <Table.Cell>{renderQuota(token.used_quota)}</Table.Cell>
                   <Table.Cell>{token.unlimited_quota ? '无限制' : renderQuota(token.remain_quota, 2)}</Table.Cell>
+                  <Table.Cell>{`sk-${token.key_prefix}...`}</Table.Cell>
                   <Table.Cell>{renderTimestamp(token.created_time)}</Table.Cell>
                   <Table.Cell>{token.expired_time === -1 ? '永不过期' : renderTimestamp(token.expired_time)}</Table.Cell>
                   <Table.Cell>
@@ -352,7 +363,7 @@ const TokensTable = () => {
                           size={'small'}
                           positive
                           onClick={async () => {
-                            await onCopy('', token.key);
+                            await onCopy('', askForKey(token));
                           }}
                         >
                           复制
@@ -363,7 +374,7 @@ const TokensTable = () => {
                           options={COPY_OPTIONS.map(option => ({
                             ...option,
                             onClick: async () => {
-                              await onCopy(option.value, token.key);
+                              await onCopy(option.value, askForKey(token));
                             }
                           }))}
                           trigger={<></>}
@@ -375,7 +386,7 @@ const TokensTable = () => {
                             size={'small'}
                             positive
                             onClick={() => {     
-                              onOpenLink('', token.key);       
+                              onOpenLink('', askForKey(token));       
                             }}>
                             聊天
                           </Button>
@@ -385,7 +396,7 @@ const TokensTable = () => {
                             options={OPEN_LINK_OPTIONS.map(option => ({
                               ...option,
                               onClick: async () => {
-                                await onOpenLink(option.value, token.key);
+                                await onOpenLink(option.value, askForKey(token));
                               }
                             }))}       
                             trigger={<></>}   
@@ -439,7 +450,7 @@ const TokensTable = () => {
 
         <Table.Footer>
           <Table.Row>
-            <Table.HeaderCell colSpan='7'>
+            <Table.HeaderCell colSpan='8'>
               <Button size='small' as={Link} to='/token/add' loading={loading}>
                 添加新的令牌
               </Button>
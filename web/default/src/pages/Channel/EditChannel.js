@@ -7,7 +7,9 @@ import { CHANNEL_OPTIONS } from '../../constants';
 const MODEL_MAPPING_EXAMPLE = {
   'gpt-3.5-turbo-0301': 'gpt-3.5-turbo',
   'gpt-4-0314': 'gpt-4',
-  'gpt-4-32k-0314': 'gpt-4-32k'
+  'gpt-4-32k-0314': 'gpt-4-32k',
+  'gpt-4o-*': 'gpt-4o',
+  '^claude-(.*)$': 'anthropic/claude-$1'
 };
 
 function type2secretPrompt(type) {
@@ -26,6 +28,26 @@ function type2secretPrompt(type) {
   }
 }
 
+// the channel types whose balance can be fetched
+const BALANCE_CHANNEL_TYPES = [1, 4, 5, 8, 10, 12, 13, 20, 25, 36, 44];
+
+const LOW_BALANCE_ACTION_OPTIONS = [
+  { key: 'notify', text: '仅通知', value: '' },
+  { key: 'disable', text: '禁用渠道', value: 'disable' },
+  { key: 'deprioritize', text: '降低优先级', value: 'deprioritize' }
+];
+
+const PARAM_OVERRIDE_EXAMPLE = {
+  set: { temperature: 0.7 },
+  default: { top_p: 1 },
+  delete: ['stream_options'],
+  clamp: { max_tokens: { min: 1, max: 4096 } }
+};
+
+const HEADERS_EXAMPLE = {
+  'HTTP-Referer': 'https://example.com'
+};
+
 const EditChannel = () => {
   const params = useParams();
   const navigate = useNavigate();
@@ -55,6 +77,8 @@ const EditChannel = () => {
   const [basicModels, setBasicModels] = useState([]);
   const [fullModels, setFullModels] = useState([]);
   const [customModel, setCustomModel] = useState('');
+  const [paramOverride, setParamOverride] = useState('');
+  const [headers, setHeaders] = useState('');
   const [config, setConfig] = useState({
     region: '',
     sk: '',
@@ -78,6 +102,28 @@ const EditChannel = () => {
     setConfig((inputs) => ({ ...inputs, [name]: value }));
   };
 
+  // the numbers in the config are entered as strings
+  const stringifyConfig = () => {
+    let localConfig = { ...config };
+    for (const name of ['balance_threshold', 'low_balance_priority', 'connect_timeout', 'response_header_timeout', 'timeout']) {
+      if (localConfig[name] === '' || localConfig[name] === undefined) {
+        delete localConfig[name];
+      } else {
+        localConfig[name] = Number(localConfig[name]);
+      }
+    }
+    // the JSON ones are edited as text
+    delete localConfig.param_override;
+    delete localConfig.headers;
+    if (paramOverride !== '' && verifyJSON(paramOverride)) {
+      localConfig.param_override = JSON.parse(paramOverride);
+    }
+    if (headers !== '' && verifyJSON(headers)) {
+      localConfig.headers = JSON.parse(headers);
+    }
+    return JSON.stringify(localConfig);
+  };
+
   const loadChannel = async () => {
     let res = await API.get(`/api/channel/${channelId}`);
     const { success, message, data } = res.data;
@@ -97,7 +143,14 @@ const EditChannel = () => {
       }
       setInputs(data);
       if (data.config !== '') {
-        setConfig(JSON.parse(data.config));
+        const localConfig = JSON.parse(data.config);
+        setConfig(localConfig);
+        if (localConfig.param_override) {
+          setParamOverride(JSON.stringify(localConfig.param_override, null, 2));
+        }
+        if (localConfig.headers) {
+          setHeaders(JSON.stringify(localConfig.headers, null, 2));
+        }
       }
       setBasicModels(getChannelModels(data.type));
     } else {
@@ -179,6 +232,14 @@ const EditChannel = () => {
       showInfo('模型映射必须是合法的 JSON 格式！');
       return;
     }
+    if (paramOverride !== '' && !verifyJSON(paramOverride)) {
+      showInfo('参数覆盖必须是合法的 JSON 格式！');
+      return;
+    }
+    if (headers !== '' && !verifyJSON(headers)) {
+      showInfo('自定义请求头必须是合法的 JSON 格式！');
+      return;
+    }
     let localInputs = {...inputs};
     if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
       localInputs.base_url = localInputs.base_url.slice(0, localInputs.base_url.length - 1);
@@ -189,7 +250,7 @@ const EditChannel = () => {
     let res;
     localInputs.models = localInputs.models.join(',');
     localInputs.group = localInputs.groups.join(',');
-    localInputs.config = JSON.stringify(config);
+    localInputs.config = stringifyConfig();
     if (isEdit) {
       res = await API.put(`/api/channel/`, { ...localInputs, id: parseInt(channelId) });
     } else {
@@ -208,6 +269,38 @@ const EditChannel = () => {
     }
   };
 
+  const fetchUpstreamModels = async () => {
+    let localInputs = {
+      type: inputs.type,
+      key: inputs.key,
+      base_url: inputs.base_url,
+      config: stringifyConfig()
+    };
+    if (isEdit) {
+      localInputs.id = parseInt(channelId);
+    }
+    const res = await API.post(`/api/channel/fetch_models`, localInputs);
+    const { success, message, data } = res.data;
+    if (success) {
+      // the models redirected by the model mapping are kept
+      let modelMapping = {};
+      if (inputs.model_mapping !== '' && verifyJSON(inputs.model_mapping)) {
+        modelMapping = JSON.parse(inputs.model_mapping);
+      }
+      const kept = inputs.models.filter((model) => !data.includes(model) && modelMapping[model]);
+      const added = data.filter((model) => !inputs.models.includes(model));
+      const removed = inputs.models.filter((model) => !data.includes(model) && !modelMapping[model]);
+      setModelOptions((modelOptions) => [
+        ...modelOptions,
+        ...added.map((model) => ({ key: model, text: model, value: model }))
+      ]);
+      handleInputChange(null, { name: 'models', value: [...data, ...kept] });
+      showInfo(`已获取 ${data.length} 个模型，新增 ${added.length} 个，移除 ${removed.length} 个。`);
+    } else {
+      showError(message);
+    }
+  };
+
   const addCustomModel = () => {
     if (customModel.trim() === '') return;
     if (inputs.models.includes(customModel)) return;
@@ -403,6 +496,7 @@ const EditChannel = () => {
                 <Button type={'button'} onClick={() => {
                   handleInputChange(null, { name: 'models', value: fullModels });
                 }}>填入所有模型</Button>
+                <Button type={'button'} onClick={fetchUpstreamModels}>从上游获取模型</Button>
                 <Button type={'button'} onClick={() => {
                   handleInputChange(null, { name: 'models', value: [] });
                 }}>清除所有模型</Button>
@@ -430,7 +524,7 @@ const EditChannel = () => {
               <Form.Field>
                 <Form.TextArea
                   label='模型重定向'
-                  placeholder={`此项可选，用于修改请求体中的模型名称，为一个 JSON 字符串，键为请求中模型名称，值为要替换的模型名称，例如：\n${JSON.stringify(MODEL_MAPPING_EXAMPLE, null, 2)}`}
+                  placeholder={`此项可选，用于修改请求体中的模型名称，为一个 JSON 字符串，键为请求中模型名称，值为要替换的模型名称，键中可使用通配符 * 或以 ^ 开头的正则表达式，值中可用 $1 引用匹配的部分，精确匹配优先，其余按书写顺序匹配，例如：\n${JSON.stringify(MODEL_MAPPING_EXAMPLE, null, 2)}`}
                   name='model_mapping'
                   onChange={handleInputChange}
                   value={inputs.model_mapping}
@@ -449,6 +543,28 @@ const EditChannel = () => {
                   autoComplete='new-password'
                 />
               </Form.Field>
+              <Form.Field>
+                <Form.TextArea
+                  label='参数覆盖'
+                  placeholder={`此项可选，用于修改发往上游的请求体，为一个 JSON 字符串，set 为覆盖的参数，default 为请求中未设置时的默认值，delete 为删除的参数，clamp 为数值参数的范围，嵌套的参数用 . 分隔，例如：\n${JSON.stringify(PARAM_OVERRIDE_EXAMPLE, null, 2)}`}
+                  name='param_override'
+                  onChange={(e, { value }) => setParamOverride(value)}
+                  value={paramOverride}
+                  style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+              <Form.Field>
+                <Form.TextArea
+                  label='自定义请求头'
+                  placeholder={`此项可选，用于向上游请求添加请求头，将覆盖同名的请求头，为一个 JSON 字符串，例如：\n${JSON.stringify(HEADERS_EXAMPLE, null, 2)}`}
+                  name='headers'
+                  onChange={(e, { value }) => setHeaders(value)}
+                  value={headers}
+                  style={{ minHeight: 100, fontFamily: 'JetBrains Mono, Consolas' }}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
               </>
             )
           }
@@ -607,6 +723,97 @@ const EditChannel = () => {
               </Form.Field>
             )
           }
+          <Form.Field>
+            <Form.Input
+              label='代理'
+              name='proxy'
+              placeholder={'此项可选，该渠道的请求通过此代理发送，支持 http、https 与 socks5，例如：socks5://127.0.0.1:1080，留空则使用 RELAY_PROXY'}
+              onChange={handleConfigChange}
+              value={config.proxy ?? ''}
+              autoComplete='new-password'
+            />
+          </Form.Field>
+          <Form.Group widths='equal'>
+            <Form.Input
+              label='连接超时（秒）'
+              name='connect_timeout'
+              type='number'
+              placeholder={'此项可选'}
+              onChange={handleConfigChange}
+              value={config.connect_timeout ?? ''}
+              autoComplete='new-password'
+            />
+            <Form.Input
+              label='响应头超时（秒）'
+              name='response_header_timeout'
+              type='number'
+              placeholder={'此项可选，等待上游返回响应头的时间'}
+              onChange={handleConfigChange}
+              value={config.response_header_timeout ?? ''}
+              autoComplete='new-password'
+            />
+            <Form.Input
+              label='总超时（秒）'
+              name='timeout'
+              type='number'
+              placeholder={'此项可选，包含读取流式响应的时间，留空则使用 RELAY_TIMEOUT'}
+              onChange={handleConfigChange}
+              value={config.timeout ?? ''}
+              autoComplete='new-password'
+            />
+          </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.Input
+              label='TLS 服务器名称'
+              name='tls_server_name'
+              placeholder={'此项可选，用于校验上游证书的域名'}
+              onChange={handleConfigChange}
+              value={config.tls_server_name ?? ''}
+              autoComplete='new-password'
+            />
+            <Form.Checkbox
+              label='跳过 TLS 证书校验'
+              name='tls_insecure_skip_verify'
+              style={{ marginTop: '2em' }}
+              checked={config.tls_insecure_skip_verify === true}
+              onChange={(e, { name, checked }) => setConfig((inputs) => ({ ...inputs, [name]: checked }))}
+            />
+          </Form.Group>
+          {
+            BALANCE_CHANNEL_TYPES.includes(inputs.type) && (
+              <Form.Group widths='equal'>
+                <Form.Input
+                  label='余额预警阈值'
+                  name='balance_threshold'
+                  type='number'
+                  placeholder={'此项可选，定期更新余额时低于该值将通知管理员，单位与渠道余额一致'}
+                  onChange={handleConfigChange}
+                  value={config.balance_threshold ?? ''}
+                  autoComplete='new-password'
+                />
+                <Form.Select
+                  label='余额不足时'
+                  name='low_balance_action'
+                  options={LOW_BALANCE_ACTION_OPTIONS}
+                  onChange={handleConfigChange}
+                  value={config.low_balance_action ?? ''}
+                />
+                {
+                  config.low_balance_action === 'deprioritize' && (
+                    <Form.Input
+                      label='余额不足时的优先级'
+                      name='low_balance_priority'
+                      type='number'
+                      placeholder={'余额恢复后将还原为原来的优先级'}
+                      onChange={handleConfigChange}
+                      value={config.low_balance_priority ?? ''}
+                      autoComplete='new-password'
+                    />
+                  )
+                }
+              </Form.Group>
+            )
+          }
           <Button onClick={handleCancel}>取消</Button>
           <Button type={isEdit ? 'button' : 'submit'} positive onClick={submit}>提交</Button>
         </Form>
@@ -19,6 +19,7 @@ const EditToken = () => {
     subnet: "",
   };
   const [inputs, setInputs] = useState(originInputs);
+  const [createdKey, setCreatedKey] = useState('');
   const { name, remain_quota, expired_time, unlimited_quota } = inputs;
   const navigate = useNavigate();
   const handleInputChange = (e, { name, value }) => {
@@ -107,12 +108,18 @@ const EditToken = () => {
     } else {
       res = await API.post(`/api/token/`, localInputs);
     }
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
       if (isEdit) {
         showSuccess('令牌更新成功！');
       } else {
-        showSuccess('令牌创建成功，请在列表页面点击复制获取令牌！');
+        // the key is only returned once, it can't be viewed again
+        setCreatedKey(`sk-${data.key}`);
+        if (await copy(`sk-${data.key}`)) {
+          showSuccess('令牌创建成功，已复制到剪贴板！');
+        } else {
+          showSuccess('令牌创建成功，请复制并妥善保存令牌！');
+        }
         setInputs(originInputs);
       }
     } else {
@@ -124,6 +131,12 @@ const EditToken = () => {
     <>
       <Segment loading={loading}>
         <Header as='h3'>{isEdit ? '更新令牌信息' : '创建新的令牌'}</Header>
+        {createdKey && (
+          <Message positive>
+            <Message.Header>令牌仅显示这一次，请立即复制并妥善保存</Message.Header>
+            <p style={{ wordBreak: 'break-all' }}>{createdKey}</p>
+          </Message>
+        )}
         <Form autoComplete='new-password'>
           <Form.Field>
             <Form.Input